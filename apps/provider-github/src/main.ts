@@ -13,7 +13,14 @@
  * See the License for the specific language governing permissions and
  * limitations under the License.
  */
-import { Route, User, bootstrapPassport } from '@opensesame-cloud/js-sdk';
+import {
+  RevokeHandler,
+  Route,
+  User,
+  bootstrapPassport,
+  oauth2Refresh,
+  tokensExpireAt,
+} from '@opensesame-cloud/js-sdk';
 import { Profile } from 'passport';
 import { Strategy, StrategyOptions } from 'passport-github2';
 import { VerifyCallback } from 'passport-oauth2';
@@ -23,7 +30,15 @@ if (!callbackURL) {
   throw new Error('CALLBACK_URL is required');
 }
 
+// Raw emails include whether GitHub has verified them
+interface GitHubEmail {
+  value: string;
+  primary?: boolean;
+  verified?: boolean;
+}
+
 const config: StrategyOptions = {
+  allRawEmails: true,
   clientID: process.env.CLIENT_ID ?? '',
   clientSecret: process.env.CLIENT_SECRET ?? '',
   callbackURL,
@@ -42,9 +57,13 @@ const strategy = new Strategy(
   (
     accessToken: string,
     refreshToken: string,
+    params: { expires_in?: number },
     profile: Profile,
     done: VerifyCallback,
   ) => {
+    const emails = (profile.emails ?? []) as GitHubEmail[];
+    const email = emails.find((e) => e.primary) ?? emails[0];
+
     const user: User = {
       providerId: profile.id,
       tokens: {
@@ -52,8 +71,10 @@ const strategy = new Strategy(
         refreshToken,
       },
       name: profile.displayName,
-      emailAddress: profile.emails?.[0]?.value,
+      emailAddress: email?.value,
+      emailVerified: email?.verified === true,
       username: profile.username,
+      tokensExpireAt: tokensExpireAt(params.expires_in),
     };
 
     done(null, user);
@@ -66,8 +87,43 @@ const routes = new Map<Route, boolean>([
   [Route.ROUTE_CALLBACK_GET, true],
 ]);
 
+// Deleting the grant revokes every token GitHub issued to the app for the user
+// @link https://docs.github.com/en/rest/apps/oauth-applications#delete-an-app-authorization
+const revoke: RevokeHandler = async ({ tokens }) => {
+  const credentials = Buffer.from(
+    `${config.clientID}:${config.clientSecret}`,
+  ).toString('base64');
+
+  const res = await fetch(
+    `https://api.github.com/applications/${config.clientID}/grant`,
+    {
+      method: 'DELETE',
+      headers: {
+        accept: 'application/vnd.github+json',
+        authorization: `Basic ${credentials}`,
+      },
+      body: JSON.stringify({ access_token: tokens.accessToken }),
+    },
+  );
+
+  // Not found means it's already been revoked
+  if (!res.ok && res.status !== 404) {
+    throw new Error(`GitHub returned ${res.status} revoking the grant`);
+  }
+
+  return {};
+};
+
 // GO GO GO!!!
-bootstrapPassport([strategy], routes).catch((err: Error) => {
+bootstrapPassport([strategy], routes, {
+  display: {
+    icon: 'https://github.githubassets.com/favicons/favicon.svg',
+    buttonColour: '#24292f',
+  },
+  // Refresh the tokens with the OAuth2 refresh_token grant
+  refresh: oauth2Refresh(strategy),
+  revoke,
+}).catch((err: Error) => {
   console.log(err.stack);
   process.exit(1);
 });
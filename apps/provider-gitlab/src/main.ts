@@ -13,7 +13,14 @@
  * See the License for the specific language governing permissions and
  * limitations under the License.
  */
-import { Route, User, bootstrapPassport } from '@opensesame-cloud/js-sdk';
+import {
+  RevokeHandler,
+  Route,
+  User,
+  bootstrapPassport,
+  oauth2Refresh,
+  tokensExpireAt,
+} from '@opensesame-cloud/js-sdk';
 import { Profile } from 'passport';
 import { Strategy, StrategyOptions } from 'passport-gitlab2';
 import { VerifyCallback } from 'passport-oauth2';
@@ -41,26 +48,66 @@ const config: StrategyOptions = {
   ],
 };
 
+const baseURL = config.baseURL ?? 'https://gitlab.com';
+
+// A confirmed account can still have unverified email addresses, so check the
+// one being used. The OpenID Connect user info says if that email is verified.
+// @link https://docs.gitlab.com/integration/openid_connect_provider/#shared-information
+const isEmailVerified = async (
+  accessToken: string,
+  emailAddress?: string,
+): Promise<boolean> => {
+  if (!emailAddress) {
+    return false;
+  }
+
+  const res = await fetch(new URL('/oauth/userinfo', baseURL), {
+    headers: { Authorization: `Bearer ${accessToken}` },
+  });
+  if (!res.ok) {
+    return false;
+  }
+
+  const info = (await res.json()) as {
+    email?: string;
+    email_verified?: boolean;
+  };
+
+  return (
+    info.email_verified === true &&
+    info.email?.toLowerCase() === emailAddress.toLowerCase()
+  );
+};
+
 const strategy = new Strategy(
   config,
   (
     accessToken: string,
     refreshToken: string,
+    params: { expires_in?: number },
     profile: Profile,
     done: VerifyCallback,
   ) => {
-    const user: User = {
-      providerId: profile.id,
-      tokens: {
-        accessToken,
-        refreshToken,
-      },
-      name: profile.displayName,
-      emailAddress: profile.emails?.[0]?.value,
-      username: profile.username,
-    };
+    const emailAddress = profile.emails?.[0]?.value;
 
-    done(null, user);
+    isEmailVerified(accessToken, emailAddress)
+      .then((emailVerified) => {
+        const user: User = {
+          providerId: profile.id,
+          tokens: {
+            accessToken,
+            refreshToken,
+          },
+          name: profile.displayName,
+          emailAddress,
+          emailVerified,
+          username: profile.username,
+          tokensExpireAt: tokensExpireAt(params.expires_in),
+        };
+
+        done(null, user);
+      })
+      .catch((err: Error) => done(err));
   },
 );
 
@@ -70,8 +117,35 @@ const routes = new Map<Route, boolean>([
   [Route.ROUTE_CALLBACK_GET, true],
 ]);
 
+// Revoking the access token also revokes the refresh token issued with it
+// @link https://docs.gitlab.com/api/oauth2/#revoke-a-token
+const revoke: RevokeHandler = async ({ tokens }) => {
+  const res = await fetch(new URL('/oauth/revoke', baseURL), {
+    method: 'POST',
+    body: new URLSearchParams({
+      client_id: config.clientID,
+      client_secret: config.clientSecret,
+      token: tokens.accessToken ?? '',
+    }),
+  });
+
+  if (!res.ok) {
+    throw new Error(`GitLab returned ${res.status} revoking the token`);
+  }
+
+  return {};
+};
+
 // GO GO GO!!!
-bootstrapPassport([strategy], routes).catch((err: Error) => {
+bootstrapPassport([strategy], routes, {
+  display: {
+    icon: new URL('/favicon.ico', baseURL).toString(),
+    buttonColour: '#fc6d26',
+  },
+  // Refresh the tokens with the OAuth2 refresh_token grant
+  refresh: oauth2Refresh(strategy),
+  revoke,
+}).catch((err: Error) => {
   console.log(err.stack);
   process.exit(1);
 });
@@ -22,7 +22,11 @@ import (
 
 	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
 	"github.com/mrsimonemms/opensesame/apps/server/internal/handler"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/notifier"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/providers"
 	"github.com/mrsimonemms/opensesame/apps/server/internal/server"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/stores"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/worker"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -63,6 +67,38 @@ func connectToDatabase(ctx context.Context, cfg *config.ServerConfig) database.D
 	return db
 }
 
+func createNotifier(cfg *config.ServerConfig) notifier.Notifier {
+	n, err := notifier.New(cfg.Notifier)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error creating notifier")
+	}
+
+	return n
+}
+
+func startWorker(ctx context.Context, cfg *config.ServerConfig, db database.Driver) {
+	orgs := stores.NewOrganisationsStore(cfg, db)
+	users := stores.NewUsersStore(cfg, db, providers.NewDescriptions())
+
+	worker.New().
+		Add(worker.Job{
+			Name:     "purge-organisations",
+			Interval: cfg.Orgs.PurgeInterval.Duration,
+			Run:      orgs.PurgeDeleted,
+		}).
+		Add(worker.Job{
+			Name:     "purge-users",
+			Interval: cfg.Users.PurgeInterval.Duration,
+			Run:      users.PurgeDeleted,
+		}).
+		Add(worker.Job{
+			Name:     "refresh-provider-tokens",
+			Interval: cfg.Users.RefreshInterval.Duration,
+			Run:      users.RefreshExpiringTokens,
+		}).
+		Start(ctx)
+}
+
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
@@ -74,8 +110,10 @@ var runCmd = &cobra.Command{
 
 		defer db.Close(ctx)
 
+		startWorker(ctx, cfg, db)
+
 		app := server.App()
-		h := handler.New(cfg, db)
+		h := handler.New(cfg, db, createNotifier(cfg))
 		h.Register(app)
 
 		addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
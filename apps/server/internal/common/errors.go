@@ -20,4 +20,37 @@ import (
 	"fmt"
 )
 
-var ErrNotDeleted = fmt.Errorf("no documents deleted")
+var (
+	ErrBuiltInRole      = fmt.Errorf("built-in roles cannot be changed")
+	ErrDuplicateOrgUser = fmt.Errorf("user listed more than once")
+	ErrEmailInUse       = fmt.Errorf("email address in use")
+	ErrForbidden        = fmt.Errorf("forbidden")
+	ErrInvalidClient    = fmt.Errorf("invalid client")
+	ErrInvalidExpiry    = fmt.Errorf("invalid expiry")
+	ErrInvalidFilter    = fmt.Errorf("invalid filter")
+	ErrInvalidGrant     = fmt.Errorf("invalid grant")
+	ErrInvalidInvite    = fmt.Errorf("invitation invalid or expired")
+	ErrInvalidMerge     = fmt.Errorf("users cannot be merged")
+	ErrInvalidPatch     = fmt.Errorf("invalid patch operation")
+	ErrInvalidProvider  = fmt.Errorf("invalid provider")
+	ErrInviteExists     = fmt.Errorf("invitation already pending")
+	ErrInvalidRole      = fmt.Errorf("invalid role")
+	ErrInvalidScope     = fmt.Errorf("invalid scope")
+	ErrInvalidTransfer  = fmt.Errorf("invalid ownership transfer")
+	ErrNoOrgOwner       = fmt.Errorf("organisation must have at least one owner")
+	ErrNoTransfer       = fmt.Errorf("no pending ownership transfer")
+	ErrNotDeleted       = fmt.Errorf("no documents deleted")
+	ErrOrgChanged       = fmt.Errorf("organisation changed since it was read")
+	ErrOrgNotFound      = fmt.Errorf("organisation not found")
+	ErrOrgOwner         = fmt.Errorf("organisation owner must transfer ownership first")
+	ErrRefreshFailed    = fmt.Errorf("provider tokens could not be refreshed")
+	ErrRefreshRejected  = fmt.Errorf("provider will not refresh these tokens")
+	ErrRevokeFailed     = fmt.Errorf("provider tokens could not be revoked")
+	ErrRoleExists       = fmt.Errorf("role already exists")
+	ErrRoleInUse        = fmt.Errorf("role is assigned to users")
+	ErrSlugInUse        = fmt.Errorf("slug in use")
+	ErrTeamNotFound     = fmt.Errorf("team not found")
+	ErrUnknownRole      = fmt.Errorf("unknown role")
+	ErrUnknownUser      = fmt.Errorf("unknown user")
+	ErrUserDeactivated  = fmt.Errorf("user is deactivated")
+)
@@ -19,6 +19,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/mrsimonemms/opensesame/apps/server/internal/database/mongodb"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
@@ -28,6 +29,16 @@ import (
 // Common database interface to allow multiple database types
 // in the future.
 type Driver interface {
+	// Make the recipient of the pending ownership transfer the organisation's owner
+	AcceptOwnershipTransfer(ctx context.Context, orgID, userID string) error
+
+	// Add a custom role to the organisation. Errors if a role has the same name.
+	AddOrganisationRole(ctx context.Context, orgID string, model *models.OrganisationRole) error
+
+	// Add a user to the organisation. Errors if they are already a member or
+	// their custom role no longer exists.
+	AddOrganisationUser(ctx context.Context, orgID string, model *models.OrganisationUser) error
+
 	Check(ctx context.Context) error
 
 	// Close the database connection and free up resources
@@ -36,25 +47,80 @@ type Driver interface {
 	// Authorize the connection to the database
 	Connect(ctx context.Context) error
 
-	// Delete organisation
-	DeleteOrganisation(ctx context.Context, orgID, userID string) error
+	// Find and delete an unexpired authorization code so it can only be used once
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (code *models.AuthorizationCode, err error)
+
+	// Delete the organisation's API key
+	DeleteAPIKey(ctx context.Context, orgID, keyID string) error
+
+	// Mark the organisation as deleted. It can be restored until it's purged.
+	DeleteOrganisation(ctx context.Context, orgID, userID string, purgeAfter time.Time) error
+
+	// Delete the user's personal access token
+	DeletePersonalAccessToken(ctx context.Context, userID, tokenID string) error
+
+	// Delete all of the user's personal access tokens
+	DeletePersonalAccessTokensByUser(ctx context.Context, userID string) error
+
+	// Delete the organisation's service account user
+	DeleteServiceAccount(ctx context.Context, orgID, userID string) error
+
+	// Remove a team from the organisation
+	DeleteTeam(ctx context.Context, orgID, teamID string) error
+
+	// Return the user IDs that belong to active users
+	FilterActiveUserIDs(ctx context.Context, userIDs []string) (activeUserIDs []string, err error)
 
 	// Find the user by the provider and provider user ID
 	FindUserByProviderAndUserID(ctx context.Context, providerID, providerUserID string) (user *models.User, err error)
 
+	// Get the API key by the hash of the key
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (key *models.APIKey, err error)
+
+	// Get a deleted organisation that can still be restored
+	GetDeletedOrgByID(ctx context.Context, orgID, userID string) (org *models.Organisation, err error)
+
+	// Get the invitation by ID
+	GetInvitationByID(ctx context.Context, invitationID string) (invitation *models.Invitation, err error)
+
+	// Get the pending invitation for the email address to the organisation
+	GetPendingInvitationByEmail(ctx context.Context, orgID, emailAddress string) (invitation *models.Invitation, err error)
+
 	// Get the organisation by ID
 	GetOrgByID(ctx context.Context, orgID, userID string) (org *models.Organisation, err error)
 
+	// Get the organisation by ID without checking membership - the caller must
+	// do their own authorisation
+	GetOrgByIDUnscoped(ctx context.Context, orgID string) (org *models.Organisation, err error)
+
+	// Get the personal access token by the hash of the token
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (token *models.PersonalAccessToken, err error)
+
 	// Get the organisation by Slug
 	GetOrgBySlug(ctx context.Context, slug string) (org *models.Organisation, err error)
 
+	// Get the service account user by its client ID
+	GetServiceAccountByClientID(ctx context.Context, clientID string) (user *models.User, err error)
+
+	// Get the user by their email address
+	GetUserByEmailAddress(ctx context.Context, emailAddress string) (user *models.User, err error)
+
 	// Get the user by ID
 	GetUserByID(ctx context.Context, userID string) (user *models.User, err error)
 
+	// List the organisation's API keys
+	ListAPIKeys(ctx context.Context, offset, limit int, orgID string) (keys *models.Pagination[*models.APIKey], err error)
+
+	// List every audit event about the user, oldest first
+	ListAuditEvents(ctx context.Context, userID string) (events []*models.AuditEvent, err error)
+
+	// List pending invitations to an organisation
+	ListInvitations(ctx context.Context, offset, limit int, orgID string) (invitations *models.Pagination[*models.Invitation], err error)
+
 	// List organisations available to a user
 	ListOrganisations(ctx context.Context, offset, limit int, userID string) (orgs *models.Pagination[*models.Organisation], err error)
 
-	// List users attached to an organisation
+	// List the active users attached to an organisation
 	ListOrganisationUsers(
 		ctx context.Context,
 		offset,
@@ -63,14 +129,136 @@ type Driver interface {
 		userID string,
 	) (users *models.Pagination[*models.OrganisationUser], err error)
 
+	// List the user's personal access tokens
+	ListPersonalAccessTokens(
+		ctx context.Context,
+		offset,
+		limit int,
+		userID string,
+	) (tokens *models.Pagination[*models.PersonalAccessToken], err error)
+
+	// List the organisation's service account users
+	ListServiceAccounts(ctx context.Context, offset, limit int, orgID string) (users *models.Pagination[*models.User], err error)
+
+	// List every user with the email address, ignoring case
+	ListUsersByEmailAddress(ctx context.Context, emailAddress string) (users []*models.User, err error)
+
+	// List active users whose tokens for the provider expire before the given time
+	ListUsersWithExpiringTokens(ctx context.Context, providerID string, before time.Time) (users []*models.User, err error)
+
+	// Replace the source user's membership of the organisation and its teams
+	// with the target's. The target's organisation and team memberships are set
+	// before the source is removed, so this can be repeated if it fails part way.
+	MergeOrganisationUser(
+		ctx context.Context,
+		orgID,
+		sourceID string,
+		target *models.OrganisationUser,
+		teamUsers map[string]*models.TeamUser,
+	) error
+
+	// Permanently delete organisations whose retention ended before the given
+	// time, along with their API keys, invitations and service accounts
+	PurgeOrganisations(ctx context.Context, before time.Time) (count int64, err error)
+
+	// Permanently delete users whose retention ended before the given time,
+	// along with their audit events, personal access tokens and any remaining
+	// organisation memberships
+	PurgeUsers(ctx context.Context, before time.Time) (count int64, err error)
+
+	// Move the user's audit events and personal access tokens to another user,
+	// along with the API keys and service accounts they created
+	ReassignUserRecords(ctx context.Context, fromUserID, toUserID string) error
+
+	// Remove a custom role from the organisation. Errors if any member has it.
+	RemoveOrganisationRole(ctx context.Context, orgID, name string) error
+
+	// Remove a user from the organisation and its teams. Errors if they are not
+	// a member, are the organisation's owner or are the last owner.
+	RemoveOrganisationUser(ctx context.Context, orgID, userID string) error
+
+	// Remove a user from the team. They remain a member of the organisation.
+	RemoveTeamUser(ctx context.Context, orgID, teamID, userID string) error
+
+	// Restore a deleted organisation
+	RestoreOrganisation(ctx context.Context, orgID string) error
+
+	// Revoke the user's auth tokens issued before the given time and remove their
+	// tokens for the providers. Nothing else on the user is changed.
+	RevokeUserTokens(ctx context.Context, userID string, validAfter time.Time, providerIDs []string) error
+
+	// Save the API key to the database
+	SaveAPIKey(ctx context.Context, model *models.APIKey) (key *models.APIKey, err error)
+
+	// Save the audit event to the database
+	SaveAuditEvent(ctx context.Context, model *models.AuditEvent) (event *models.AuditEvent, err error)
+
+	// Save the authorization code to the database
+	SaveAuthorizationCode(ctx context.Context, model *models.AuthorizationCode) (code *models.AuthorizationCode, err error)
+
+	// Save the invitation to the database
+	SaveInvitation(ctx context.Context, model *models.Invitation) (invitation *models.Invitation, err error)
+
 	// Save the org record to the database
 	SaveOrganisationRecord(ctx context.Context, model *models.Organisation) (user *models.Organisation, err error)
 
+	// Save the personal access token to the database
+	SavePersonalAccessToken(ctx context.Context, model *models.PersonalAccessToken) (token *models.PersonalAccessToken, err error)
+
+	// Create a team in the organisation or update its details. Members of existing
+	// teams are changed with RemoveTeamUser and SaveTeamUser. Team slugs are unique
+	// within the organisation.
+	SaveTeam(ctx context.Context, orgID string, model *models.Team) (team *models.Team, err error)
+
+	// Add an organisation member to the team or change their role
+	SaveTeamUser(ctx context.Context, orgID, teamID string, model *models.TeamUser) error
+
 	// Save the user record to the database
 	SaveUserRecord(ctx context.Context, model *models.User) (user *models.User, err error)
 
+	// Record when the API key was last used
+	UpdateAPIKeyLastUsed(ctx context.Context, keyID string, lastUsed time.Time) error
+
 	// Updates all users - used when rotating keys
 	UpdateAllUsers(ctx context.Context, update func(existing []*models.User) (updated []*models.User, err error)) (count int64, err error)
+
+	// Move a pending invitation to a new status. Returns nil if it is no longer pending.
+	UpdateInvitationStatus(
+		ctx context.Context,
+		invitationID string,
+		status models.InvitationStatus,
+		userID string,
+	) (invitation *models.Invitation, err error)
+
+	// Set the organisation's name and slug. If asked, the members and team
+	// members are replaced too - this errors if the organisation has changed
+	// since it was last updated at the model's updated date. Returns nil if
+	// the organisation doesn't exist.
+	UpdateOrganisation(ctx context.Context, model *models.Organisation, replaceUsers bool) (org *models.Organisation, err error)
+
+	// Change a custom role's description and permissions. Errors if it doesn't exist.
+	UpdateOrganisationRole(ctx context.Context, orgID string, model *models.OrganisationRole) error
+
+	// Change a member's role. Errors if they are not a member, their custom role
+	// no longer exists or the organisation's
+	// owner or last owner would be demoted.
+	UpdateOrganisationUserRole(ctx context.Context, orgID, userID, role string) error
+
+	// Set the organisation's pending ownership transfer - nil cancels it
+	UpdateOwnershipTransfer(ctx context.Context, orgID string, transfer *models.OwnershipTransfer) error
+
+	// Record when the personal access token was last used
+	UpdatePersonalAccessTokenLastUsed(ctx context.Context, tokenID string, lastUsed time.Time) error
+
+	// Replace an active user's tokens for the provider and when they expire. Nil
+	// tokens are left unchanged. Returns nil if there's no such user or account.
+	UpdateProviderTokens(
+		ctx context.Context,
+		userID,
+		providerID string,
+		tokens map[string]string,
+		expireAt *time.Time,
+	) (user *models.User, err error)
 }
 
 func New(cfg *config.ServerConfig) (Driver, error) {
@@ -17,6 +17,11 @@
 package mongodb
 
 const (
-	OrgsCollection  = "organisations"
-	UsersCollection = "users"
+	APIKeysCollection              = "apiKeys"
+	AuditEventsCollection          = "auditEvents"
+	AuthorizationCodesCollection   = "authorizationCodes"
+	InvitationsCollection          = "invitations"
+	OrgsCollection                 = "organisations"
+	PersonalAccessTokensCollection = "personalAccessTokens"
+	UsersCollection                = "users"
 )
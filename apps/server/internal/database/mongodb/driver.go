@@ -17,12 +17,14 @@
 package mongodb
 
 import (
+	"errors"
 	"fmt"
-	"math"
+	"slices"
 	"time"
 
 	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
 	mongoModels "github.com/mrsimonemms/opensesame/apps/server/internal/database/mongodb/models"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/rbac"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -42,6 +44,125 @@ type MongoDB struct {
 	database         string
 }
 
+func (db *MongoDB) AcceptOwnershipTransfer(ctx context.Context, orgID, userID string) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	now := time.Now()
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "users.userId", Value: userID},
+		{Key: "pendingTransfer.toUserId", Value: userID},
+		{Key: "pendingTransfer.expiresAt", Value: bson.M{"$gt": now}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"ownerId":                     userID,
+			"users.$[member].role":        models.OrgRoleOwner,
+			"users.$[member].updatedDate": now,
+			"updatedDate":                 now,
+		},
+		"$unset": bson.M{"pendingTransfer": ""},
+	}
+	opts := options.UpdateOne().SetArrayFilters([]any{
+		bson.M{"member.userId": userID},
+	})
+
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return fmt.Errorf("error accepting ownership transfer: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return common.ErrNoTransfer
+	}
+
+	return nil
+}
+
+func (db *MongoDB) AddOrganisationRole(ctx context.Context, orgID string, model *models.OrganisationRole) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(OrgsCollection)
+
+	// Only push the role if the name isn't taken
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "roles.name", Value: bson.M{"$ne": model.Name}},
+		{Key: "deletedDate", Value: nil},
+	}
+	update := bson.M{
+		"$push": bson.M{"roles": mongoModels.OrganisationRoleToMongo(model)},
+		"$set":  bson.M{"updatedDate": time.Now()},
+	}
+
+	result, err := col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error adding role to org: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := col.CountDocuments(ctx, bson.D{{Key: "_id", Value: id}, {Key: "deletedDate", Value: nil}})
+		if err != nil {
+			return fmt.Errorf("error counting orgs: %w", err)
+		}
+		if count == 0 {
+			return common.ErrOrgNotFound
+		}
+		return fmt.Errorf("%w: %s", common.ErrRoleExists, model.Name)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) AddOrganisationUser(ctx context.Context, orgID string, model *models.OrganisationUser) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(OrgsCollection)
+
+	// Only push the user if they're not already a member
+	filter := roleExistsFilter(bson.D{
+		{Key: "_id", Value: id},
+		{Key: "users.userId", Value: bson.M{"$ne": model.UserID}},
+		{Key: "deletedDate", Value: nil},
+	}, model.Role)
+	update := bson.M{
+		"$push": bson.M{"users": mongoModels.OrganisationUserToMongo(model)},
+		"$set":  bson.M{"updatedDate": time.Now()},
+	}
+
+	result, err := col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error adding user to org: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := col.CountDocuments(ctx, bson.D{{Key: "_id", Value: id}, {Key: "deletedDate", Value: nil}})
+		if err != nil {
+			return fmt.Errorf("error counting orgs: %w", err)
+		}
+		if count == 0 {
+			return common.ErrOrgNotFound
+		}
+		if missing, err := db.customRoleMissing(ctx, id, model.Role); err != nil {
+			return err
+		} else if missing {
+			return fmt.Errorf("%w: %s", common.ErrUnknownRole, model.Role)
+		}
+		return common.ErrDuplicateOrgUser
+	}
+
+	return nil
+}
+
 func (db *MongoDB) Check(ctx context.Context) error {
 	return db.activeConnection.client.Ping(ctx, nil)
 }
@@ -77,23 +198,46 @@ func (db *MongoDB) Connect(ctx context.Context) error {
 		return fmt.Errorf("error applying indices: %w", err)
 	}
 
+	if err := db.applyMigrations(ctx); err != nil {
+		return fmt.Errorf("error applying migrations: %w", err)
+	}
+
 	return nil
 }
 
-func (db *MongoDB) DeleteOrganisation(ctx context.Context, orgID, userID string) error {
-	id, err := bson.ObjectIDFromHex(orgID)
+func (db *MongoDB) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	filter := bson.D{
+		{Key: "codeHash", Value: codeHash},
+		{Key: "expiresAt", Value: bson.M{"$gt": time.Now()}},
+	}
+
+	var result mongoModels.AuthorizationCode
+	err := db.activeConnection.db.Collection(AuthorizationCodesCollection).FindOneAndDelete(ctx, filter).Decode(&result)
 	if err != nil {
-		return fmt.Errorf("error converting org id to bson object id: %w", err)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error consuming authorization code: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) DeleteAPIKey(ctx context.Context, orgID, keyID string) error {
+	id, err := bson.ObjectIDFromHex(keyID)
+	if err != nil {
+		return fmt.Errorf("error converting api key id to bson object id: %w", err)
 	}
 
 	filter := bson.D{
 		{Key: "_id", Value: id},
-		{Key: "users.userId", Value: userID},
+		{Key: "orgId", Value: orgID},
 	}
 
-	result, err := db.activeConnection.db.Collection(OrgsCollection).DeleteOne(ctx, filter)
+	result, err := db.activeConnection.db.Collection(APIKeysCollection).DeleteOne(ctx, filter)
 	if err != nil {
-		return fmt.Errorf("error deleting org: %w", err)
+		return fmt.Errorf("error deleting api key: %w", err)
 	}
 
 	if result.DeletedCount == 0 {
@@ -103,238 +247,1433 @@ func (db *MongoDB) DeleteOrganisation(ctx context.Context, orgID, userID string)
 	return nil
 }
 
-func (db *MongoDB) FindUserByProviderAndUserID(ctx context.Context, providerID, providerUserID string) (*models.User, error) {
+func (db *MongoDB) DeleteOrganisation(ctx context.Context, orgID, userID string, purgeAfter time.Time) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
 	filter := bson.D{
-		{
-			Key:   fmt.Sprintf("accounts.%s.providerUserId", providerID),
-			Value: providerUserID,
+		{Key: "_id", Value: id},
+		{Key: "users.userId", Value: userID},
+		{Key: "deletedDate", Value: nil},
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"deletedDate": now,
+			"purgeAfter":  purgeAfter,
+			"updatedDate": now,
 		},
 	}
 
-	var result mongoModels.User
-	err := db.activeConnection.db.Collection(UsersCollection).FindOne(ctx, filter).Decode(&result)
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateOne(ctx, filter, update)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
+		return fmt.Errorf("error deleting org: %w", err)
+	}
 
-		return nil, fmt.Errorf("error retrieving user by provider in mongodb: %w", err)
+	if result.MatchedCount == 0 {
+		return common.ErrNotDeleted
 	}
 
-	return result.ToModel(), nil
+	return nil
 }
 
-func (db *MongoDB) GetOrgByID(ctx context.Context, orgID, userID string) (*models.Organisation, error) {
-	id, err := bson.ObjectIDFromHex(orgID)
+func (db *MongoDB) DeletePersonalAccessToken(ctx context.Context, userID, tokenID string) error {
+	id, err := bson.ObjectIDFromHex(tokenID)
 	if err != nil {
-		return nil, fmt.Errorf("error converting org id to bson object id: %w", err)
+		return fmt.Errorf("error converting personal access token id to bson object id: %w", err)
 	}
 
 	filter := bson.D{
 		{Key: "_id", Value: id},
-		{Key: "users.userId", Value: userID},
+		{Key: "userId", Value: userID},
 	}
 
-	var result mongoModels.Organisation
-	err = db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result)
+	result, err := db.activeConnection.db.Collection(PersonalAccessTokensCollection).DeleteOne(ctx, filter)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
+		return fmt.Errorf("error deleting personal access token: %w", err)
+	}
 
-		return nil, fmt.Errorf("error getting org by id: %w", err)
+	if result.DeletedCount == 0 {
+		return common.ErrNotDeleted
 	}
 
-	return result.ToModel(), nil
+	return nil
 }
 
-func (db *MongoDB) GetOrgBySlug(ctx context.Context, slug string) (*models.Organisation, error) {
+func (db *MongoDB) DeletePersonalAccessTokensByUser(ctx context.Context, userID string) error {
 	filter := bson.D{
-		{Key: "slug", Value: slug},
+		{Key: "userId", Value: userID},
 	}
 
-	var result mongoModels.Organisation
-	if err := db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
-
-		return nil, fmt.Errorf("error getting org by slug: %w", err)
+	if _, err := db.activeConnection.db.Collection(PersonalAccessTokensCollection).DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("error deleting user's personal access tokens: %w", err)
 	}
 
-	return result.ToModel(), nil
+	return nil
 }
 
-func (db *MongoDB) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+func (db *MongoDB) DeleteServiceAccount(ctx context.Context, orgID, userID string) error {
 	id, err := bson.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, fmt.Errorf("error converting user id to bson object id: %w", err)
+		return fmt.Errorf("error converting user id to bson object id: %w", err)
 	}
 
 	filter := bson.D{
-		{
-			Key:   "_id",
-			Value: id,
-		},
+		{Key: "_id", Value: id},
+		{Key: "serviceAccount.orgId", Value: orgID},
 	}
 
-	var result mongoModels.User
-	err = db.activeConnection.db.Collection(UsersCollection).FindOne(ctx, filter).Decode(&result)
+	result, err := db.activeConnection.db.Collection(UsersCollection).DeleteOne(ctx, filter)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
+		return fmt.Errorf("error deleting service account: %w", err)
+	}
 
-		return nil, fmt.Errorf("error getting user by id: %w", err)
+	if result.DeletedCount == 0 {
+		return common.ErrNotDeleted
 	}
 
-	return result.ToModel(), nil
+	return nil
 }
 
-func (db *MongoDB) ListOrganisations(
-	ctx context.Context,
-	offset,
-	limit int,
-	userID string,
-) (*models.Pagination[*models.Organisation], error) {
-	col := db.activeConnection.db.Collection(OrgsCollection)
-	filter := bson.D{
-		{Key: "users.userId", Value: userID},
-	}
-	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset)).SetSort(bson.D{
-		{Key: "name", Value: 1},
-	})
-
-	totalDocs, err := col.CountDocuments(ctx, filter)
+func (db *MongoDB) DeleteTeam(ctx context.Context, orgID, teamID string) error {
+	id, err := bson.ObjectIDFromHex(orgID)
 	if err != nil {
-		return nil, fmt.Errorf("error counting organisations: %w", err)
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
 	}
 
-	cursor, err := col.Find(context.TODO(), filter, opts)
+	tID, err := bson.ObjectIDFromHex(teamID)
 	if err != nil {
-		return nil, fmt.Errorf("error finding organisations: %w", err)
+		return fmt.Errorf("error converting team id to bson object id: %w", err)
 	}
 
-	var mongodbOrgs []*mongoModels.Organisation
-	if err := cursor.All(ctx, &mongodbOrgs); err != nil {
-		return nil, fmt.Errorf("error getting all organisation records in cursor: %w", err)
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "teams._id", Value: tID},
+	}
+	update := bson.M{
+		"$pull": bson.M{"teams": bson.M{"_id": tID}},
+		"$set":  bson.M{"updatedDate": time.Now()},
 	}
 
-	orgs := make([]*models.Organisation, 0)
-	for _, o := range mongodbOrgs {
-		orgs = append(orgs, o.ToModel())
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error deleting team: %w", err)
 	}
 
-	totalPages := int(math.Ceil(float64(totalDocs) / float64(limit)))
-	page := int(math.Ceil(float64(offset-1)/float64(limit)) + 1)
-	if page < 0 {
-		page = 0
-	} else if page > totalPages {
-		page = totalPages
+	if result.MatchedCount == 0 {
+		return common.ErrNotDeleted
 	}
 
-	return &models.Pagination[*models.Organisation]{
-		Data:       orgs,
-		Count:      len(orgs),
-		Page:       page,
-		PerPage:    limit,
-		TotalPages: totalPages,
-		Total:      totalDocs,
-	}, nil
+	return nil
 }
 
-func (db *MongoDB) ListOrganisationUsers(
-	ctx context.Context,
-	offset,
-	limit int,
-	orgID,
-	userID string,
-) (*models.Pagination[*models.OrganisationUser], error) {
-	org, err := db.GetOrgByID(ctx, orgID, userID)
-	if err != nil {
-		return nil, fmt.Errorf("errot getting org by id: %w", err)
-	}
-	if org == nil {
-		return nil, nil
+func (db *MongoDB) FilterActiveUserIDs(ctx context.Context, userIDs []string) ([]string, error) {
+	ids := make([]bson.ObjectID, 0, len(userIDs))
+	for _, u := range userIDs {
+		id, err := bson.ObjectIDFromHex(u)
+		if err != nil {
+			return nil, fmt.Errorf("error converting user id to bson object id: %w", err)
+		}
+		ids = append(ids, id)
 	}
 
-	totalDocs := len(org.Users)
-	start := max(offset, 0)
-	end := min(offset+limit, totalDocs)
-
-	// Prune the org's users
-	org.Users = org.Users[start:end]
-
-	totalPages := int(math.Ceil(float64(totalDocs) / float64(limit)))
-	page := int(math.Ceil(float64(offset-1)/float64(limit)) + 1)
-	if page < 0 {
-		page = 0
-	} else if page > totalPages {
-		page = totalPages
+	filter := bson.D{
+		{Key: "_id", Value: bson.M{"$in": ids}},
+		{Key: "isActive", Value: true},
 	}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
 
-	userIDs, err := mongoModels.PaginateUniqueUsers(org)
+	cursor, err := db.activeConnection.db.Collection(UsersCollection).Find(ctx, filter, opts)
 	if err != nil {
-		return nil, fmt.Errorf("error extracting unique users from org %s: %w", org.ID, err)
+		return nil, fmt.Errorf("error finding active users: %w", err)
 	}
 
-	if len(userIDs) > 0 {
-		users, err := db.findMultipleUsers(ctx, userIDs)
-		if err != nil {
-			return nil, err
-		}
+	var users []struct {
+		ID bson.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error getting active users from cursor: %w", err)
+	}
 
-		for key, value := range org.Users {
-			org.Users[key].Name = users[value.UserID].Name
-		}
+	active := make([]string, 0, len(users))
+	for _, u := range users {
+		active = append(active, u.ID.Hex())
 	}
 
-	return &models.Pagination[*models.OrganisationUser]{
-		Data:       org.Users,
-		Count:      len(org.Users),
-		Page:       page,
-		PerPage:    limit,
-		TotalPages: totalPages,
-		Total:      int64(totalDocs),
-	}, nil
+	return active, nil
 }
 
-func (db *MongoDB) SaveOrganisationRecord(ctx context.Context, model *models.Organisation) (*models.Organisation, error) {
-	mongoModel, err := mongoModels.OrganisationToMongo(model)
-	if err != nil {
-		return nil, fmt.Errorf("error converting before saving org record: %w", err)
+func (db *MongoDB) FindUserByProviderAndUserID(ctx context.Context, providerID, providerUserID string) (*models.User, error) {
+	filter := bson.D{
+		{
+			Key:   fmt.Sprintf("accounts.%s.providerUserId", providerID),
+			Value: providerUserID,
+		},
 	}
 
-	col := db.activeConnection.db.Collection(OrgsCollection)
-
-	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+	var result mongoModels.User
+	err := db.activeConnection.db.Collection(UsersCollection).FindOne(ctx, filter).Decode(&result)
 	if err != nil {
-		return nil, err
-	}
-
-	mongoModel.ID = recordID
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
 
-	fmt.Printf("%+v\n", mongoModel)
+		return nil, fmt.Errorf("error retrieving user by provider in mongodb: %w", err)
+	}
 
-	return mongoModel.ToModel(), nil
+	return result.ToModel(), nil
 }
 
-func (db *MongoDB) SaveUserRecord(ctx context.Context, model *models.User) (*models.User, error) {
-	mongoModel, err := mongoModels.UserToMongo(model)
+func (db *MongoDB) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	filter := bson.D{
+		{Key: "keyHash", Value: keyHash},
+	}
+
+	var result mongoModels.APIKey
+	err := db.activeConnection.db.Collection(APIKeysCollection).FindOne(ctx, filter).Decode(&result)
 	if err != nil {
-		return nil, fmt.Errorf("error converting before saving user record: %w", err)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting api key by hash: %w", err)
 	}
 
-	col := db.activeConnection.db.Collection(UsersCollection)
+	return result.ToModel(), nil
+}
 
-	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+func (db *MongoDB) GetDeletedOrgByID(ctx context.Context, orgID, userID string) (*models.Organisation, error) {
+	id, err := bson.ObjectIDFromHex(orgID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error converting org id to bson object id: %w", err)
 	}
 
-	mongoModel.ID = recordID
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "users.userId", Value: userID},
+		{Key: "deletedDate", Value: bson.M{"$ne": nil}},
+		{Key: "purgeAfter", Value: bson.M{"$gt": time.Now()}},
+	}
 
-	return mongoModel.ToModel(), nil
+	var result mongoModels.Organisation
+	err = db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting deleted org by id: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetInvitationByID(ctx context.Context, invitationID string) (*models.Invitation, error) {
+	id, err := bson.ObjectIDFromHex(invitationID)
+	if err != nil {
+		// Not a valid ID, so can't exist
+		return nil, nil
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+	}
+
+	var result mongoModels.Invitation
+	err = db.activeConnection.db.Collection(InvitationsCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting invitation by id: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetPendingInvitationByEmail(ctx context.Context, orgID, emailAddress string) (*models.Invitation, error) {
+	filter := bson.D{
+		{Key: "orgId", Value: orgID},
+		{Key: "emailAddress", Value: emailAddress},
+		{Key: "status", Value: models.InvitationStatusPending},
+		{Key: "expiresAt", Value: bson.M{"$gt": time.Now()}},
+	}
+
+	var result mongoModels.Invitation
+	err := db.activeConnection.db.Collection(InvitationsCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting invitation by email: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetOrgByID(ctx context.Context, orgID, userID string) (*models.Organisation, error) {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "users.userId", Value: userID},
+		{Key: "deletedDate", Value: nil},
+	}
+
+	var result mongoModels.Organisation
+	err = db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting org by id: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetOrgByIDUnscoped(ctx context.Context, orgID string) (*models.Organisation, error) {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "deletedDate", Value: nil},
+	}
+
+	var result mongoModels.Organisation
+	err = db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting org by id: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetOrgBySlug(ctx context.Context, slug string) (*models.Organisation, error) {
+	filter := bson.D{
+		{Key: "slug", Value: slug},
+	}
+
+	var result mongoModels.Organisation
+	if err := db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting org by slug: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	filter := bson.D{
+		{Key: "tokenHash", Value: tokenHash},
+	}
+
+	var result mongoModels.PersonalAccessToken
+	err := db.activeConnection.db.Collection(PersonalAccessTokensCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting personal access token by hash: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetServiceAccountByClientID(ctx context.Context, clientID string) (*models.User, error) {
+	filter := bson.D{
+		{Key: "serviceAccount.clientId", Value: clientID},
+	}
+
+	var result mongoModels.User
+	err := db.activeConnection.db.Collection(UsersCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting service account by client id: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetUserByEmailAddress(ctx context.Context, emailAddress string) (*models.User, error) {
+	filter := bson.D{
+		{Key: "emailAddress", Value: emailAddress},
+	}
+
+	var result mongoModels.User
+	err := db.activeConnection.db.Collection(UsersCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting user by email address: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	id, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error converting user id to bson object id: %w", err)
+	}
+
+	filter := bson.D{
+		{
+			Key:   "_id",
+			Value: id,
+		},
+	}
+
+	var result mongoModels.User
+	err = db.activeConnection.db.Collection(UsersCollection).FindOne(ctx, filter).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting user by id: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) ListAPIKeys(
+	ctx context.Context,
+	offset,
+	limit int,
+	orgID string,
+) (*models.Pagination[*models.APIKey], error) {
+	col := db.activeConnection.db.Collection(APIKeysCollection)
+	filter := bson.D{
+		{Key: "orgId", Value: orgID},
+	}
+	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset)).SetSort(bson.D{
+		{Key: "createdDate", Value: -1},
+	})
+
+	totalDocs, err := col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error counting api keys: %w", err)
+	}
+
+	cursor, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding api keys: %w", err)
+	}
+
+	var mongodbKeys []*mongoModels.APIKey
+	if err := cursor.All(ctx, &mongodbKeys); err != nil {
+		return nil, fmt.Errorf("error getting all api key records in cursor: %w", err)
+	}
+
+	keys := make([]*models.APIKey, 0)
+	for _, k := range mongodbKeys {
+		keys = append(keys, k.ToModel())
+	}
+
+	return newPagination(keys, offset, limit, totalDocs), nil
+}
+
+func (db *MongoDB) ListAuditEvents(ctx context.Context, userID string) ([]*models.AuditEvent, error) {
+	filter := bson.D{
+		{Key: "userId", Value: userID},
+	}
+	opts := options.Find().SetSort(bson.D{
+		{Key: "createdDate", Value: 1},
+	})
+
+	cursor, err := db.activeConnection.db.Collection(AuditEventsCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding audit events: %w", err)
+	}
+
+	var mongodbEvents []*mongoModels.AuditEvent
+	if err := cursor.All(ctx, &mongodbEvents); err != nil {
+		return nil, fmt.Errorf("error getting all audit event records in cursor: %w", err)
+	}
+
+	events := make([]*models.AuditEvent, 0)
+	for _, e := range mongodbEvents {
+		events = append(events, e.ToModel())
+	}
+
+	return events, nil
+}
+
+func (db *MongoDB) ListInvitations(
+	ctx context.Context,
+	offset,
+	limit int,
+	orgID string,
+) (*models.Pagination[*models.Invitation], error) {
+	col := db.activeConnection.db.Collection(InvitationsCollection)
+	filter := bson.D{
+		{Key: "orgId", Value: orgID},
+		{Key: "status", Value: models.InvitationStatusPending},
+		{Key: "expiresAt", Value: bson.M{"$gt": time.Now()}},
+	}
+	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset)).SetSort(bson.D{
+		{Key: "createdDate", Value: -1},
+	})
+
+	totalDocs, err := col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error counting invitations: %w", err)
+	}
+
+	cursor, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding invitations: %w", err)
+	}
+
+	var mongodbInvitations []*mongoModels.Invitation
+	if err := cursor.All(ctx, &mongodbInvitations); err != nil {
+		return nil, fmt.Errorf("error getting all invitation records in cursor: %w", err)
+	}
+
+	invitations := make([]*models.Invitation, 0)
+	for _, i := range mongodbInvitations {
+		invitations = append(invitations, i.ToModel())
+	}
+
+	return newPagination(invitations, offset, limit, totalDocs), nil
+}
+
+func (db *MongoDB) ListOrganisations(
+	ctx context.Context,
+	offset,
+	limit int,
+	userID string,
+) (*models.Pagination[*models.Organisation], error) {
+	col := db.activeConnection.db.Collection(OrgsCollection)
+	filter := bson.D{
+		{Key: "users.userId", Value: userID},
+		{Key: "deletedDate", Value: nil},
+	}
+	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset)).SetSort(bson.D{
+		{Key: "name", Value: 1},
+	})
+
+	totalDocs, err := col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error counting organisations: %w", err)
+	}
+
+	cursor, err := col.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding organisations: %w", err)
+	}
+
+	var mongodbOrgs []*mongoModels.Organisation
+	if err := cursor.All(ctx, &mongodbOrgs); err != nil {
+		return nil, fmt.Errorf("error getting all organisation records in cursor: %w", err)
+	}
+
+	orgs := make([]*models.Organisation, 0)
+	for _, o := range mongodbOrgs {
+		orgs = append(orgs, o.ToModel())
+	}
+
+	return newPagination(orgs, offset, limit, totalDocs), nil
+}
+
+func (db *MongoDB) ListOrganisationUsers(
+	ctx context.Context,
+	offset,
+	limit int,
+	orgID,
+	userID string,
+) (*models.Pagination[*models.OrganisationUser], error) {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	// Deactivated users are hidden from the members, so they're filtered out
+	// before paginating
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "_id", Value: id},
+			{Key: "users.userId", Value: userID},
+			{Key: "deletedDate", Value: nil},
+		}}},
+		{{Key: "$unwind", Value: "$users"}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$users"}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": UsersCollection,
+			"let":  bson.M{"userId": bson.M{"$toObjectId": "$userId"}},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$userId"}}, "isActive": true}},
+				bson.M{"$project": bson.M{"name": 1}},
+			},
+			"as": "user",
+		}}},
+		{{Key: "$unwind", Value: "$user"}},
+		{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "count"}},
+			"members": bson.A{
+				bson.M{"$skip": max(offset, 0)},
+				bson.M{"$limit": limit},
+			},
+		}}},
+	}
+
+	cursor, err := db.activeConnection.db.Collection(OrgsCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error listing organisation users: %w", err)
+	}
+
+	var results []struct {
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		Members []struct {
+			mongoModels.OrganisationUser `bson:",inline"`
+			User                         struct {
+				Name string `bson:"name"`
+			} `bson:"user"`
+		} `bson:"members"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("error getting organisation users from cursor: %w", err)
+	}
+
+	var totalDocs int64
+	members := make([]*models.OrganisationUser, 0)
+	if len(results) > 0 {
+		if len(results[0].Total) > 0 {
+			totalDocs = results[0].Total[0].Count
+		}
+		for _, m := range results[0].Members {
+			member := m.ToModel()
+			member.Name = m.User.Name
+			members = append(members, member)
+		}
+	}
+
+	if totalDocs == 0 {
+		// The requesting user is always an active member, so the organisation wasn't found
+		return nil, nil
+	}
+
+	return newPagination(members, offset, limit, totalDocs), nil
+}
+
+func (db *MongoDB) ListPersonalAccessTokens(
+	ctx context.Context,
+	offset,
+	limit int,
+	userID string,
+) (*models.Pagination[*models.PersonalAccessToken], error) {
+	col := db.activeConnection.db.Collection(PersonalAccessTokensCollection)
+	filter := bson.D{
+		{Key: "userId", Value: userID},
+	}
+	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset)).SetSort(bson.D{
+		{Key: "createdDate", Value: -1},
+	})
+
+	totalDocs, err := col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error counting personal access tokens: %w", err)
+	}
+
+	cursor, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding personal access tokens: %w", err)
+	}
+
+	var mongodbTokens []*mongoModels.PersonalAccessToken
+	if err := cursor.All(ctx, &mongodbTokens); err != nil {
+		return nil, fmt.Errorf("error getting all personal access token records in cursor: %w", err)
+	}
+
+	tokens := make([]*models.PersonalAccessToken, 0)
+	for _, t := range mongodbTokens {
+		tokens = append(tokens, t.ToModel())
+	}
+
+	return newPagination(tokens, offset, limit, totalDocs), nil
+}
+
+func (db *MongoDB) ListServiceAccounts(
+	ctx context.Context,
+	offset,
+	limit int,
+	orgID string,
+) (*models.Pagination[*models.User], error) {
+	col := db.activeConnection.db.Collection(UsersCollection)
+	filter := bson.D{
+		{Key: "serviceAccount.orgId", Value: orgID},
+	}
+	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset)).SetSort(bson.D{
+		{Key: "createdDate", Value: -1},
+	})
+
+	totalDocs, err := col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error counting service accounts: %w", err)
+	}
+
+	cursor, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding service accounts: %w", err)
+	}
+
+	var mongodbUsers []*mongoModels.User
+	if err := cursor.All(ctx, &mongodbUsers); err != nil {
+		return nil, fmt.Errorf("error getting all service account records in cursor: %w", err)
+	}
+
+	users := make([]*models.User, 0)
+	for _, u := range mongodbUsers {
+		users = append(users, u.ToModel())
+	}
+
+	return newPagination(users, offset, limit, totalDocs), nil
+}
+
+func (db *MongoDB) ListUsersByEmailAddress(ctx context.Context, emailAddress string) ([]*models.User, error) {
+	filter := bson.D{
+		{Key: "emailAddress", Value: emailAddress},
+	}
+	opts := options.Find().SetCollation(&options.Collation{
+		Locale:   "en",
+		Strength: 2, // Case-insensitive
+	})
+
+	cursor, err := db.activeConnection.db.Collection(UsersCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding users by email address: %w", err)
+	}
+
+	var mongodbUsers []*mongoModels.User
+	if err := cursor.All(ctx, &mongodbUsers); err != nil {
+		return nil, fmt.Errorf("error getting all user records in cursor: %w", err)
+	}
+
+	users := make([]*models.User, 0)
+	for _, u := range mongodbUsers {
+		users = append(users, u.ToModel())
+	}
+
+	return users, nil
+}
+
+func (db *MongoDB) ListUsersWithExpiringTokens(ctx context.Context, providerID string, before time.Time) ([]*models.User, error) {
+	filter := bson.D{
+		{Key: "isActive", Value: true},
+		{Key: fmt.Sprintf("accounts.%s.tokensExpireAt", providerID), Value: bson.M{"$lte": before}},
+	}
+
+	cursor, err := db.activeConnection.db.Collection(UsersCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error finding users with expiring tokens: %w", err)
+	}
+
+	var mongodbUsers []*mongoModels.User
+	if err := cursor.All(ctx, &mongodbUsers); err != nil {
+		return nil, fmt.Errorf("error getting all user records in cursor: %w", err)
+	}
+
+	users := make([]*models.User, 0)
+	for _, u := range mongodbUsers {
+		users = append(users, u.ToModel())
+	}
+
+	return users, nil
+}
+
+func (db *MongoDB) MergeOrganisationUser(
+	ctx context.Context,
+	orgID,
+	sourceID string,
+	target *models.OrganisationUser,
+	teamUsers map[string]*models.TeamUser,
+) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(OrgsCollection)
+	now := time.Now()
+
+	// Change the target's role if they're a member, otherwise add them
+	result, err := col.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "users.userId", Value: target.UserID},
+	}, bson.M{
+		"$set": bson.M{
+			"users.$[member].role":        target.Role,
+			"users.$[member].updatedDate": target.UpdatedDate,
+			"updatedDate":                 now,
+		},
+	}, options.UpdateOne().SetArrayFilters([]any{
+		bson.M{"member.userId": target.UserID},
+	}))
+	if err != nil {
+		return fmt.Errorf("error updating merged org user: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		if _, err := col.UpdateOne(ctx, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "users.userId", Value: bson.M{"$ne": target.UserID}},
+		}, bson.M{
+			"$push": bson.M{"users": mongoModels.OrganisationUserToMongo(target)},
+			"$set":  bson.M{"updatedDate": now},
+		}); err != nil {
+			return fmt.Errorf("error adding merged org user: %w", err)
+		}
+	}
+
+	// The target is now a member, so can take over as owner
+	if _, err := col.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "ownerId", Value: sourceID},
+	}, bson.M{
+		"$set": bson.M{
+			"ownerId":     target.UserID,
+			"updatedDate": now,
+		},
+	}); err != nil {
+		return fmt.Errorf("error updating merged org owner: %w", err)
+	}
+
+	for teamID, teamUser := range teamUsers {
+		if err := db.SaveTeamUser(ctx, orgID, teamID, teamUser); err != nil && !errors.Is(err, common.ErrTeamNotFound) {
+			return err
+		}
+	}
+
+	// Only remove the source once the target has everything
+	if _, err := col.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+	}, bson.M{
+		"$pull": bson.M{
+			"users":           bson.M{"userId": sourceID},
+			"teams.$[].users": bson.M{"userId": sourceID},
+		},
+		"$set": bson.M{"updatedDate": now},
+	}); err != nil {
+		return fmt.Errorf("error removing merged org user: %w", err)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) PurgeOrganisations(ctx context.Context, before time.Time) (int64, error) {
+	col := db.activeConnection.db.Collection(OrgsCollection)
+	filter := bson.D{
+		{Key: "deletedDate", Value: bson.M{"$ne": nil}},
+		{Key: "purgeAfter", Value: bson.M{"$lte": before}},
+	}
+
+	cursor, err := col.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("error finding orgs to purge: %w", err)
+	}
+
+	var orgs []*mongoModels.Organisation
+	if err := cursor.All(ctx, &orgs); err != nil {
+		return 0, fmt.Errorf("error getting orgs to purge from cursor: %w", err)
+	}
+
+	if len(orgs) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]bson.ObjectID, 0, len(orgs))
+	hexIDs := make([]string, 0, len(orgs))
+	for _, o := range orgs {
+		ids = append(ids, o.ID)
+		hexIDs = append(hexIDs, o.ID.Hex())
+	}
+
+	// Only delete those found in case any were restored in the meantime
+	result, err := col.DeleteMany(ctx, append(filter, bson.E{Key: "_id", Value: bson.M{"$in": ids}}))
+	if err != nil {
+		return 0, fmt.Errorf("error purging orgs: %w", err)
+	}
+
+	// Remove everything that belongs to the organisations
+	for _, collection := range []string{APIKeysCollection, InvitationsCollection} {
+		if _, err := db.activeConnection.db.Collection(collection).DeleteMany(ctx, bson.D{
+			{Key: "orgId", Value: bson.M{"$in": hexIDs}},
+		}); err != nil {
+			return 0, fmt.Errorf("error purging org records from %s: %w", collection, err)
+		}
+	}
+
+	if _, err := db.activeConnection.db.Collection(UsersCollection).DeleteMany(ctx, bson.D{
+		{Key: "serviceAccount.orgId", Value: bson.M{"$in": hexIDs}},
+	}); err != nil {
+		return 0, fmt.Errorf("error purging org service accounts: %w", err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (db *MongoDB) PurgeUsers(ctx context.Context, before time.Time) (int64, error) {
+	col := db.activeConnection.db.Collection(UsersCollection)
+	filter := bson.D{
+		{Key: "deletedDate", Value: bson.M{"$ne": nil}},
+		{Key: "purgeAfter", Value: bson.M{"$lte": before}},
+	}
+
+	cursor, err := col.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("error finding users to purge: %w", err)
+	}
+
+	var users []*mongoModels.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return 0, fmt.Errorf("error getting users to purge from cursor: %w", err)
+	}
+
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]bson.ObjectID, 0, len(users))
+	hexIDs := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+		hexIDs = append(hexIDs, u.ID.Hex())
+	}
+
+	// Only delete those found in case any were restored in the meantime
+	result, err := col.DeleteMany(ctx, append(filter, bson.E{Key: "_id", Value: bson.M{"$in": ids}}))
+	if err != nil {
+		return 0, fmt.Errorf("error purging users: %w", err)
+	}
+
+	// Remove everything that belongs to the users
+	for _, collection := range []string{AuditEventsCollection, PersonalAccessTokensCollection} {
+		if _, err := db.activeConnection.db.Collection(collection).DeleteMany(ctx, bson.D{
+			{Key: "userId", Value: bson.M{"$in": hexIDs}},
+		}); err != nil {
+			return 0, fmt.Errorf("error purging user records from %s: %w", collection, err)
+		}
+	}
+
+	// Deleted organisations may still list the users
+	orgs := db.activeConnection.db.Collection(OrgsCollection)
+	if _, err := orgs.UpdateMany(ctx, bson.D{
+		{Key: "users.userId", Value: bson.M{"$in": hexIDs}},
+	}, bson.M{
+		"$pull": bson.M{"users": bson.M{"userId": bson.M{"$in": hexIDs}}},
+	}); err != nil {
+		return 0, fmt.Errorf("error purging users from orgs: %w", err)
+	}
+	if _, err := orgs.UpdateMany(ctx, bson.D{
+		{Key: "teams.users.userId", Value: bson.M{"$in": hexIDs}},
+	}, bson.M{
+		"$pull": bson.M{"teams.$[].users": bson.M{"userId": bson.M{"$in": hexIDs}}},
+	}); err != nil {
+		return 0, fmt.Errorf("error purging users from org teams: %w", err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (db *MongoDB) ReassignUserRecords(ctx context.Context, fromUserID, toUserID string) error {
+	updates := []struct {
+		collection string
+		key        string
+	}{
+		{collection: APIKeysCollection, key: "createdBy"},
+		{collection: AuditEventsCollection, key: "userId"},
+		{collection: PersonalAccessTokensCollection, key: "userId"},
+		{collection: UsersCollection, key: "serviceAccount.createdBy"},
+	}
+
+	for _, u := range updates {
+		if _, err := db.activeConnection.db.Collection(u.collection).UpdateMany(ctx, bson.D{
+			{Key: u.key, Value: fromUserID},
+		}, bson.M{
+			"$set": bson.M{u.key: toUserID},
+		}); err != nil {
+			return fmt.Errorf("error reassigning user records in %s: %w", u.collection, err)
+		}
+	}
+
+	return nil
+}
+
+func (db *MongoDB) RemoveOrganisationRole(ctx context.Context, orgID, name string) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(OrgsCollection)
+
+	// Only remove the role if no member has it, even if one was given it since it was checked
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "roles.name", Value: name},
+		{Key: "users.role", Value: bson.M{"$ne": name}},
+	}
+	update := bson.M{
+		"$pull": bson.M{"roles": bson.M{"name": name}},
+		"$set":  bson.M{"updatedDate": time.Now()},
+	}
+
+	result, err := col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error removing role from org: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := col.CountDocuments(ctx, bson.D{{Key: "_id", Value: id}, {Key: "roles.name", Value: name}})
+		if err != nil {
+			return fmt.Errorf("error counting org roles: %w", err)
+		}
+		if count == 0 {
+			return common.ErrNotDeleted
+		}
+		return fmt.Errorf("%w: %s", common.ErrRoleInUse, name)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) RemoveOrganisationUser(ctx context.Context, orgID, userID string) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "users.userId", Value: userID},
+		{Key: "ownerId", Value: bson.M{"$ne": userID}},
+		keepOwnerFilter(userID),
+	}
+	update := bson.M{
+		"$pull": bson.M{"users": bson.M{"userId": userID}},
+		"$set":  bson.M{"updatedDate": time.Now()},
+	}
+
+	col := db.activeConnection.db.Collection(OrgsCollection)
+
+	result, err := col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error removing user from org: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return db.organisationUserUpdateError(ctx, id, userID)
+	}
+
+	// Team members must be organisation members
+	if _, err := col.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "teams.users.userId", Value: userID},
+	}, bson.M{
+		"$pull": bson.M{"teams.$[].users": bson.M{"userId": userID}},
+	}); err != nil {
+		return fmt.Errorf("error removing user from org teams: %w", err)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) RemoveTeamUser(ctx context.Context, orgID, teamID, userID string) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	tID, err := bson.ObjectIDFromHex(teamID)
+	if err != nil {
+		return fmt.Errorf("error converting team id to bson object id: %w", err)
+	}
+
+	now := time.Now()
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "deletedDate", Value: nil},
+		{Key: "teams._id", Value: tID},
+	}
+	update := bson.M{
+		"$pull": bson.M{"teams.$[team].users": bson.M{"userId": userID}},
+		"$set": bson.M{
+			"teams.$[team].updatedDate": now,
+			"updatedDate":               now,
+		},
+	}
+	opts := options.UpdateOne().SetArrayFilters([]any{
+		bson.M{"team._id": tID},
+	})
+
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return fmt.Errorf("error removing team user: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return common.ErrTeamNotFound
+	}
+
+	return nil
+}
+
+func (db *MongoDB) RestoreOrganisation(ctx context.Context, orgID string) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "deletedDate", Value: bson.M{"$ne": nil}},
+		{Key: "purgeAfter", Value: bson.M{"$gt": time.Now()}},
+	}
+	update := bson.M{
+		"$set":   bson.M{"updatedDate": time.Now()},
+		"$unset": bson.M{"deletedDate": "", "purgeAfter": ""},
+	}
+
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error restoring org: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return common.ErrOrgNotFound
+	}
+
+	return nil
+}
+
+func (db *MongoDB) RevokeUserTokens(ctx context.Context, userID string, validAfter time.Time, providerIDs []string) error {
+	id, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("error converting user id to bson object id: %w", err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"tokensValidAfter": validAfter,
+			"updatedDate":      time.Now(),
+		},
+	}
+	if len(providerIDs) > 0 {
+		unset := bson.M{}
+		for _, providerID := range providerIDs {
+			unset[fmt.Sprintf("accounts.%s.tokens", providerID)] = ""
+			unset[fmt.Sprintf("accounts.%s.tokensExpireAt", providerID)] = ""
+		}
+		update["$unset"] = unset
+	}
+
+	result, err := db.activeConnection.db.Collection(UsersCollection).UpdateByID(ctx, id, update)
+	if err != nil {
+		return fmt.Errorf("error revoking user tokens: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", common.ErrUnknownUser, userID)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) SaveAPIKey(ctx context.Context, model *models.APIKey) (*models.APIKey, error) {
+	mongoModel, err := mongoModels.APIKeyToMongo(model)
+	if err != nil {
+		return nil, fmt.Errorf("error converting before saving api key: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(APIKeysCollection)
+
+	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoModel.ID = recordID
+
+	return mongoModel.ToModel(), nil
+}
+
+func (db *MongoDB) SaveAuditEvent(ctx context.Context, model *models.AuditEvent) (*models.AuditEvent, error) {
+	mongoModel, err := mongoModels.AuditEventToMongo(model)
+	if err != nil {
+		return nil, fmt.Errorf("error converting before saving audit event: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(AuditEventsCollection)
+
+	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoModel.ID = recordID
+
+	return mongoModel.ToModel(), nil
+}
+
+func (db *MongoDB) SaveAuthorizationCode(ctx context.Context, model *models.AuthorizationCode) (*models.AuthorizationCode, error) {
+	mongoModel, err := mongoModels.AuthorizationCodeToMongo(model)
+	if err != nil {
+		return nil, fmt.Errorf("error converting before saving authorization code: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(AuthorizationCodesCollection)
+
+	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoModel.ID = recordID
+
+	return mongoModel.ToModel(), nil
+}
+
+func (db *MongoDB) SaveInvitation(ctx context.Context, model *models.Invitation) (*models.Invitation, error) {
+	mongoModel, err := mongoModels.InvitationToMongo(model)
+	if err != nil {
+		return nil, fmt.Errorf("error converting before saving invitation: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(InvitationsCollection)
+
+	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoModel.ID = recordID
+
+	return mongoModel.ToModel(), nil
+}
+
+func (db *MongoDB) SaveOrganisationRecord(ctx context.Context, model *models.Organisation) (*models.Organisation, error) {
+	mongoModel, err := mongoModels.OrganisationToMongo(model)
+	if err != nil {
+		return nil, fmt.Errorf("error converting before saving org record: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(OrgsCollection)
+
+	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoModel.ID = recordID
+
+	return mongoModel.ToModel(), nil
+}
+
+func (db *MongoDB) SavePersonalAccessToken(ctx context.Context, model *models.PersonalAccessToken) (*models.PersonalAccessToken, error) {
+	mongoModel, err := mongoModels.PersonalAccessTokenToMongo(model)
+	if err != nil {
+		return nil, fmt.Errorf("error converting before saving personal access token: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(PersonalAccessTokensCollection)
+
+	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoModel.ID = recordID
+
+	return mongoModel.ToModel(), nil
+}
+
+func (db *MongoDB) SaveTeam(ctx context.Context, orgID string, model *models.Team) (*models.Team, error) {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	team, err := mongoModels.TeamToMongo(model)
+	if err != nil {
+		return nil, fmt.Errorf("error converting before saving team: %w", err)
+	}
+
+	// The slug must not be used by another team
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "deletedDate", Value: nil},
+		{Key: "teams", Value: bson.M{
+			"$not": bson.M{
+				"$elemMatch": bson.M{
+					"_id":  bson.M{"$ne": team.ID},
+					"slug": team.Slug,
+				},
+			},
+		}},
+	}
+
+	var update bson.M
+	opts := options.UpdateOne()
+	if model.ID == "" {
+		update = bson.M{
+			"$push": bson.M{"teams": team},
+			"$set":  bson.M{"updatedDate": time.Now()},
+		}
+	} else {
+		// Members are left alone so concurrent membership changes aren't lost
+		filter = append(filter, bson.E{Key: "teams._id", Value: team.ID})
+		update = bson.M{
+			"$set": bson.M{
+				"teams.$[team].name":        team.Name,
+				"teams.$[team].slug":        team.Slug,
+				"teams.$[team].description": team.Description,
+				"teams.$[team].updatedDate": team.UpdatedDate,
+				"updatedDate":               time.Now(),
+			},
+		}
+		opts.SetArrayFilters([]any{
+			bson.M{"team._id": team.ID},
+		})
+	}
+
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error saving team: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, db.teamUpdateError(ctx, id, team)
+	}
+
+	return team.ToModel(), nil
+}
+
+func (db *MongoDB) SaveTeamUser(ctx context.Context, orgID, teamID string, model *models.TeamUser) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	tID, err := bson.ObjectIDFromHex(teamID)
+	if err != nil {
+		return fmt.Errorf("error converting team id to bson object id: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(OrgsCollection)
+	now := time.Now()
+
+	// Change the role if they're already in the team
+	result, err := col.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "deletedDate", Value: nil},
+		{Key: "users.userId", Value: model.UserID},
+		{Key: "teams", Value: bson.M{"$elemMatch": bson.M{"_id": tID, "users.userId": model.UserID}}},
+	}, bson.M{
+		"$set": bson.M{
+			"teams.$[team].users.$[user].role":        model.Role,
+			"teams.$[team].users.$[user].updatedDate": model.UpdatedDate,
+			"teams.$[team].updatedDate":               now,
+			"updatedDate":                             now,
+		},
+	}, options.UpdateOne().SetArrayFilters([]any{
+		bson.M{"team._id": tID},
+		bson.M{"user.userId": model.UserID},
+	}))
+	if err != nil {
+		return fmt.Errorf("error updating team user: %w", err)
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// Otherwise, add them - they must be a member of the organisation
+	result, err = col.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "deletedDate", Value: nil},
+		{Key: "users.userId", Value: model.UserID},
+		{Key: "teams", Value: bson.M{"$elemMatch": bson.M{"_id": tID, "users.userId": bson.M{"$ne": model.UserID}}}},
+	}, bson.M{
+		"$push": bson.M{"teams.$[team].users": &mongoModels.TeamUser{
+			UserID:      model.UserID,
+			Role:        model.Role,
+			CreatedDate: model.CreatedDate,
+			UpdatedDate: model.UpdatedDate,
+		}},
+		"$set": bson.M{
+			"teams.$[team].updatedDate": now,
+			"updatedDate":               now,
+		},
+	}, options.UpdateOne().SetArrayFilters([]any{
+		bson.M{"team._id": tID},
+	}))
+	if err != nil {
+		return fmt.Errorf("error adding team user: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return db.teamUserUpdateError(ctx, id, tID, model.UserID)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) SaveUserRecord(ctx context.Context, model *models.User) (*models.User, error) {
+	mongoModel, err := mongoModels.UserToMongo(model)
+	if err != nil {
+		return nil, fmt.Errorf("error converting before saving user record: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(UsersCollection)
+
+	recordID, err := saveGenericRecord(ctx, col, mongoModel.ID, mongoModel)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoModel.ID = recordID
+
+	return mongoModel.ToModel(), nil
+}
+
+func (db *MongoDB) UpdateAPIKeyLastUsed(ctx context.Context, keyID string, lastUsed time.Time) error {
+	id, err := bson.ObjectIDFromHex(keyID)
+	if err != nil {
+		return fmt.Errorf("error converting api key id to bson object id: %w", err)
+	}
+
+	if _, err := db.activeConnection.db.Collection(APIKeysCollection).UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"lastUsedDate": lastUsed},
+	}); err != nil {
+		return fmt.Errorf("error updating api key last used: %w", err)
+	}
+
+	return nil
 }
 
 func (db *MongoDB) UpdateAllUsers(
@@ -389,8 +1728,311 @@ func (db *MongoDB) UpdateAllUsers(
 	return result.ModifiedCount, nil
 }
 
+func (db *MongoDB) UpdateInvitationStatus(
+	ctx context.Context,
+	invitationID string,
+	status models.InvitationStatus,
+	userID string,
+) (*models.Invitation, error) {
+	id, err := bson.ObjectIDFromHex(invitationID)
+	if err != nil {
+		return nil, fmt.Errorf("error converting invitation id to bson object id: %w", err)
+	}
+
+	// Only pending invitations can change - this stops an invitation being both accepted and revoked
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "status", Value: models.InvitationStatusPending},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"respondedBy": userID,
+			"status":      status,
+			"updatedDate": time.Now(),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result mongoModels.Invitation
+	err = db.activeConnection.db.Collection(InvitationsCollection).FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error updating invitation status: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) UpdateOrganisation(ctx context.Context, model *models.Organisation, replaceUsers bool) (*models.Organisation, error) {
+	id, err := bson.ObjectIDFromHex(model.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	col := db.activeConnection.db.Collection(OrgsCollection)
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "deletedDate", Value: nil},
+	}
+	set := bson.M{
+		"name":        model.Name,
+		"slug":        model.Slug,
+		"updatedDate": time.Now(),
+	}
+
+	if replaceUsers {
+		mongoModel, err := mongoModels.OrganisationToMongo(model)
+		if err != nil {
+			return nil, fmt.Errorf("error converting before updating org: %w", err)
+		}
+
+		// Every change to the organisation moves the updated date, so this
+		// stops the replacement reverting a concurrent change
+		filter = append(filter, bson.E{Key: "updatedDate", Value: model.UpdatedDate})
+		set["users"] = mongoModel.Users
+		set["teams"] = mongoModel.Teams
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result mongoModels.Organisation
+	if err := col.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&result); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("error updating org: %w", err)
+		}
+		if !replaceUsers {
+			return nil, nil
+		}
+
+		count, err := col.CountDocuments(ctx, bson.D{{Key: "_id", Value: id}, {Key: "deletedDate", Value: nil}})
+		if err != nil {
+			return nil, fmt.Errorf("error counting orgs: %w", err)
+		}
+		if count == 0 {
+			return nil, nil
+		}
+		return nil, common.ErrOrgChanged
+	}
+
+	return result.ToModel(), nil
+}
+
+func (db *MongoDB) UpdateOrganisationRole(ctx context.Context, orgID string, model *models.OrganisationRole) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "roles.name", Value: model.Name},
+		{Key: "deletedDate", Value: nil},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"roles.$[role].description": model.Description,
+			"roles.$[role].permissions": model.Permissions,
+			"roles.$[role].updatedDate": model.UpdatedDate,
+			"updatedDate":               time.Now(),
+		},
+	}
+	opts := options.UpdateOne().SetArrayFilters([]any{
+		bson.M{"role.name": model.Name},
+	})
+
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return fmt.Errorf("error updating org role: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", common.ErrUnknownRole, model.Name)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) UpdateOrganisationUserRole(ctx context.Context, orgID, userID, role string) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	filter := roleExistsFilter(bson.D{
+		{Key: "_id", Value: id},
+		{Key: "users.userId", Value: userID},
+	}, role)
+	if role != models.OrgRoleOwner {
+		filter = append(filter, bson.E{Key: "ownerId", Value: bson.M{"$ne": userID}}, keepOwnerFilter(userID))
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"users.$[member].role":        role,
+			"users.$[member].updatedDate": now,
+			"updatedDate":                 now,
+		},
+	}
+	opts := options.UpdateOne().SetArrayFilters([]any{
+		bson.M{"member.userId": userID},
+	})
+
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return fmt.Errorf("error updating org user role: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		if missing, err := db.customRoleMissing(ctx, id, role); err != nil {
+			return err
+		} else if missing {
+			return fmt.Errorf("%w: %s", common.ErrUnknownRole, role)
+		}
+		return db.organisationUserUpdateError(ctx, id, userID)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) UpdateOwnershipTransfer(ctx context.Context, orgID string, transfer *models.OwnershipTransfer) error {
+	id, err := bson.ObjectIDFromHex(orgID)
+	if err != nil {
+		return fmt.Errorf("error converting org id to bson object id: %w", err)
+	}
+
+	set := bson.M{"updatedDate": time.Now()}
+	update := bson.M{"$set": set}
+	if transfer == nil {
+		update["$unset"] = bson.M{"pendingTransfer": ""}
+	} else {
+		set["pendingTransfer"] = mongoModels.OwnershipTransferToMongo(transfer)
+	}
+
+	result, err := db.activeConnection.db.Collection(OrgsCollection).UpdateByID(ctx, id, update)
+	if err != nil {
+		return fmt.Errorf("error updating ownership transfer: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return common.ErrOrgNotFound
+	}
+
+	return nil
+}
+
+func (db *MongoDB) UpdatePersonalAccessTokenLastUsed(ctx context.Context, tokenID string, lastUsed time.Time) error {
+	id, err := bson.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return fmt.Errorf("error converting personal access token id to bson object id: %w", err)
+	}
+
+	if _, err := db.activeConnection.db.Collection(PersonalAccessTokensCollection).UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"lastUsedDate": lastUsed},
+	}); err != nil {
+		return fmt.Errorf("error updating personal access token last used: %w", err)
+	}
+
+	return nil
+}
+
+func (db *MongoDB) UpdateProviderTokens(
+	ctx context.Context,
+	userID,
+	providerID string,
+	tokens map[string]string,
+	expireAt *time.Time,
+) (*models.User, error) {
+	id, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error converting user id to bson object id: %w", err)
+	}
+
+	account := fmt.Sprintf("accounts.%s", providerID)
+
+	// Only touch this account's tokens so a concurrent save of the user isn't lost
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "isActive", Value: true},
+		{Key: account, Value: bson.M{"$exists": true}},
+	}
+
+	set := bson.M{"updatedDate": time.Now()}
+	if tokens != nil {
+		set[account+".tokens"] = tokens
+	}
+	update := bson.M{"$set": set}
+	if expireAt != nil {
+		set[account+".tokensExpireAt"] = expireAt
+	} else {
+		update["$unset"] = bson.M{account + ".tokensExpireAt": ""}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var result mongoModels.User
+	err = db.activeConnection.db.Collection(UsersCollection).FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error updating provider tokens: %w", err)
+	}
+
+	return result.ToModel(), nil
+}
+
 func (db *MongoDB) applyIndices(ctx context.Context) error {
 	indices := map[string][]mongo.IndexModel{
+		APIKeysCollection: {
+			{
+				Keys: bson.D{
+					{Key: "keyHash", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "orgId", Value: 1},
+				},
+			},
+		},
+		AuditEventsCollection: {
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+					{Key: "createdDate", Value: 1},
+				},
+			},
+		},
+		AuthorizationCodesCollection: {
+			{
+				Keys: bson.D{
+					{Key: "codeHash", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				// Let the database remove expired codes
+				Keys: bson.D{
+					{Key: "expiresAt", Value: 1},
+				},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+		InvitationsCollection: {
+			{
+				Keys: bson.D{
+					{Key: "orgId", Value: 1},
+					{Key: "status", Value: 1},
+					{Key: "emailAddress", Value: 1},
+				},
+			},
+		},
 		OrgsCollection: {
 			{
 				Keys: bson.D{
@@ -404,6 +2046,25 @@ func (db *MongoDB) applyIndices(ctx context.Context) error {
 				},
 				Options: options.Index().SetUnique(true),
 			},
+			{
+				Keys: bson.D{
+					{Key: "purgeAfter", Value: 1},
+				},
+				Options: options.Index().SetSparse(true),
+			},
+		},
+		PersonalAccessTokensCollection: {
+			{
+				Keys: bson.D{
+					{Key: "tokenHash", Value: 1},
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "userId", Value: 1},
+				},
+			},
 		},
 		UsersCollection: {
 			{
@@ -412,6 +2073,29 @@ func (db *MongoDB) applyIndices(ctx context.Context) error {
 					{Key: "accounts.providerUserId", Value: 1},
 				},
 			},
+			{
+				Keys: bson.D{
+					{Key: "emailAddress", Value: 1},
+				},
+			},
+			{
+				Keys: bson.D{
+					{Key: "serviceAccount.clientId", Value: 1},
+				},
+				Options: options.Index().SetUnique(true).SetSparse(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "serviceAccount.orgId", Value: 1},
+				},
+				Options: options.Index().SetSparse(true),
+			},
+			{
+				Keys: bson.D{
+					{Key: "purgeAfter", Value: 1},
+				},
+				Options: options.Index().SetSparse(true),
+			},
 		},
 	}
 
@@ -426,27 +2110,44 @@ func (db *MongoDB) applyIndices(ctx context.Context) error {
 	return nil
 }
 
-func (db *MongoDB) findMultipleUsers(ctx context.Context, userIDs []bson.M) (map[string]*mongoModels.User, error) {
-	filter := bson.M{
-		"$or": userIDs,
+// Works out why an update to an organisation's user matched nothing
+// Works out if a custom role was deleted before it could be assigned
+func (db *MongoDB) customRoleMissing(ctx context.Context, orgID bson.ObjectID, role string) (bool, error) {
+	if rbac.IsBuiltInRole(role) {
+		return false, nil
 	}
 
-	cursor, err := db.activeConnection.db.Collection(UsersCollection).Find(ctx, filter)
+	count, err := db.activeConnection.db.Collection(OrgsCollection).CountDocuments(ctx, bson.D{
+		{Key: "_id", Value: orgID},
+		{Key: "roles.name", Value: role},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error getting multiple users: %w", err)
+		return false, fmt.Errorf("error counting org roles: %w", err)
 	}
 
-	var users []*mongoModels.User
-	if err := cursor.All(ctx, &users); err != nil {
-		return nil, fmt.Errorf("error populating multiple users from cursor: %w", err)
+	return count == 0, nil
+}
+
+func (db *MongoDB) organisationUserUpdateError(ctx context.Context, orgID bson.ObjectID, userID string) error {
+	filter := bson.D{
+		{Key: "_id", Value: orgID},
+		{Key: "users.userId", Value: userID},
 	}
 
-	result := map[string]*mongoModels.User{}
-	for _, u := range users {
-		result[u.ID.Hex()] = u
+	var result mongoModels.Organisation
+	if err := db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return common.ErrUnknownUser
+		}
+
+		return fmt.Errorf("error getting org by id: %w", err)
 	}
 
-	return result, nil
+	if result.OwnerID == userID {
+		return common.ErrOrgOwner
+	}
+
+	return common.ErrNoOrgOwner
 }
 
 func New(cfg config.MongoDB) *MongoDB {
@@ -456,6 +2157,79 @@ func New(cfg config.MongoDB) *MongoDB {
 	}
 }
 
+// Works out why saving a team matched nothing
+func (db *MongoDB) teamUpdateError(ctx context.Context, orgID bson.ObjectID, team *mongoModels.Team) error {
+	filter := bson.D{
+		{Key: "_id", Value: orgID},
+		{Key: "deletedDate", Value: nil},
+	}
+
+	var result mongoModels.Organisation
+	if err := db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return common.ErrOrgNotFound
+		}
+
+		return fmt.Errorf("error getting org by id: %w", err)
+	}
+
+	for _, t := range result.Teams {
+		if t.Slug == team.Slug && t.ID != team.ID {
+			return fmt.Errorf("%w: %s", common.ErrSlugInUse, team.Slug)
+		}
+	}
+
+	return common.ErrTeamNotFound
+}
+
+// Work out why a team user couldn't be saved
+func (db *MongoDB) teamUserUpdateError(ctx context.Context, orgID, teamID bson.ObjectID, userID string) error {
+	filter := bson.D{
+		{Key: "_id", Value: orgID},
+		{Key: "deletedDate", Value: nil},
+	}
+
+	var result mongoModels.Organisation
+	if err := db.activeConnection.db.Collection(OrgsCollection).FindOne(ctx, filter).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return common.ErrOrgNotFound
+		}
+
+		return fmt.Errorf("error getting org by id: %w", err)
+	}
+
+	if !slices.ContainsFunc(result.Teams, func(t *mongoModels.Team) bool { return t.ID == teamID }) {
+		return common.ErrTeamNotFound
+	}
+
+	// Removed from the organisation in the meantime
+	return fmt.Errorf("%w: %s", common.ErrUnknownUser, userID)
+}
+
+// Only matches if the organisation still has an owner without the user - this
+// makes removing the last owner impossible, even with concurrent requests
+func keepOwnerFilter(userID string) bson.E {
+	return bson.E{
+		Key: "users",
+		Value: bson.M{
+			"$elemMatch": bson.M{
+				"role":   models.OrgRoleOwner,
+				"userId": bson.M{"$ne": userID},
+			},
+		},
+	}
+}
+
+// Custom roles must still exist when they're assigned - this stops a member
+// being given a role that's deleted at the same time
+func roleExistsFilter(filter bson.D, role string) bson.D {
+	if rbac.IsBuiltInRole(role) {
+		return filter
+	}
+
+	return append(filter, bson.E{Key: "roles.name", Value: role})
+}
+
 func saveGenericRecord(ctx context.Context, collection *mongo.Collection, recordID bson.ObjectID, record any) (bson.ObjectID, error) {
 	if recordID.IsZero() {
 		// No ID - create record
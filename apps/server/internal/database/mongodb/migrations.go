@@ -0,0 +1,113 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	mongoModels "github.com/mrsimonemms/opensesame/apps/server/internal/database/mongodb/models"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Brings data created by older versions up-to-date. Each migration must be
+// safe to run every time the server starts.
+func (db *MongoDB) applyMigrations(ctx context.Context) error {
+	if err := db.migrateOrganisationOwners(ctx); err != nil {
+		return fmt.Errorf("error migrating organisation owners: %w", err)
+	}
+
+	return nil
+}
+
+// Organisations created before owners were introduced only have maintainers.
+// Without an owner they can't be deleted or transferred and no one can be
+// removed, so one of the maintainers is promoted.
+func (db *MongoDB) migrateOrganisationOwners(ctx context.Context) error {
+	col := db.activeConnection.db.Collection(OrgsCollection)
+
+	filter := bson.D{
+		{Key: "users.0", Value: bson.M{"$exists": true}},
+		{Key: "$or", Value: bson.A{
+			bson.M{"users.role": bson.M{"$ne": models.OrgRoleOwner}},
+			bson.M{"ownerId": bson.M{"$in": bson.A{"", nil}}},
+		}},
+	}
+
+	cursor, err := col.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("error finding organisations without an owner: %w", err)
+	}
+
+	var orgs []*mongoModels.Organisation
+	if err := cursor.All(ctx, &orgs); err != nil {
+		return fmt.Errorf("error getting organisations without an owner from cursor: %w", err)
+	}
+
+	for _, org := range orgs {
+		ownerID := legacyOrganisationOwner(org.Users)
+
+		now := time.Now()
+		update := bson.M{
+			"$set": bson.M{
+				"ownerId":                ownerID,
+				"users.$[u].role":        models.OrgRoleOwner,
+				"users.$[u].updatedDate": now,
+				"updatedDate":            now,
+			},
+		}
+		opts := options.UpdateOne().SetArrayFilters([]any{
+			bson.M{"u.userId": ownerID},
+		})
+
+		// Only update if it's not changed since it was read
+		if _, err := col.UpdateOne(ctx, bson.D{
+			{Key: "_id", Value: org.ID},
+			{Key: "updatedDate", Value: org.UpdatedDate},
+		}, update, opts); err != nil {
+			return fmt.Errorf("error setting organisation owner: %w", err)
+		}
+
+		log.Info().Str("orgID", org.ID.Hex()).Str("ownerID", ownerID).Msg("Promoted organisation owner")
+	}
+
+	return nil
+}
+
+// The longest-standing owner, then maintainer, then member becomes the owner.
+// The creator of the organisation is its first member.
+func legacyOrganisationOwner(users []*mongoModels.OrganisationUser) string {
+	members := slices.Clone(users)
+	slices.SortStableFunc(members, func(a, b *mongoModels.OrganisationUser) int {
+		return a.CreatedDate.Compare(b.CreatedDate)
+	})
+
+	for _, role := range []string{models.OrgRoleOwner, models.OrgRoleMaintainer} {
+		for _, u := range members {
+			if u.Role == role {
+				return u.UserID
+			}
+		}
+	}
+
+	return members[0].UserID
+}
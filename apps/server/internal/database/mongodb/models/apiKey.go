@@ -0,0 +1,86 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type APIKey struct {
+	ID           bson.ObjectID `bson:"_id,omitempty"`
+	OrgID        string        `bson:"orgId"`
+	Name         string        `bson:"name"`
+	Prefix       string        `bson:"prefix"`
+	KeyHash      string        `bson:"keyHash"`
+	Scopes       []string      `bson:"scopes"`
+	CreatedBy    string        `bson:"createdBy"`
+	ExpiresAt    *time.Time    `bson:"expiresAt,omitempty"`
+	LastUsedDate *time.Time    `bson:"lastUsedDate,omitempty"`
+	CreatedDate  time.Time     `bson:"createdDate"`
+	UpdatedDate  time.Time     `bson:"updatedDate"`
+}
+
+func (a *APIKey) ToModel() *models.APIKey {
+	m := &models.APIKey{
+		OrgID:        a.OrgID,
+		Name:         a.Name,
+		Prefix:       a.Prefix,
+		KeyHash:      a.KeyHash,
+		Scopes:       a.Scopes,
+		CreatedBy:    a.CreatedBy,
+		ExpiresAt:    a.ExpiresAt,
+		LastUsedDate: a.LastUsedDate,
+		CreatedDate:  a.CreatedDate,
+		UpdatedDate:  a.UpdatedDate,
+	}
+
+	if !a.ID.IsZero() {
+		m.ID = a.ID.Hex()
+	}
+
+	return m
+}
+
+func APIKeyToMongo(m *models.APIKey) (*APIKey, error) {
+	a := &APIKey{
+		OrgID:        m.OrgID,
+		Name:         m.Name,
+		Prefix:       m.Prefix,
+		KeyHash:      m.KeyHash,
+		Scopes:       m.Scopes,
+		CreatedBy:    m.CreatedBy,
+		ExpiresAt:    m.ExpiresAt,
+		LastUsedDate: m.LastUsedDate,
+		CreatedDate:  m.CreatedDate,
+		UpdatedDate:  m.UpdatedDate,
+	}
+
+	if m.ID != "" {
+		id, err := bson.ObjectIDFromHex(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error converting api key id to bson object id: %w", err)
+		}
+
+		a.ID = id
+	}
+
+	return a, nil
+}
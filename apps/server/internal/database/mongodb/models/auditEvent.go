@@ -0,0 +1,74 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type AuditEvent struct {
+	ID          bson.ObjectID     `bson:"_id,omitempty"`
+	UserID      string            `bson:"userId"`
+	ActorID     string            `bson:"actorId"`
+	Action      string            `bson:"action"`
+	Metadata    map[string]string `bson:"metadata,omitempty"`
+	IPAddress   string            `bson:"ipAddress,omitempty"`
+	CreatedDate time.Time         `bson:"createdDate"`
+}
+
+func (a *AuditEvent) ToModel() *models.AuditEvent {
+	m := &models.AuditEvent{
+		UserID:      a.UserID,
+		ActorID:     a.ActorID,
+		Action:      models.AuditAction(a.Action),
+		Metadata:    a.Metadata,
+		IPAddress:   a.IPAddress,
+		CreatedDate: a.CreatedDate,
+	}
+
+	if !a.ID.IsZero() {
+		m.ID = a.ID.Hex()
+	}
+
+	return m
+}
+
+func AuditEventToMongo(m *models.AuditEvent) (*AuditEvent, error) {
+	a := &AuditEvent{
+		UserID:      m.UserID,
+		ActorID:     m.ActorID,
+		Action:      string(m.Action),
+		Metadata:    m.Metadata,
+		IPAddress:   m.IPAddress,
+		CreatedDate: m.CreatedDate,
+	}
+
+	if m.ID != "" {
+		id, err := bson.ObjectIDFromHex(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error converting audit event id to bson object id: %w", err)
+		}
+
+		a.ID = id
+	}
+
+	return a, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type AuthorizationCode struct {
+	ID                  bson.ObjectID `bson:"_id,omitempty"`
+	CodeHash            string        `bson:"codeHash"`
+	ClientID            string        `bson:"clientId"`
+	RedirectURI         string        `bson:"redirectUri"`
+	UserID              string        `bson:"userId"`
+	Scope               string        `bson:"scope"`
+	Nonce               string        `bson:"nonce"`
+	CodeChallenge       string        `bson:"codeChallenge"`
+	CodeChallengeMethod string        `bson:"codeChallengeMethod"`
+	AuthTime            time.Time     `bson:"authTime"`
+	ExpiresAt           time.Time     `bson:"expiresAt"`
+	CreatedDate         time.Time     `bson:"createdDate"`
+}
+
+func (a *AuthorizationCode) ToModel() *models.AuthorizationCode {
+	m := &models.AuthorizationCode{
+		CodeHash:            a.CodeHash,
+		ClientID:            a.ClientID,
+		RedirectURI:         a.RedirectURI,
+		UserID:              a.UserID,
+		Scope:               a.Scope,
+		Nonce:               a.Nonce,
+		CodeChallenge:       a.CodeChallenge,
+		CodeChallengeMethod: a.CodeChallengeMethod,
+		AuthTime:            a.AuthTime,
+		ExpiresAt:           a.ExpiresAt,
+		CreatedDate:         a.CreatedDate,
+	}
+
+	if !a.ID.IsZero() {
+		m.ID = a.ID.Hex()
+	}
+
+	return m
+}
+
+func AuthorizationCodeToMongo(m *models.AuthorizationCode) (*AuthorizationCode, error) {
+	a := &AuthorizationCode{
+		CodeHash:            m.CodeHash,
+		ClientID:            m.ClientID,
+		RedirectURI:         m.RedirectURI,
+		UserID:              m.UserID,
+		Scope:               m.Scope,
+		Nonce:               m.Nonce,
+		CodeChallenge:       m.CodeChallenge,
+		CodeChallengeMethod: m.CodeChallengeMethod,
+		AuthTime:            m.AuthTime,
+		ExpiresAt:           m.ExpiresAt,
+		CreatedDate:         m.CreatedDate,
+	}
+
+	if m.ID != "" {
+		id, err := bson.ObjectIDFromHex(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error converting authorization code id to bson object id: %w", err)
+		}
+
+		a.ID = id
+	}
+
+	return a, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type Invitation struct {
+	ID           bson.ObjectID `bson:"_id,omitempty"`
+	OrgID        string        `bson:"orgId"`
+	EmailAddress string        `bson:"emailAddress"`
+	Role         string        `bson:"role"`
+	Status       string        `bson:"status"`
+	InvitedBy    string        `bson:"invitedBy"`
+	RespondedBy  string        `bson:"respondedBy,omitempty"`
+	ExpiresAt    time.Time     `bson:"expiresAt"`
+	CreatedDate  time.Time     `bson:"createdDate"`
+	UpdatedDate  time.Time     `bson:"updatedDate"`
+}
+
+func (i *Invitation) ToModel() *models.Invitation {
+	m := &models.Invitation{
+		OrgID:        i.OrgID,
+		EmailAddress: i.EmailAddress,
+		Role:         i.Role,
+		Status:       models.InvitationStatus(i.Status),
+		InvitedBy:    i.InvitedBy,
+		RespondedBy:  i.RespondedBy,
+		ExpiresAt:    i.ExpiresAt,
+		CreatedDate:  i.CreatedDate,
+		UpdatedDate:  i.UpdatedDate,
+	}
+
+	if !i.ID.IsZero() {
+		m.ID = i.ID.Hex()
+	}
+
+	return m
+}
+
+func InvitationToMongo(m *models.Invitation) (*Invitation, error) {
+	i := &Invitation{
+		OrgID:        m.OrgID,
+		EmailAddress: m.EmailAddress,
+		Role:         m.Role,
+		Status:       string(m.Status),
+		InvitedBy:    m.InvitedBy,
+		RespondedBy:  m.RespondedBy,
+		ExpiresAt:    m.ExpiresAt,
+		CreatedDate:  m.CreatedDate,
+		UpdatedDate:  m.UpdatedDate,
+	}
+
+	if m.ID != "" {
+		id, err := bson.ObjectIDFromHex(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error converting invitation id to bson object id: %w", err)
+		}
+
+		i.ID = id
+	}
+
+	return i, nil
+}
@@ -25,46 +25,60 @@ import (
 )
 
 type Organisation struct {
-	ID          bson.ObjectID       `bson:"_id,omitempty"`
-	Name        string              `bson:"name"`
-	Slug        string              `bson:"slug"`
-	Users       []*OrganisationUser `bson:"users"`
-	CreatedDate time.Time           `bson:"createdDate"`
-	UpdatedDate time.Time           `bson:"updatedDate"`
-}
-
-func PaginateUniqueUsers(o *models.Organisation) (filter []bson.M, err error) {
-	uniqueUsers := map[string]string{}
-	for _, u := range o.Users {
-		uniqueUsers[u.UserID] = u.UserID
-	}
-
-	filter = []bson.M{}
-	for u := range uniqueUsers {
-		id, err := bson.ObjectIDFromHex(u)
-		if err != nil {
-			return nil, fmt.Errorf("error converting org's user id to bson object id: %w", err)
-		}
-
-		filter = append(filter, bson.M{"_id": id})
-	}
-
-	return filter, nil
+	ID              bson.ObjectID       `bson:"_id,omitempty"`
+	Name            string              `bson:"name"`
+	Slug            string              `bson:"slug"`
+	OwnerID         string              `bson:"ownerId"`
+	PendingTransfer *OwnershipTransfer  `bson:"pendingTransfer"`
+	Users           []*OrganisationUser `bson:"users"`
+	Roles           []*OrganisationRole `bson:"roles"`
+	Teams           []*Team             `bson:"teams"`
+	CreatedDate     time.Time           `bson:"createdDate"`
+	UpdatedDate     time.Time           `bson:"updatedDate"`
+	DeletedDate     *time.Time          `bson:"deletedDate,omitempty"`
+	PurgeAfter      *time.Time          `bson:"purgeAfter,omitempty"`
 }
 
 func (o *Organisation) ToModel() *models.Organisation {
 	m := &models.Organisation{
 		Name:        o.Name,
 		Slug:        o.Slug,
+		OwnerID:     o.OwnerID,
 		Users:       make([]*models.OrganisationUser, 0),
+		Roles:       make([]*models.OrganisationRole, 0),
+		Teams:       make([]*models.Team, 0),
 		CreatedDate: o.CreatedDate,
 		UpdatedDate: o.UpdatedDate,
+		DeletedDate: o.DeletedDate,
+		PurgeAfter:  o.PurgeAfter,
 	}
 
 	for _, u := range o.Users {
 		m.Users = append(m.Users, u.ToModel())
 	}
 
+	if m.OwnerID == "" {
+		// Organisations created before owners were introduced - the first owner is promoted
+		for _, u := range m.Users {
+			if u.Role == models.OrgRoleOwner {
+				m.OwnerID = u.UserID
+				break
+			}
+		}
+	}
+
+	if o.PendingTransfer != nil {
+		m.PendingTransfer = o.PendingTransfer.ToModel()
+	}
+
+	for _, r := range o.Roles {
+		m.Roles = append(m.Roles, r.ToModel())
+	}
+
+	for _, t := range o.Teams {
+		m.Teams = append(m.Teams, t.ToModel())
+	}
+
 	if !o.ID.IsZero() {
 		m.ID = o.ID.Hex()
 	}
@@ -74,17 +88,35 @@ func (o *Organisation) ToModel() *models.Organisation {
 
 func OrganisationToMongo(m *models.Organisation) (*Organisation, error) {
 	o := &Organisation{
-		Name:        m.Name,
-		Slug:        m.Slug,
-		Users:       []*OrganisationUser{},
-		CreatedDate: m.CreatedDate,
-		UpdatedDate: m.UpdatedDate,
+		Name:            m.Name,
+		Slug:            m.Slug,
+		OwnerID:         m.OwnerID,
+		PendingTransfer: OwnershipTransferToMongo(m.PendingTransfer),
+		Users:           []*OrganisationUser{},
+		Roles:           []*OrganisationRole{},
+		Teams:           []*Team{},
+		CreatedDate:     m.CreatedDate,
+		UpdatedDate:     m.UpdatedDate,
+		DeletedDate:     m.DeletedDate,
+		PurgeAfter:      m.PurgeAfter,
 	}
 
 	for _, user := range m.Users {
 		o.Users = append(o.Users, OrganisationUserToMongo(user))
 	}
 
+	for _, role := range m.Roles {
+		o.Roles = append(o.Roles, OrganisationRoleToMongo(role))
+	}
+
+	for _, team := range m.Teams {
+		t, err := TeamToMongo(team)
+		if err != nil {
+			return nil, err
+		}
+		o.Teams = append(o.Teams, t)
+	}
+
 	if m.ID != "" {
 		id, err := bson.ObjectIDFromHex(m.ID)
 		if err != nil {
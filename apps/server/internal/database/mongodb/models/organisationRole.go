@@ -0,0 +1,51 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+type OrganisationRole struct {
+	Name        string    `bson:"name"`
+	Description string    `bson:"description"`
+	Permissions []string  `bson:"permissions"`
+	CreatedDate time.Time `bson:"createdDate"`
+	UpdatedDate time.Time `bson:"updatedDate"`
+}
+
+func (o *OrganisationRole) ToModel() *models.OrganisationRole {
+	return &models.OrganisationRole{
+		Name:        o.Name,
+		Description: o.Description,
+		Permissions: o.Permissions,
+		CreatedDate: o.CreatedDate,
+		UpdatedDate: o.UpdatedDate,
+	}
+}
+
+func OrganisationRoleToMongo(p *models.OrganisationRole) *OrganisationRole {
+	return &OrganisationRole{
+		Name:        p.Name,
+		Description: p.Description,
+		Permissions: p.Permissions,
+		CreatedDate: p.CreatedDate,
+		UpdatedDate: p.UpdatedDate,
+	}
+}
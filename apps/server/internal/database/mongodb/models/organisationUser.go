@@ -27,6 +27,7 @@ type OrganisationUser struct {
 	ID          bson.ObjectID `bson:"_id,omitempty"`
 	UserID      string        `bson:"userId"`
 	Role        string        `bson:"role"`
+	Provisioned bool          `bson:"provisioned,omitempty"`
 	CreatedDate time.Time     `bson:"createdDate"`
 	UpdatedDate time.Time     `bson:"updatedDate"`
 }
@@ -35,6 +36,7 @@ func (o *OrganisationUser) ToModel() *models.OrganisationUser {
 	m := &models.OrganisationUser{
 		UserID:      o.UserID,
 		Role:        o.Role,
+		Provisioned: o.Provisioned,
 		CreatedDate: o.CreatedDate,
 		UpdatedDate: o.UpdatedDate,
 	}
@@ -47,8 +49,19 @@ func (o *OrganisationUser) ToModel() *models.OrganisationUser {
 }
 
 func OrganisationUserToMongo(p *models.OrganisationUser) *OrganisationUser {
-	return &OrganisationUser{
-		UserID: p.Name,
-		Role:   p.Role,
+	o := &OrganisationUser{
+		UserID:      p.UserID,
+		Role:        p.Role,
+		Provisioned: p.Provisioned,
+		CreatedDate: p.CreatedDate,
+		UpdatedDate: p.UpdatedDate,
 	}
+
+	if p.ID != "" {
+		if id, err := bson.ObjectIDFromHex(p.ID); err == nil {
+			o.ID = id
+		}
+	}
+
+	return o
 }
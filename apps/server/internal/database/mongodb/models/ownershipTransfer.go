@@ -0,0 +1,52 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+type OwnershipTransfer struct {
+	FromUserID  string    `bson:"fromUserId"`
+	ToUserID    string    `bson:"toUserId"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+	CreatedDate time.Time `bson:"createdDate"`
+}
+
+func (o *OwnershipTransfer) ToModel() *models.OwnershipTransfer {
+	return &models.OwnershipTransfer{
+		FromUserID:  o.FromUserID,
+		ToUserID:    o.ToUserID,
+		ExpiresAt:   o.ExpiresAt,
+		CreatedDate: o.CreatedDate,
+	}
+}
+
+func OwnershipTransferToMongo(m *models.OwnershipTransfer) *OwnershipTransfer {
+	if m == nil {
+		return nil
+	}
+
+	return &OwnershipTransfer{
+		FromUserID:  m.FromUserID,
+		ToUserID:    m.ToUserID,
+		ExpiresAt:   m.ExpiresAt,
+		CreatedDate: m.CreatedDate,
+	}
+}
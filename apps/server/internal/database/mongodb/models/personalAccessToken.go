@@ -0,0 +1,83 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type PersonalAccessToken struct {
+	ID           bson.ObjectID `bson:"_id,omitempty"`
+	UserID       string        `bson:"userId"`
+	Name         string        `bson:"name"`
+	Prefix       string        `bson:"prefix"`
+	TokenHash    string        `bson:"tokenHash"`
+	Scopes       []string      `bson:"scopes"`
+	ExpiresAt    *time.Time    `bson:"expiresAt,omitempty"`
+	LastUsedDate *time.Time    `bson:"lastUsedDate,omitempty"`
+	CreatedDate  time.Time     `bson:"createdDate"`
+	UpdatedDate  time.Time     `bson:"updatedDate"`
+}
+
+func (p *PersonalAccessToken) ToModel() *models.PersonalAccessToken {
+	m := &models.PersonalAccessToken{
+		UserID:       p.UserID,
+		Name:         p.Name,
+		Prefix:       p.Prefix,
+		TokenHash:    p.TokenHash,
+		Scopes:       p.Scopes,
+		ExpiresAt:    p.ExpiresAt,
+		LastUsedDate: p.LastUsedDate,
+		CreatedDate:  p.CreatedDate,
+		UpdatedDate:  p.UpdatedDate,
+	}
+
+	if !p.ID.IsZero() {
+		m.ID = p.ID.Hex()
+	}
+
+	return m
+}
+
+func PersonalAccessTokenToMongo(m *models.PersonalAccessToken) (*PersonalAccessToken, error) {
+	p := &PersonalAccessToken{
+		UserID:       m.UserID,
+		Name:         m.Name,
+		Prefix:       m.Prefix,
+		TokenHash:    m.TokenHash,
+		Scopes:       m.Scopes,
+		ExpiresAt:    m.ExpiresAt,
+		LastUsedDate: m.LastUsedDate,
+		CreatedDate:  m.CreatedDate,
+		UpdatedDate:  m.UpdatedDate,
+	}
+
+	if m.ID != "" {
+		id, err := bson.ObjectIDFromHex(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error converting personal access token id to bson object id: %w", err)
+		}
+
+		p.ID = id
+	}
+
+	return p, nil
+}
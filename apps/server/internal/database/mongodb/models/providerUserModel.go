@@ -16,14 +16,20 @@
 
 package models
 
-import "github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+import (
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
 
 type ProviderUser struct {
 	Tokens         map[string]string `bson:"tokens"`
 	ProviderUserID string            `bson:"providerUserId"`
 	EmailAddress   *string           `bson:"emailAddress"`
+	EmailVerified  bool              `bson:"emailVerified"`
 	Name           *string           `bson:"name"`
 	Username       *string           `bson:"username"`
+	TokensExpireAt *time.Time        `bson:"tokensExpireAt,omitempty"`
 }
 
 func (p *ProviderUser) ToModel() *models.ProviderAccount {
@@ -31,8 +37,10 @@ func (p *ProviderUser) ToModel() *models.ProviderAccount {
 		Tokens:         p.Tokens,
 		ProviderUserID: p.ProviderUserID,
 		EmailAddress:   p.EmailAddress,
+		EmailVerified:  p.EmailVerified,
 		Name:           p.Name,
 		Username:       p.Username,
+		TokensExpireAt: p.TokensExpireAt,
 	}
 }
 
@@ -41,7 +49,9 @@ func ProviderUserToMongo(p *models.ProviderAccount) *ProviderUser {
 		Tokens:         p.Tokens,
 		ProviderUserID: p.ProviderUserID,
 		EmailAddress:   p.EmailAddress,
+		EmailVerified:  p.EmailVerified,
 		Name:           p.Name,
 		Username:       p.Username,
+		TokensExpireAt: p.TokensExpireAt,
 	}
 }
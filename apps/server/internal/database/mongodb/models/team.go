@@ -0,0 +1,98 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type TeamUser struct {
+	UserID      string    `bson:"userId"`
+	Role        string    `bson:"role"`
+	CreatedDate time.Time `bson:"createdDate"`
+	UpdatedDate time.Time `bson:"updatedDate"`
+}
+
+type Team struct {
+	ID          bson.ObjectID `bson:"_id"`
+	Name        string        `bson:"name"`
+	Slug        string        `bson:"slug"`
+	Description string        `bson:"description"`
+	Users       []*TeamUser   `bson:"users"`
+	CreatedDate time.Time     `bson:"createdDate"`
+	UpdatedDate time.Time     `bson:"updatedDate"`
+}
+
+func (t *Team) ToModel() *models.Team {
+	m := &models.Team{
+		ID:          t.ID.Hex(),
+		Name:        t.Name,
+		Slug:        t.Slug,
+		Description: t.Description,
+		Users:       make([]*models.TeamUser, 0),
+		CreatedDate: t.CreatedDate,
+		UpdatedDate: t.UpdatedDate,
+	}
+
+	for _, u := range t.Users {
+		m.Users = append(m.Users, &models.TeamUser{
+			UserID:      u.UserID,
+			Role:        u.Role,
+			CreatedDate: u.CreatedDate,
+			UpdatedDate: u.UpdatedDate,
+		})
+	}
+
+	return m
+}
+
+// TeamToMongo converts the team, generating an ID for new teams
+func TeamToMongo(m *models.Team) (*Team, error) {
+	t := &Team{
+		ID:          bson.NewObjectID(),
+		Name:        m.Name,
+		Slug:        m.Slug,
+		Description: m.Description,
+		Users:       []*TeamUser{},
+		CreatedDate: m.CreatedDate,
+		UpdatedDate: m.UpdatedDate,
+	}
+
+	for _, u := range m.Users {
+		t.Users = append(t.Users, &TeamUser{
+			UserID:      u.UserID,
+			Role:        u.Role,
+			CreatedDate: u.CreatedDate,
+			UpdatedDate: u.UpdatedDate,
+		})
+	}
+
+	if m.ID != "" {
+		id, err := bson.ObjectIDFromHex(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error converting team id to bson object id: %w", err)
+		}
+
+		t.ID = id
+	}
+
+	return t, nil
+}
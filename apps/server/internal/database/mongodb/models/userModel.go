@@ -24,24 +24,62 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+type ServiceAccount struct {
+	OrgID            string `bson:"orgId"`
+	ClientID         string `bson:"clientId"`
+	ClientSecretHash string `bson:"clientSecretHash"`
+	CreatedBy        string `bson:"createdBy"`
+}
+
 type User struct {
-	ID           bson.ObjectID            `bson:"_id,omitempty"`
-	EmailAddress string                   `bson:"emailAddress"`
-	Name         string                   `bson:"name"`
-	Accounts     map[string]*ProviderUser `bson:"accounts"`
-	IsActive     bool                     `bson:"isActive"`
-	CreatedDate  time.Time                `bson:"createdDate"`
-	UpdatedDate  time.Time                `bson:"updatedDate"`
+	ID                   bson.ObjectID            `bson:"_id,omitempty"`
+	Type                 string                   `bson:"type,omitempty"`
+	EmailAddress         string                   `bson:"emailAddress"`
+	Name                 string                   `bson:"name"`
+	AvatarURL            string                   `bson:"avatarUrl,omitempty"`
+	Accounts             map[string]*ProviderUser `bson:"accounts"`
+	ServiceAccount       *ServiceAccount          `bson:"serviceAccount,omitempty"`
+	PrimaryEmailProvider string                   `bson:"primaryEmailProvider,omitempty"`
+	ProfileSyncProvider  string                   `bson:"profileSyncProvider,omitempty"`
+	IsActive             bool                     `bson:"isActive"`
+	TokensValidAfter     *time.Time               `bson:"tokensValidAfter,omitempty"`
+	DeletedDate          *time.Time               `bson:"deletedDate,omitempty"`
+	PurgeAfter           *time.Time               `bson:"purgeAfter,omitempty"`
+	MergedInto           string                   `bson:"mergedInto,omitempty"`
+	CreatedDate          time.Time                `bson:"createdDate"`
+	UpdatedDate          time.Time                `bson:"updatedDate"`
 }
 
 func (u *User) ToModel() *models.User {
 	m := &models.User{
-		EmailAddress: u.EmailAddress,
-		Name:         u.Name,
-		Accounts:     map[string]*models.ProviderAccount{},
-		IsActive:     u.IsActive,
-		CreatedDate:  u.CreatedDate,
-		UpdatedDate:  u.UpdatedDate,
+		Type:                 models.UserType(u.Type),
+		EmailAddress:         u.EmailAddress,
+		Name:                 u.Name,
+		AvatarURL:            u.AvatarURL,
+		PrimaryEmailProvider: u.PrimaryEmailProvider,
+		ProfileSyncProvider:  u.ProfileSyncProvider,
+		Accounts:             map[string]*models.ProviderAccount{},
+		IsActive:             u.IsActive,
+		TokensValidAfter:     u.TokensValidAfter,
+		DeletedDate:          u.DeletedDate,
+		PurgeAfter:           u.PurgeAfter,
+		MergedInto:           u.MergedInto,
+		CreatedDate:          u.CreatedDate,
+		UpdatedDate:          u.UpdatedDate,
+	}
+
+	if m.Type == "" {
+		// Users created before service accounts existed
+		m.Type = models.UserTypeHuman
+	}
+
+	if u.ServiceAccount != nil {
+		m.ServiceAccount = &models.ServiceAccount{
+			OrgID:            u.ServiceAccount.OrgID,
+			ClientID:         u.ServiceAccount.ClientID,
+			ClientSecretHash: u.ServiceAccount.ClientSecretHash,
+			CreatedBy:        u.ServiceAccount.CreatedBy,
+		}
 	}
 
 	for providerID, i := range u.Accounts {
@@ -57,12 +95,29 @@ func (u *User) ToModel() *models.User {
 
 func UserToMongo(m *models.User) (*User, error) {
 	u := &User{
-		EmailAddress: m.EmailAddress,
-		Name:         m.Name,
-		Accounts:     map[string]*ProviderUser{},
-		IsActive:     m.IsActive,
-		CreatedDate:  m.CreatedDate,
-		UpdatedDate:  m.UpdatedDate,
+		Type:                 string(m.Type),
+		EmailAddress:         m.EmailAddress,
+		Name:                 m.Name,
+		AvatarURL:            m.AvatarURL,
+		PrimaryEmailProvider: m.PrimaryEmailProvider,
+		ProfileSyncProvider:  m.ProfileSyncProvider,
+		Accounts:             map[string]*ProviderUser{},
+		IsActive:             m.IsActive,
+		TokensValidAfter:     m.TokensValidAfter,
+		DeletedDate:          m.DeletedDate,
+		PurgeAfter:           m.PurgeAfter,
+		MergedInto:           m.MergedInto,
+		CreatedDate:          m.CreatedDate,
+		UpdatedDate:          m.UpdatedDate,
+	}
+
+	if m.ServiceAccount != nil {
+		u.ServiceAccount = &ServiceAccount{
+			OrgID:            m.ServiceAccount.OrgID,
+			ClientID:         m.ServiceAccount.ClientID,
+			ClientSecretHash: m.ServiceAccount.ClientSecretHash,
+			CreatedBy:        m.ServiceAccount.CreatedBy,
+		}
 	}
 
 	for providerID, i := range m.Accounts {
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mongodb
+
+import (
+	"math"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+func newPagination[T any](data []T, offset, limit int, total int64) *models.Pagination[T] {
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	page := int(math.Ceil(float64(offset-1)/float64(limit)) + 1)
+	if page < 0 {
+		page = 0
+	} else if page > totalPages {
+		page = totalPages
+	}
+
+	return &models.Pagination[T]{
+		Data:       data,
+		Count:      len(data),
+		Page:       page,
+		PerPage:    limit,
+		TotalPages: totalPages,
+		Total:      total,
+	}
+}
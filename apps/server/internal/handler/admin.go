@@ -0,0 +1,86 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Admin deactivate user godoc
+// @Summary		Deactivate user
+// @Description Deactivate a user's account. Their auth tokens are revoked and personal access tokens deleted.
+// @Tags		Admin
+// @Accept		json
+// @Produce		json
+// @Param		userID	path	string	true	"User ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/admin/users/{userID}/deactivate [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) AdminUserDeactivate(c *fiber.Ctx) error {
+	userID := c.Params("userID")
+	log := c.Locals("logger").(zerolog.Logger)
+
+	log = log.With().Str("userID", userID).Logger()
+
+	if _, err := h.usersStore.DeactivateUser(c.Context(), userID); err != nil {
+		return userError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionUserDeactivated, userID, nil)
+
+	log.Info().Msg("User deactivated by admin")
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Admin reactivate user godoc
+// @Summary		Reactivate user
+// @Description Reactivate a deactivated user's account. This restores a deleted user that hasn't been purged yet, but
+// @Description not their organisation memberships. Tokens revoked when they were deactivated are not restored.
+// @Tags		Admin
+// @Accept		json
+// @Produce		json
+// @Param		userID	path	string	true	"User ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/admin/users/{userID}/reactivate [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) AdminUserReactivate(c *fiber.Ctx) error {
+	userID := c.Params("userID")
+	log := c.Locals("logger").(zerolog.Logger)
+
+	log = log.With().Str("userID", userID).Logger()
+
+	if _, err := h.usersStore.ReactivateUser(c.Context(), userID); err != nil {
+		return userError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionUserReactivated, userID, nil)
+
+	log.Info().Msg("User reactivated by admin")
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
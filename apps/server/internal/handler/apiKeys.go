@@ -0,0 +1,144 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Create API key godoc
+// @Summary		Create API key
+// @Description Create an API key for the organisation. The key is only returned once.
+// @Tags		API Keys
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string				true	"Organisation ID"
+// @Param		apiKey	body	models.APIKeyDTO	true	"Input"
+// @Success		200	{object}	models.APIKeyCreatedDTO
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/api-keys [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) APIKeyCreate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.APIKeyDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("API key object invalid")
+		return err
+	}
+
+	apiKey, key, err := h.apiKeysStore.CreateAPIKey(c.Context(), org, user.ID, input)
+	if err != nil {
+		return apiKeyError(log, err)
+	}
+
+	return c.JSON(models.APIKeyCreatedDTO{
+		APIKey: apiKey,
+		Key:    key,
+	})
+}
+
+// Delete API key godoc
+// @Summary		Delete API key
+// @Description Delete an API key. It can no longer be used to authenticate.
+// @Tags		API Keys
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		keyID	path	string	true	"API key ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/api-keys/{keyID} [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) APIKeyDelete(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.apiKeysStore.DeleteAPIKey(c.Context(), org.ID, c.Params("keyID")); err != nil {
+		return apiKeyError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// List API keys godoc
+// @Summary		List API keys
+// @Description List the organisation's API keys. The keys themselves are never returned.
+// @Tags		API Keys
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		page	query	int		false	"Page number"	default(1)
+// @Param		perPage	query	int		false	"Results per page"	default(25)
+// @Success		200	{object}	models.Pagination[models.APIKey]
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/api-keys [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) APIKeyList(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	page := max(c.QueryInt("page", 1), 1)
+	perPage := min(max(c.QueryInt("perPage", 25), 1), 100)
+
+	offset := perPage * (page - 1)
+
+	keys, err := h.apiKeysStore.ListAPIKeys(c.Context(), offset, perPage, org.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting list of api keys")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(keys)
+}
+
+func apiKeyError(log zerolog.Logger, err error) error {
+	switch {
+	case errors.Is(err, common.ErrNotDeleted):
+		return fiber.ErrNotFound
+	case errors.Is(err, common.ErrForbidden):
+		log.Debug().Err(err).Msg("Forbidden api key change")
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, common.ErrInvalidExpiry),
+		errors.Is(err, common.ErrInvalidScope):
+		log.Debug().Err(err).Msg("Invalid api key")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	default:
+		log.Error().Err(err).Msg("Error changing api key")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// Records an audit event about the user. The actor is whoever made the
+// request, which is the user themselves if they're not authenticated yet.
+func (h *handler) recordAuditEvent(c *fiber.Ctx, action models.AuditAction, userID string, metadata map[string]string) {
+	actorID := userID
+	if principal, ok := c.Locals(principalContextKey).(*models.Principal); ok {
+		actorID = principal.ID
+	}
+
+	h.auditEventsStore.Record(c.Context(), &models.AuditEvent{
+		UserID:    userID,
+		ActorID:   actorID,
+		Action:    action,
+		Metadata:  metadata,
+		IPAddress: c.IP(),
+	})
+}
@@ -17,9 +17,15 @@
 package handler
 
 const (
-	callbackCookieKey     = "callback"
-	existingUserCookieKey = "userID"
-	jwtContextKey         = "jwtoken"
-	userAuthQueryString   = "token"
-	userContextKey        = "user"
+	activeOrgContextKey     = "activeOrg"
+	jwtContextKey           = "jwtoken"
+	loginStateContextKey    = "loginState"
+	loginStateCookieKey     = "loginState"
+	oauthAuthorizeCookieKey = "oauthAuthorize"
+	orgContextKey           = "org"
+	orgUserContextKey       = "orgUser"
+	principalContextKey     = "principal"
+	teamContextKey          = "team"
+	userAuthQueryString     = "token"
+	userContextKey          = "user"
 )
@@ -19,26 +19,44 @@ package handler
 import (
 	"github.com/go-playground/validator/v10"
 	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/notifier"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/providers"
 	"github.com/mrsimonemms/opensesame/apps/server/internal/stores"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
 )
 
 type handler struct {
-	config    *config.ServerConfig
-	db        database.Driver
-	validator *validator.Validate
+	config       *config.ServerConfig
+	db           database.Driver
+	descriptions *providers.Descriptions
+	validator    *validator.Validate
 
-	orgsStore  *stores.Organisations
-	usersStore *stores.Users
+	apiKeysStore     *stores.APIKeys
+	auditEventsStore *stores.AuditEvents
+	invitationsStore *stores.Invitations
+	oauthStore       *stores.OAuth
+	orgsStore        *stores.Organisations
+	patStore         *stores.PersonalAccessTokens
+	scimStore        *stores.SCIM
+	usersStore       *stores.Users
 }
 
-func New(config *config.ServerConfig, db database.Driver) *handler {
+func New(config *config.ServerConfig, db database.Driver, n notifier.Notifier) *handler {
+	descriptions := providers.NewDescriptions()
+
 	return &handler{
-		config:    config,
-		db:        db,
-		validator: validator.New(validator.WithRequiredStructEnabled()),
+		config:       config,
+		db:           db,
+		descriptions: descriptions,
+		validator:    validator.New(validator.WithRequiredStructEnabled()),
 
-		orgsStore:  stores.NewOrganisationsStore(config, db),
-		usersStore: stores.NewUsersStore(config, db),
+		apiKeysStore:     stores.NewAPIKeysStore(config, db),
+		auditEventsStore: stores.NewAuditEventsStore(config, db),
+		invitationsStore: stores.NewInvitationsStore(config, db, n),
+		oauthStore:       stores.NewOAuthStore(config, db),
+		orgsStore:        stores.NewOrganisationsStore(config, db),
+		patStore:         stores.NewPersonalAccessTokensStore(config, db),
+		scimStore:        stores.NewSCIMStore(config, db),
+		usersStore:       stores.NewUsersStore(config, db, descriptions),
 	}
 }
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Accept invitation godoc
+// @Summary		Accept invitation
+// @Description Accept an invitation to join an organisation as the logged-in user. It must be sent to their email.
+// @Tags		Invitations
+// @Accept		json
+// @Produce		json
+// @Param		invitation	body	models.InvitationResponseDTO	true	"Input"
+// @Success		200	{object}	models.Organisation
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/invitations/accept [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) InvitationAccept(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input, err := h.parseInvitationResponse(c)
+	if err != nil {
+		return err
+	}
+
+	org, err := h.invitationsStore.AcceptInvitation(c.Context(), input.Token, user)
+	if err != nil {
+		return invitationError(log, err)
+	}
+	if org == nil {
+		return fiber.ErrNotFound
+	}
+
+	return c.JSON(org)
+}
+
+// Create invitation godoc
+// @Summary		Create invitation
+// @Description Invite someone to join the organisation by email address. The invitation is sent by the configured notifier.
+// @Tags		Invitations
+// @Accept		json
+// @Produce		json
+// @Param		orgID		path	string					true	"Organisation ID"
+// @Param		invitation	body	models.InvitationDTO	true	"Input"
+// @Success		200	{object}	models.Invitation
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/invitations [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) InvitationCreate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.InvitationDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Invitation object invalid")
+		return err
+	}
+
+	invitation, err := h.invitationsStore.CreateInvitation(c.Context(), org, user.ID, input)
+	if err != nil {
+		return invitationError(log, err)
+	}
+
+	return c.JSON(invitation)
+}
+
+// Decline invitation godoc
+// @Summary		Decline invitation
+// @Description Decline an invitation to join an organisation
+// @Tags		Invitations
+// @Accept		json
+// @Produce		json
+// @Param		invitation	body	models.InvitationResponseDTO	true	"Input"
+// @Success		204	"No response"
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/invitations/decline [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) InvitationDecline(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input, err := h.parseInvitationResponse(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.invitationsStore.DeclineInvitation(c.Context(), input.Token, user); err != nil {
+		return invitationError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// List invitations godoc
+// @Summary		List invitations
+// @Description List the organisation's pending invitations
+// @Tags		Invitations
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		page	query	int	false	"Page number"	example(1)
+// @Param		perPage	query	int	false	"Records per page"	example(25)
+// @Success		200	{object}	models.Pagination[models.Invitation]
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/invitations [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) InvitationList(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	page := max(c.QueryInt("page", 1), 1)
+	perPage := min(max(c.QueryInt("perPage", 25), 1), 100)
+
+	offset := perPage * (page - 1)
+
+	invitations, err := h.invitationsStore.ListInvitations(c.Context(), offset, perPage, org.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting list of invitations")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(invitations)
+}
+
+// Revoke invitation godoc
+// @Summary		Revoke invitation
+// @Description Revoke a pending invitation so it can no longer be accepted
+// @Tags		Invitations
+// @Accept		json
+// @Produce		json
+// @Param		orgID			path	string	true	"Organisation ID"
+// @Param		invitationID	path	string	true	"Invitation ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/invitations/{invitationID} [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) InvitationRevoke(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.invitationsStore.RevokeInvitation(c.Context(), org.ID, c.Params("invitationID"), user.ID); err != nil {
+		return invitationError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) parseInvitationResponse(c *fiber.Ctx) (*models.InvitationResponseDTO, error) {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.InvitationResponseDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Invitation response object invalid")
+		return nil, err
+	}
+
+	return input, nil
+}
+
+func invitationError(log zerolog.Logger, err error) error {
+	switch {
+	case errors.Is(err, common.ErrNotDeleted), errors.Is(err, common.ErrOrgNotFound):
+		return fiber.ErrNotFound
+	case errors.Is(err, common.ErrForbidden):
+		log.Debug().Err(err).Msg("Invitation forbidden")
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, common.ErrDuplicateOrgUser),
+		errors.Is(err, common.ErrInvalidInvite),
+		errors.Is(err, common.ErrInviteExists),
+		errors.Is(err, common.ErrUnknownRole):
+		log.Debug().Err(err).Msg("Invalid invitation")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	default:
+		log.Error().Err(err).Msg("Error handling invitation")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+}
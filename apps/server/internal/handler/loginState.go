@@ -0,0 +1,160 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Audience of the login state - prevents it being used as an auth token
+const loginStateAudience = "login-state"
+
+// The parameters of a login attempt, signed and stored in a cookie
+// until the provider returns the user
+type loginState struct {
+	jwt.RegisteredClaims
+
+	Callback    string               `json:"callback,omitempty"`
+	ClientState string               `json:"clientState,omitempty"`
+	Delivery    config.TokenDelivery `json:"delivery"`
+	UserID      string               `json:"userId,omitempty"` // Existing user to link the provider to
+}
+
+// Stores the login parameters as signed, expiring state. Errors with 400
+// if the callback URL is not in the allowlist.
+func (h *handler) SetLoginState(c *fiber.Ctx) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	nonce, err := models.GenerateRandomToken(16)
+	if err != nil {
+		log.Error().Err(err).Msg("Error generating login state nonce")
+		return fiber.ErrInternalServerError
+	}
+
+	now := time.Now()
+	expiry := now.Add(h.config.Server.Callback.StateExpiresIn.Duration)
+
+	state := &loginState{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{loginStateAudience},
+			ExpiresAt: jwt.NewNumericDate(expiry),
+			ID:        nonce,
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    h.config.JWT.Issuer,
+		},
+		Delivery: h.config.Server.Callback.TokenDelivery,
+	}
+
+	if u := c.Locals(userContextKey); u != nil {
+		state.UserID = u.(*models.User).ID
+		log.Debug().Str("userID", state.UserID).Msg("Adding existing user to login state")
+	}
+
+	if callbackURL := c.Query("callback"); callbackURL != "" {
+		if !h.isCallbackAllowed(callbackURL) {
+			log.Warn().Str("callback", callbackURL).Msg("Callback URL not in allowlist")
+			return fiber.NewError(fiber.StatusBadRequest, "Callback URL not allowed")
+		}
+
+		state.Callback = callbackURL
+		state.ClientState = c.Query("state")
+	}
+
+	// A request can ask for a code instead of the token, but can't put the token
+	// back in the URL if the server only delivers codes
+	switch delivery := config.TokenDelivery(c.Query("delivery")); delivery {
+	case "", config.TokenDeliveryQuery:
+	case config.TokenDeliveryCode:
+		state.Delivery = delivery
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown token delivery")
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, state).SignedString(h.config.JWT.Key)
+	if err != nil {
+		log.Error().Err(err).Msg("Error signing login state")
+		return fiber.ErrInternalServerError
+	}
+
+	log.Debug().Msg("Setting login state cookie")
+	c.Cookie(&fiber.Cookie{
+		Name:     loginStateCookieKey,
+		Value:    signed,
+		Expires:  expiry,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	// Logins that complete in this request cannot read the cookie
+	c.Locals(loginStateContextKey, state)
+
+	return c.Next()
+}
+
+func (h *handler) clearLoginState(c *fiber.Ctx) {
+	// The c.ClearCookie function doesn't seem to work with encrypt cookie
+	c.Cookie(&fiber.Cookie{
+		Name:    loginStateCookieKey,
+		Expires: time.Now().Add(-time.Hour * 24),
+		Value:   "",
+	})
+}
+
+// Retrieves and verifies the login state - errors with 400 if missing or invalid
+func (h *handler) getLoginState(c *fiber.Ctx) (*loginState, error) {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if state, ok := c.Locals(loginStateContextKey).(*loginState); ok {
+		return state, nil
+	}
+
+	value := c.Cookies(loginStateCookieKey)
+	if value == "" {
+		log.Debug().Msg("No login state cookie")
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Login state missing or expired")
+	}
+
+	state := &loginState{}
+	if _, err := jwt.ParseWithClaims(value, state, func(t *jwt.Token) (any, error) {
+		return h.config.JWT.Key, nil
+	},
+		jwt.WithAudience(loginStateAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(h.config.JWT.Issuer),
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+	); err != nil {
+		log.Debug().Err(err).Msg("Invalid login state")
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Login state missing or expired")
+	}
+
+	return state, nil
+}
+
+// The OpenID Connect authorize callback is always allowed
+func (h *handler) isCallbackAllowed(callbackURL string) bool {
+	if h.config.OAuth != nil && callbackURL == h.oauthAuthorizeCallbackURL() {
+		return true
+	}
+
+	return h.config.Server.Callback.IsURLAllowed(callbackURL)
+}
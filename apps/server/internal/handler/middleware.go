@@ -17,17 +17,26 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/mrsimonemms/opensesame/apps/server/internal/providers"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/rbac"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
 	"github.com/mrsimonemms/opensesame/packages/authentication/v1"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+var errInvalidAuthToken = fmt.Errorf("invalid auth token")
+
 func (h *handler) IsRouteEnabled(route authentication.Route) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		providerID := c.Params("providerID")
@@ -57,9 +66,85 @@ func (h *handler) IsRouteEnabled(route authentication.Route) func(c *fiber.Ctx)
 	}
 }
 
-// Verify the user's permission to access the resource - errors with 403
-func (h *handler) VerifyRBACPermissions(c *fiber.Ctx) error {
-	return c.Next()
+// Verify the user's role in the organisation grants the permission - errors
+// with 403. The organisation and the user's membership are saved to the context.
+func (h *handler) VerifyRBACPermissions(permission rbac.Permission) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		orgID := c.Params("orgID")
+		principal := c.Locals(principalContextKey).(*models.Principal)
+		log := c.Locals("logger").(zerolog.Logger)
+
+		l := log.With().Str("orgID", orgID).Str("permission", string(permission)).Logger()
+
+		if activeOrg, ok := c.Locals(activeOrgContextKey).(*models.ActiveOrg); ok && activeOrg.ID != orgID {
+			l.Debug().Str("activeOrgID", activeOrg.ID).Msg("Token scoped to another organisation")
+			return fiber.ErrForbidden
+		}
+
+		if principal.Type == models.PrincipalTypeAPIKey {
+			return h.verifyAPIKeyPermissions(c, l, orgID, permission)
+		}
+
+		org, err := h.db.GetOrgByID(c.Context(), orgID, principal.ID)
+		if err != nil {
+			l.Error().Err(err).Msg("Error getting organisation")
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+
+		var member *models.OrganisationUser
+		if org != nil {
+			member = org.FindUser(principal.ID)
+		}
+		if member == nil {
+			l.Debug().Msg("User is not a member of the organisation")
+			return fiber.ErrForbidden
+		}
+
+		if !rbac.HasPermission(org, member.Role, permission) {
+			l.Debug().Str("role", member.Role).Msg("Role does not grant permission")
+			return fiber.ErrForbidden
+		}
+
+		c.Locals(orgContextKey, org)
+		c.Locals(orgUserContextKey, member)
+
+		return c.Next()
+	}
+}
+
+// VerifyTeamPermissions checks the user's permission in the team. This must
+// run after VerifyRBACPermissions so the organisation is loaded.
+func (h *handler) VerifyTeamPermissions(permission rbac.Permission) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		teamID := c.Params("teamID")
+		org := c.Locals(orgContextKey).(*models.Organisation)
+		principal := c.Locals(principalContextKey).(*models.Principal)
+		log := c.Locals("logger").(zerolog.Logger)
+
+		l := log.With().Str("teamID", teamID).Str("permission", string(permission)).Logger()
+
+		team := org.FindTeam(teamID)
+		if team == nil {
+			l.Debug().Msg("Team not found")
+			return fiber.ErrNotFound
+		}
+
+		var permissions []rbac.Permission
+		if principal.Type == models.PrincipalTypeAPIKey {
+			permissions = rbac.APIKeyTeamPermissions(rbac.APIKeyScopes(org, principal.APIKey))
+		} else {
+			permissions = rbac.TeamPermissions(org, team, principal.ID)
+		}
+
+		if !slices.Contains(permissions, permission) {
+			l.Debug().Msg("Principal does not have team permission")
+			return fiber.ErrForbidden
+		}
+
+		c.Locals(teamContextKey, team)
+
+		return c.Next()
+	}
 }
 
 // Verifies the user's identity - errors with 401
@@ -76,6 +161,16 @@ func (h *handler) VerifyUser(isOptional ...bool) func(*fiber.Ctx) error {
 			tokenLookup = "query:" + userAuthQueryString
 		}
 
+		// Optional routes start a login session, so only accept a user's token
+		if !isOptional[0] {
+			switch key := prefixedTokenFromRequest(c); {
+			case strings.HasPrefix(key, models.APIKeyPrefix):
+				return h.authenticateAPIKey(c, key)
+			case strings.HasPrefix(key, models.PersonalAccessTokenPrefix):
+				return h.authenticatePersonalAccessToken(c, key)
+			}
+		}
+
 		return jwtware.New(jwtware.Config{
 			ContextKey:     jwtContextKey,
 			ErrorHandler:   h.authErrorHandler(isOptional[0]),
@@ -86,6 +181,178 @@ func (h *handler) VerifyUser(isOptional ...bool) func(*fiber.Ctx) error {
 	}
 }
 
+// RequireAdmin rejects requests not made by one of the server's admins. This
+// must run after VerifyUser and RequireSession.
+func (h *handler) RequireAdmin(c *fiber.Ctx) error {
+	if user, ok := c.Locals(userContextKey).(*models.User); !ok || !slices.Contains(h.config.Admins, user.ID) {
+		log.Debug().Msg("Route requires an admin")
+		return fiber.NewError(fiber.StatusForbidden, "Route requires an admin")
+	}
+
+	return c.Next()
+}
+
+// RequireUser rejects requests not made by a user, such as those using an API
+// key. This must run after VerifyUser.
+func (h *handler) RequireUser(c *fiber.Ctx) error {
+	if _, ok := c.Locals(userContextKey).(*models.User); !ok {
+		log.Debug().Msg("Route requires a user")
+		return fiber.NewError(fiber.StatusForbidden, "Route requires a user")
+	}
+
+	return c.Next()
+}
+
+// VerifySCIM checks the request is made with an API key that has the SCIM
+// scope and loads the key's organisation. This must run after VerifyUser.
+func (h *handler) VerifySCIM(c *fiber.Ctx) error {
+	principal := c.Locals(principalContextKey).(*models.Principal)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if principal.Type != models.PrincipalTypeAPIKey || !principal.HasScope(string(rbac.PermissionOrgSCIM)) {
+		log.Debug().Msg("SCIM requires an API key with the SCIM scope")
+		return scimErrorResponse(c, fiber.StatusForbidden, "", "Requires an API key with the "+string(rbac.PermissionOrgSCIM)+" scope")
+	}
+
+	org, err := h.db.GetOrgByIDUnscoped(c.Context(), principal.APIKey.OrgID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting organisation")
+		return scimErrorResponse(c, fiber.StatusInternalServerError, "", err.Error())
+	}
+	if org == nil {
+		log.Debug().Msg("Organisation not found")
+		return scimErrorResponse(c, fiber.StatusForbidden, "", "Organisation not found")
+	}
+	if !slices.Contains(rbac.APIKeyScopes(org, principal.APIKey), string(rbac.PermissionOrgSCIM)) {
+		log.Debug().Str("createdBy", principal.APIKey.CreatedBy).Msg("API key creator no longer has the SCIM permission")
+		return scimErrorResponse(c, fiber.StatusForbidden, "", "API key creator no longer has the "+string(rbac.PermissionOrgSCIM)+" permission")
+	}
+
+	c.Locals(orgContextKey, org)
+
+	return c.Next()
+}
+
+// RequireScope limits personal access tokens and OAuth clients to their
+// scopes. The read scope is needed for safe methods and the write scope for
+// everything else. Other principals are unaffected.
+func (h *handler) RequireScope(read, write string) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		scope := write
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			scope = read
+		}
+
+		return h.requireScope(c, scope)
+	}
+}
+
+// RequireScopeForAllMethods limits personal access tokens and OAuth clients
+// to routes that need the same scope whatever the method. Other principals are
+// unaffected.
+func (h *handler) RequireScopeForAllMethods(scope string) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return h.requireScope(c, scope)
+	}
+}
+
+// RequireUserInfoScope lets OAuth clients granted the openid scope read the
+// user's claims. Everyone else is checked by RequireScope. This must run after
+// VerifyUser.
+func (h *handler) RequireUserInfoScope(c *fiber.Ctx) error {
+	principal := c.Locals(principalContextKey).(*models.Principal)
+	if principal.Type != models.PrincipalTypeOAuthClient {
+		return h.RequireScope(models.ScopeReadUser, models.ScopeWriteUser)(c)
+	}
+
+	if !principal.HasScope(models.OAuthScopeOpenID) {
+		log.Debug().Str("clientID", principal.ClientID).Msg("OAuth client does not have the openid scope")
+		return fiber.NewError(fiber.StatusForbidden, "Token requires the "+models.OAuthScopeOpenID+" scope")
+	}
+
+	return c.Next()
+}
+
+// RequireSession rejects requests not made with a user's session token, such
+// as those using a personal access token, an OAuth client's token or an API
+// key. This must run after VerifyUser.
+func (h *handler) RequireSession(c *fiber.Ctx) error {
+	if principal := c.Locals(principalContextKey).(*models.Principal); principal.Type != models.PrincipalTypeUser {
+		log.Debug().Msg("Route requires a session")
+		return fiber.NewError(fiber.StatusForbidden, "Route requires a session")
+	}
+
+	return c.Next()
+}
+
+func (h *handler) requireScope(c *fiber.Ctx, scope string) error {
+	principal := c.Locals(principalContextKey).(*models.Principal)
+	if principal.Type != models.PrincipalTypePersonalAccessToken && principal.Type != models.PrincipalTypeOAuthClient {
+		return c.Next()
+	}
+
+	if !principal.HasScope(scope) {
+		log.Debug().Str("scope", scope).Str("principalType", string(principal.Type)).Msg("Token does not have scope")
+		return fiber.NewError(fiber.StatusForbidden, "Token requires the "+scope+" scope")
+	}
+
+	return c.Next()
+}
+
+func (h *handler) authenticateAPIKey(c *fiber.Ctx, key string) error {
+	apiKey, err := h.apiKeysStore.Authenticate(c.Context(), key)
+	if err != nil {
+		log.Error().Err(err).Msg("Error authenticating api key")
+		return fiber.ErrUnauthorized
+	}
+	if apiKey == nil {
+		log.Debug().Msg("Invalid or expired api key")
+		return fiber.ErrUnauthorized
+	}
+
+	log.Debug().Str("apiKeyId", apiKey.ID).Msg("API key found and saved to context")
+	c.Locals(principalContextKey, &models.Principal{
+		Type:   models.PrincipalTypeAPIKey,
+		ID:     apiKey.ID,
+		APIKey: apiKey,
+	})
+	// API keys are always scoped to their organisation
+	c.Locals(activeOrgContextKey, &models.ActiveOrg{
+		ID:          apiKey.OrgID,
+		Permissions: apiKey.Scopes,
+	})
+
+	return c.Next()
+}
+
+func (h *handler) authenticatePersonalAccessToken(c *fiber.Ctx, key string) error {
+	token, user, err := h.patStore.Authenticate(c.Context(), key)
+	if err != nil {
+		log.Error().Err(err).Msg("Error authenticating personal access token")
+		return fiber.ErrUnauthorized
+	}
+	if token == nil {
+		log.Debug().Msg("Invalid or expired personal access token")
+		return fiber.ErrUnauthorized
+	}
+
+	if user.IsServiceAccount() {
+		log.Debug().Str("tokenId", token.ID).Msg("Service accounts can only use org-scoped tokens")
+		return fiber.NewError(fiber.StatusForbidden, "Service accounts can only be used on their organisation's routes")
+	}
+
+	log.Debug().Str("tokenId", token.ID).Msg("Personal access token found and saved to context")
+	c.Locals(userContextKey, user)
+	c.Locals(principalContextKey, &models.Principal{
+		Type:  models.PrincipalTypePersonalAccessToken,
+		ID:    user.ID,
+		Token: token,
+		User:  user,
+	})
+
+	return c.Next()
+}
+
 func (h *handler) authErrorHandler(isOptional bool) func(c *fiber.Ctx, err error) error {
 	return func(c *fiber.Ctx, err error) error {
 		log.Debug().Err(err).Msg("Error validating user")
@@ -98,61 +365,232 @@ func (h *handler) authSuccessHandler(isOptional bool) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		token := c.Locals(jwtContextKey).(*jwt.Token)
 
-		now := time.Now()
-
-		expiry, err := token.Claims.GetExpirationTime()
+		user, err := h.getUserFromToken(c.Context(), token)
 		if err != nil {
-			log.Debug().Err(err).Msg("Error retrieving expiry from JWT")
-			return h.optionalErrorHandler(c, isOptional)
-		}
-		if expiry == nil || expiry.Before(now) {
-			log.Debug().Msg("Token expiry invalid or expired")
+			if errors.Is(err, errInvalidAuthToken) {
+				log.Debug().Err(err).Msg("Invalid token")
+			} else {
+				log.Error().Err(err).Msg("Error retrieving user by ID")
+			}
 			return h.optionalErrorHandler(c, isOptional)
 		}
 
-		notBefore, err := token.Claims.GetNotBefore()
+		activeOrg, err := h.getActiveOrgFromToken(c.Context(), token, user)
 		if err != nil {
-			log.Debug().Err(err).Msg("Error retrieving not before from JWT")
-			return h.optionalErrorHandler(c, isOptional)
-		}
-		if notBefore == nil || notBefore.After(now) {
-			log.Debug().Msg("Token not before invalid or expired")
+			if errors.Is(err, errInvalidAuthToken) {
+				log.Debug().Err(err).Msg("Invalid token")
+			} else {
+				log.Error().Err(err).Msg("Error retrieving active organisation")
+			}
 			return h.optionalErrorHandler(c, isOptional)
 		}
 
-		issuer, err := token.Claims.GetIssuer()
-		if err != nil {
-			log.Debug().Err(err).Msg("Error retrieving issuer from JWT")
-			return h.optionalErrorHandler(c, isOptional)
-		}
-		if issuer != h.config.JWT.Issuer {
-			log.Debug().Msg("Token issuer invalid")
-			return h.optionalErrorHandler(c, isOptional)
+		if user.IsServiceAccount() && activeOrg == nil {
+			log.Debug().Msg("Service account token not scoped to its organisation")
+			return fiber.NewError(fiber.StatusForbidden, "Service accounts can only be used on their organisation's routes")
 		}
 
-		userID, err := token.Claims.GetSubject()
-		if err != nil {
-			log.Debug().Err(err).Msg("Error retrieving user ID from JWT")
-			return h.optionalErrorHandler(c, isOptional)
+		principal := &models.Principal{
+			Type: models.PrincipalTypeUser,
+			ID:   user.ID,
+			User: user,
 		}
+		if clientID, scopes, ok := oauthClientFromToken(token); ok {
+			// A client can't start a login session on the user's behalf
+			if isOptional {
+				log.Debug().Str("clientID", clientID).Msg("OAuth client token used to start a login session")
+				return h.optionalErrorHandler(c, isOptional)
+			}
 
-		user, err := h.usersStore.GetUserByID(c.Context(), userID)
-		if err != nil {
-			log.Error().Err(err).Msg("Error retrieving user by ID")
-			return h.optionalErrorHandler(c, isOptional)
-		}
-		if user == nil {
-			log.Debug().Msg("No user found")
-			return h.optionalErrorHandler(c, isOptional)
+			principal.Type = models.PrincipalTypeOAuthClient
+			principal.ClientID = clientID
+			principal.Scopes = scopes
 		}
 
-		log.Debug().Msg("User found and saved to context")
+		log.Debug().Str("principalType", string(principal.Type)).Msg("User found and saved to context")
 		c.Locals(userContextKey, user)
+		c.Locals(principalContextKey, principal)
+
+		if activeOrg != nil {
+			if !isOrgRoute(c.Path(), activeOrg.ID) {
+				log.Debug().Str("orgID", activeOrg.ID).Msg("Token scoped to organisation used outside its routes")
+				return fiber.NewError(fiber.StatusForbidden, "Token is scoped to an organisation")
+			}
+
+			log.Debug().Str("orgID", activeOrg.ID).Msg("Token scoped to organisation")
+			c.Locals(activeOrgContextKey, activeOrg)
+		}
 
 		return c.Next()
 	}
 }
 
+func (h *handler) verifyAPIKeyPermissions(c *fiber.Ctx, l zerolog.Logger, orgID string, permission rbac.Permission) error {
+	principal := c.Locals(principalContextKey).(*models.Principal)
+
+	if !principal.HasScope(string(permission)) {
+		l.Debug().Msg("API key does not have scope")
+		return fiber.ErrForbidden
+	}
+
+	org, err := h.db.GetOrgByIDUnscoped(c.Context(), orgID)
+	if err != nil {
+		l.Error().Err(err).Msg("Error getting organisation")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if org == nil {
+		l.Debug().Msg("Organisation not found")
+		return fiber.ErrForbidden
+	}
+
+	// Keys are limited to what their creator can still do
+	if !slices.Contains(rbac.APIKeyScopes(org, principal.APIKey), string(permission)) {
+		l.Debug().Str("createdBy", principal.APIKey.CreatedBy).Msg("API key creator does not have permission")
+		return fiber.ErrForbidden
+	}
+
+	c.Locals(orgContextKey, org)
+
+	return c.Next()
+}
+
+// Org-scoped tokens are only valid while the user is a member. The role and
+// permissions are those at the time of the request, not when the token was issued.
+func (h *handler) getActiveOrgFromToken(ctx context.Context, token *jwt.Token, user *models.User) (*models.ActiveOrg, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, nil
+	}
+
+	orgID, _ := claims["org_id"].(string)
+	if orgID == "" {
+		return nil, nil
+	}
+
+	activeOrg, err := h.orgsStore.ActiveOrg(ctx, orgID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if activeOrg == nil {
+		return nil, fmt.Errorf("%w: not a member of the token organisation", errInvalidAuthToken)
+	}
+
+	return activeOrg, nil
+}
+
+// Validates the claims of a parsed auth token and returns the user it was issued to
+func (h *handler) getUserFromToken(ctx context.Context, token *jwt.Token) (*models.User, error) {
+	now := time.Now()
+
+	expiry, err := token.Claims.GetExpirationTime()
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving expiry: %w", errInvalidAuthToken, err)
+	}
+	if expiry == nil || expiry.Before(now) {
+		return nil, fmt.Errorf("%w: expiry invalid or expired", errInvalidAuthToken)
+	}
+
+	notBefore, err := token.Claims.GetNotBefore()
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving not before: %w", errInvalidAuthToken, err)
+	}
+	if notBefore == nil || notBefore.After(now) {
+		return nil, fmt.Errorf("%w: not before invalid or expired", errInvalidAuthToken)
+	}
+
+	// Other signed values, such as the login state, have an audience
+	audience, err := token.Claims.GetAudience()
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving audience: %w", errInvalidAuthToken, err)
+	}
+	if len(audience) > 0 {
+		return nil, fmt.Errorf("%w: not an auth token", errInvalidAuthToken)
+	}
+
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving issuer: %w", errInvalidAuthToken, err)
+	}
+	if issuer != h.config.JWT.Issuer {
+		return nil, fmt.Errorf("%w: issuer invalid", errInvalidAuthToken)
+	}
+
+	userID, err := token.Claims.GetSubject()
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving user id: %w", errInvalidAuthToken, err)
+	}
+
+	user, err := h.usersStore.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: no user found", errInvalidAuthToken)
+	}
+	if !user.IsActive {
+		return nil, fmt.Errorf("%w: user is deactivated", errInvalidAuthToken)
+	}
+
+	issuedAt, err := token.Claims.GetIssuedAt()
+	if err != nil {
+		return nil, fmt.Errorf("%w: error retrieving issued at: %w", errInvalidAuthToken, err)
+	}
+	if issuedAt == nil || user.IsTokenRevoked(issuedAt.Time) {
+		return nil, fmt.Errorf("%w: token revoked", errInvalidAuthToken)
+	}
+
+	return user, nil
+}
+
+// Tokens issued to an OAuth client record the client and the scopes the user
+// granted it
+func oauthClientFromToken(token *jwt.Token) (clientID string, scopes []string, ok bool) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", nil, false
+	}
+
+	clientID, _ = claims["client_id"].(string)
+	if clientID == "" {
+		return "", nil, false
+	}
+
+	scope, _ := claims["scope"].(string)
+
+	return clientID, strings.Fields(scope), true
+}
+
+// Org-scoped tokens can only be used on their organisation's routes. Routing is
+// case-insensitive, so the path is too.
+func isOrgRoute(path, orgID string) bool {
+	prefix := "/v1/orgs/" + strings.ToLower(orgID)
+	path = strings.ToLower(path)
+
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// API keys and personal access tokens are sent in place of the auth token
+func prefixedTokenFromRequest(c *fiber.Ctx) string {
+	token := c.Query(userAuthQueryString)
+	if token == "" {
+		token = strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	}
+
+	return token
+}
+
+// Parses the auth token string and verifies the signature
+func (h *handler) parseAuthToken(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
+		return h.config.JWT.Key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidAuthToken, err)
+	}
+
+	return token, nil
+}
+
 func (h *handler) optionalErrorHandler(c *fiber.Ctx, isOptional bool) error {
 	if isOptional {
 		return c.Next()
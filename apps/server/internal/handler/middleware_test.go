@@ -0,0 +1,112 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2/middleware/encryptcookie"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/server"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// Only the driver methods the middleware needs are implemented - anything
+// else panics
+type fakeDriver struct {
+	database.Driver
+
+	users map[string]*models.User
+}
+
+func (f *fakeDriver) GetUserByID(_ context.Context, userID string) (*models.User, error) {
+	return f.users[userID], nil
+}
+
+func TestOAuthClientTokenIsLimitedToUserInfo(t *testing.T) {
+	cfg := &config.ServerConfig{
+		JWT: config.JWT{
+			ExpiresIn: config.Duration{Duration: time.Hour},
+			Issuer:    "opensesame-test",
+			Key:       []byte("test-signing-key"),
+		},
+		Server: config.Server{
+			Cookie: config.ServerCookie{Key: encryptcookie.GenerateKey()},
+		},
+	}
+
+	user := &models.User{
+		ID:       "507f1f77bcf86cd799439011",
+		IsActive: true,
+	}
+	db := &fakeDriver{
+		users: map[string]*models.User{user.ID: user},
+	}
+
+	app := server.App()
+	New(cfg, db, nil).Register(app)
+
+	openIDToken, err := user.GenerateOAuthAccessToken(cfg, "example-app", models.OAuthScopeOpenID)
+	if err != nil {
+		t.Fatalf("error generating token: %s", err)
+	}
+	profileToken, err := user.GenerateOAuthAccessToken(cfg, "example-app", models.OAuthScopeProfile)
+	if err != nil {
+		t.Fatalf("error generating token: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{name: "userinfo", method: "GET", path: "/v1/userinfo", token: openIDToken, status: 200},
+		{name: "userinfo without openid", method: "GET", path: "/v1/userinfo", token: profileToken, status: 403},
+		{name: "get user", method: "GET", path: "/v1/user", token: openIDToken, status: 403},
+		{name: "delete user", method: "DELETE", path: "/v1/user", token: openIDToken, status: 403},
+		{name: "deactivate user", method: "POST", path: "/v1/user/deactivate", token: openIDToken, status: 403},
+		{name: "merge users", method: "POST", path: "/v1/user/merge", token: openIDToken, status: 403},
+		{name: "provider token", method: "GET", path: "/v1/user/provider/github/token", token: openIDToken, status: 403},
+		{name: "list tokens", method: "GET", path: "/v1/user/tokens", token: openIDToken, status: 403},
+		{name: "exchange token", method: "POST", path: "/v1/token/exchange", token: openIDToken, status: 403},
+		{name: "list orgs", method: "GET", path: "/v1/orgs", token: openIDToken, status: 403},
+		{name: "get org", method: "GET", path: "/v1/orgs/507f1f77bcf86cd799439012", token: openIDToken, status: 403},
+		{name: "admin", method: "POST", path: "/v1/admin/users/507f1f77bcf86cd799439012/deactivate", token: openIDToken, status: 403},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("error making request: %s", err)
+			}
+
+			if res.StatusCode != test.status {
+				t.Errorf("expected status %d, got %d", test.status, res.StatusCode)
+			}
+		})
+	}
+}
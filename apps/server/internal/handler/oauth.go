@@ -0,0 +1,517 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/providers"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+const (
+	oauthAuthorizeCookieExpiry  = time.Minute * 10
+	oauthGrantAuthorizationCode = "authorization_code"
+	oauthGrantClientCredentials = "client_credentials"
+	oauthResponseTypeCode       = "code"
+)
+
+var oauthScopesSupported = []string{
+	models.OAuthScopeOpenID,
+	models.OAuthScopeProfile,
+	models.OAuthScopeEmail,
+	models.OAuthScopeOrgs,
+}
+
+// OAuth discovery godoc
+// @Summary		OpenID Connect discovery
+// @Description OpenID Connect discovery document
+// @Tags		OAuth
+// @Produce		json
+// @Success		200	{object}	models.OpenIDConfiguration
+// @Router		/.well-known/openid-configuration [get]
+func (h *handler) OAuthDiscovery(c *fiber.Ctx) error {
+	issuer := h.config.OAuth.Issuer
+
+	return c.JSON(models.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/v1/oauth/authorize",
+		TokenEndpoint:                     issuer + "/v1/oauth/token",
+		UserInfoEndpoint:                  issuer + "/v1/userinfo",
+		IntrospectionEndpoint:             issuer + "/v1/oauth/introspect",
+		JWKSURI:                           issuer + "/v1/oauth/jwks",
+		ResponseTypesSupported:            []string{oauthResponseTypeCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   oauthScopesSupported,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		GrantTypesSupported:               []string{oauthGrantAuthorizationCode, oauthGrantClientCredentials},
+		CodeChallengeMethodsSupported:     []string{models.PKCEMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "picture", "email", "orgs"},
+	})
+}
+
+// OAuth authorize godoc
+// @Summary		Authorize
+// @Description OpenID Connect authorization endpoint. Redirects to the provider login if the user is not authenticated.
+// @Tags		OAuth
+// @Param		client_id				query	string	true	"Client ID"
+// @Param		redirect_uri			query	string	true	"Redirect URI"
+// @Param		response_type			query	string	true	"Response type"	default(code)
+// @Param		scope					query	string	true	"Scopes"	default(openid)
+// @Param		state					query	string	false	"State"
+// @Param		nonce					query	string	false	"Nonce"
+// @Param		code_challenge			query	string	false	"PKCE code challenge - required for public clients"
+// @Param		code_challenge_method	query	string	false	"PKCE code challenge method"	default(S256)
+// @Param		provider				query	string	false	"Provider to login with - defaults to the first provider"
+// @Response	302	"Redirect to provider login page or client redirect URI"
+// @Failure		400 "Validation error"
+// @Router		/v1/oauth/authorize [get]
+func (h *handler) OAuthAuthorize(c *fiber.Ctx) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	req := new(models.OAuthAuthorizeRequest)
+	if err := c.QueryParser(req); err != nil {
+		log.Debug().Err(err).Msg("Error parsing authorize query")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	client, err := h.validateAuthorizeRequest(c, req)
+	if client == nil || err != nil {
+		return err
+	}
+
+	if u := c.Locals(userContextKey); u != nil {
+		return h.completeAuthorize(c, req, u.(*models.User))
+	}
+
+	providerID := req.Provider
+	if providerID == "" {
+		providerID = h.config.Providers[0].ID
+	}
+	if providers.FindProvider(h.config.Providers, providerID) == nil {
+		return redirectWithOAuthError(c, req, "invalid_request", "Unknown provider")
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		log.Error().Err(err).Msg("Error marshalling authorize request")
+		return fiber.ErrInternalServerError
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthAuthorizeCookieKey,
+		Value:    string(data),
+		Expires:  time.Now().Add(oauthAuthorizeCookieExpiry),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	q := url.Values{}
+	q.Set("callback", h.oauthAuthorizeCallbackURL())
+	q.Set("delivery", string(config.TokenDeliveryCode))
+
+	log.Debug().Str("providerID", providerID).Msg("User not logged in - redirecting to provider")
+
+	return c.Redirect(fmt.Sprintf("/v1/providers/%s/login?%s", url.PathEscape(providerID), q.Encode()))
+}
+
+// OAuth authorize callback godoc
+// @Summary		Authorize callback
+// @Description Receives the user from the provider login and completes the authorization request
+// @Tags		OAuth
+// @Param		code	query	string	true	"One-time login code"
+// @Response	302	"Redirect to client redirect URI"
+// @Failure		400 "Validation error"
+// @Router		/v1/oauth/authorize/callback [get]
+func (h *handler) OAuthAuthorizeCallback(c *fiber.Ctx) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	data := c.Cookies(oauthAuthorizeCookieKey)
+	c.Cookie(&fiber.Cookie{
+		Name:    oauthAuthorizeCookieKey,
+		Expires: time.Now().Add(-time.Hour * 24),
+		Value:   "",
+	})
+	if data == "" {
+		log.Debug().Msg("No authorize request found")
+		return fiber.NewError(fiber.StatusBadRequest, "No authorization request in progress")
+	}
+
+	req := new(models.OAuthAuthorizeRequest)
+	if err := json.Unmarshal([]byte(data), req); err != nil {
+		log.Debug().Err(err).Msg("Error parsing authorize request cookie")
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid authorization request")
+	}
+
+	// Validate again as the registered clients may have changed
+	client, err := h.validateAuthorizeRequest(c, req)
+	if client == nil || err != nil {
+		return err
+	}
+
+	loginCode, err := h.oauthStore.ExchangeLoginCode(c.Context(), c.Query("code"), h.oauthAuthorizeCallbackURL())
+	if err != nil {
+		log.Debug().Err(err).Msg("Error exchanging login code")
+		return redirectWithOAuthError(c, req, "access_denied", "")
+	}
+
+	user, err := h.usersStore.GetUserByID(c.Context(), loginCode.UserID)
+	if err != nil || user == nil || !user.IsActive {
+		log.Debug().Err(err).Msg("Error getting logged in user")
+		return redirectWithOAuthError(c, req, "access_denied", "")
+	}
+
+	return h.completeAuthorize(c, req, user)
+}
+
+// OAuth JWKS godoc
+// @Summary		JSON Web Key Set
+// @Description Public keys used to verify the ID tokens
+// @Tags		OAuth
+// @Produce		json
+// @Success		200	{object}	models.JSONWebKeySet
+// @Router		/v1/oauth/jwks [get]
+func (h *handler) OAuthJWKS(c *fiber.Ctx) error {
+	return c.JSON(h.oauthStore.JWKS())
+}
+
+// OAuth token godoc
+// @Summary		Token
+// @Description Exchange an authorization code for tokens or authenticate a service account with its client credentials
+// @Tags		OAuth
+// @Accept		x-www-form-urlencoded
+// @Produce		json
+// @Param		grant_type		formData	string	true	"Grant type"	Enums(authorization_code, client_credentials)
+// @Param		code			formData	string	false	"Authorization code"
+// @Param		redirect_uri	formData	string	false	"Redirect URI"
+// @Param		client_id		formData	string	false	"Client ID - if not using basic auth"
+// @Param		client_secret	formData	string	false	"Client secret - if not using basic auth"
+// @Param		code_verifier	formData	string	false	"PKCE code verifier"
+// @Success		200	{object}	models.OAuthTokenResponse
+// @Failure		400	{object}	models.OAuthError
+// @Failure		401	{object}	models.OAuthError
+// @Router		/v1/oauth/token [post]
+func (h *handler) OAuthToken(c *fiber.Ctx) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	switch grantType := c.FormValue("grant_type"); {
+	case grantType == oauthGrantAuthorizationCode && h.config.OAuth != nil:
+		return h.oauthAuthorizationCodeGrant(c)
+	case grantType == oauthGrantClientCredentials:
+		return h.oauthClientCredentialsGrant(c)
+	default:
+		log.Debug().Str("grantType", grantType).Msg("Unsupported grant type")
+		return oauthErrorResponse(c, fiber.StatusBadRequest, "unsupported_grant_type")
+	}
+}
+
+func (h *handler) oauthAuthorizationCodeGrant(c *fiber.Ctx) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	clientID, clientSecret := oauthClientCredentials(c)
+	client, err := h.oauthStore.AuthenticateClient(clientID, clientSecret)
+	if err != nil {
+		log.Debug().Err(err).Str("clientID", clientID).Msg("Error authenticating client")
+		return oauthErrorResponse(c, fiber.StatusUnauthorized, "invalid_client")
+	}
+
+	authCode, err := h.oauthStore.ExchangeAuthorizationCode(
+		c.Context(),
+		client,
+		c.FormValue("code"),
+		c.FormValue("redirect_uri"),
+		c.FormValue("code_verifier"),
+	)
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidGrant) {
+			log.Debug().Err(err).Msg("Invalid authorization code")
+			return oauthErrorResponse(c, fiber.StatusBadRequest, "invalid_grant")
+		}
+		log.Error().Err(err).Msg("Error exchanging authorization code")
+		return fiber.ErrInternalServerError
+	}
+
+	user, err := h.usersStore.GetUserByID(c.Context(), authCode.UserID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting user")
+		return fiber.ErrInternalServerError
+	}
+	if user == nil || !user.IsActive {
+		return oauthErrorResponse(c, fiber.StatusBadRequest, "invalid_grant")
+	}
+
+	accessToken, err := user.GenerateOAuthAccessToken(h.config, client.ID, authCode.Scope)
+	if err != nil {
+		log.Error().Err(err).Msg("Error generating access token")
+		return fiber.ErrInternalServerError
+	}
+
+	idToken, err := h.oauthStore.GenerateIDToken(c.Context(), user, authCode)
+	if err != nil {
+		log.Error().Err(err).Msg("Error generating id token")
+		return fiber.ErrInternalServerError
+	}
+
+	return c.JSON(models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(h.config.JWT.ExpiresIn.Seconds()),
+		IDToken:     idToken,
+		Scope:       authCode.Scope,
+		TokenType:   "Bearer",
+	})
+}
+
+// OAuth introspect godoc
+// @Summary		Introspect
+// @Description Validate a token issued by Open Sesame, as defined in RFC 7662. Invalid tokens are reported as inactive.
+// @Tags		OAuth
+// @Accept		x-www-form-urlencoded
+// @Produce		json
+// @Param		token			formData	string	true	"Token to introspect"
+// @Param		token_type_hint	formData	string	false	"Token type hint"	default(access_token)
+// @Param		client_id		formData	string	false	"Client ID - if not using basic auth"
+// @Param		client_secret	formData	string	false	"Client secret - if not using basic auth"
+// @Success		200	{object}	models.OAuthIntrospectionResponse
+// @Failure		401	{object}	models.OAuthError
+// @Router		/v1/oauth/introspect [post]
+func (h *handler) OAuthIntrospect(c *fiber.Ctx) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	clientID, clientSecret := oauthClientCredentials(c)
+	client, err := h.oauthStore.AuthenticateClient(clientID, clientSecret)
+	if err != nil || client.Secret == "" {
+		// Public clients cannot keep a secret so cannot introspect
+		log.Debug().Err(err).Str("clientID", clientID).Msg("Error authenticating client")
+		return oauthErrorResponse(c, fiber.StatusUnauthorized, "invalid_client")
+	}
+
+	inactive := models.OAuthIntrospectionResponse{Active: false}
+
+	token, err := h.parseAuthToken(c.FormValue("token"))
+	if err != nil {
+		log.Debug().Err(err).Msg("Token failed parsing")
+		return c.JSON(inactive)
+	}
+
+	user, err := h.getUserFromToken(c.Context(), token)
+	if err != nil {
+		if !errors.Is(err, errInvalidAuthToken) {
+			log.Error().Err(err).Msg("Error validating token")
+			return fiber.ErrInternalServerError
+		}
+		log.Debug().Err(err).Msg("Token invalid")
+		return c.JSON(inactive)
+	}
+
+	orgs, err := h.oauthStore.ListOrganisationClaims(c.Context(), user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing user's organisations")
+		return fiber.ErrInternalServerError
+	}
+
+	res := models.OAuthIntrospectionResponse{
+		Active:    true,
+		Issuer:    h.config.JWT.Issuer,
+		Orgs:      orgs,
+		Subject:   user.ID,
+		TokenType: "Bearer",
+		Username:  user.Name,
+	}
+	// Only tokens issued to an OAuth client have a client and scope
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		res.ClientID, _ = claims["client_id"].(string)
+		res.Scope, _ = claims["scope"].(string)
+	}
+	if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil {
+		res.ExpiresAt = exp.Unix()
+	}
+	if iat, err := token.Claims.GetIssuedAt(); err == nil && iat != nil {
+		res.IssuedAt = iat.Unix()
+	}
+	if nbf, err := token.Claims.GetNotBefore(); err == nil && nbf != nil {
+		res.NotBefore = nbf.Unix()
+	}
+
+	return c.JSON(res)
+}
+
+// Issue the authorization code and send the user back to the client
+func (h *handler) completeAuthorize(c *fiber.Ctx, req *models.OAuthAuthorizeRequest, user *models.User) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	code, err := h.oauthStore.CreateAuthorizationCode(c.Context(), &models.AuthorizationCode{
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		UserID:              user.ID,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            time.Now(),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating authorization code")
+		return redirectWithOAuthError(c, req, "server_error", "")
+	}
+
+	log.Info().Str("clientID", req.ClientID).Str("userID", user.ID).Msg("Authorization code issued")
+
+	return redirectWithOAuthParams(c, req, url.Values{"code": []string{code}})
+}
+
+// The provider login sends the user back here to complete the authorize request
+func (h *handler) oauthAuthorizeCallbackURL() string {
+	return h.config.OAuth.Issuer + "/v1/oauth/authorize/callback"
+}
+
+// Validates the authorize request. If the client or redirect URI is
+// invalid, the error is displayed to the user - other errors are sent
+// to the client's redirect URI. A nil client means the request has been
+// handled.
+func (h *handler) validateAuthorizeRequest(c *fiber.Ctx, req *models.OAuthAuthorizeRequest) (*config.OAuthClient, error) {
+	client := h.config.OAuth.FindClient(req.ClientID)
+	if client == nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Unknown client")
+	}
+	if !client.IsRedirectURIAllowed(req.RedirectURI) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Redirect URI not registered for client")
+	}
+
+	if req.ResponseType != oauthResponseTypeCode {
+		return nil, redirectWithOAuthError(c, req, "unsupported_response_type", "")
+	}
+	if !slices.Contains(strings.Fields(req.Scope), models.OAuthScopeOpenID) {
+		return nil, redirectWithOAuthError(c, req, "invalid_scope", "The openid scope is required")
+	}
+	if req.CodeChallenge == "" && client.Secret == "" {
+		return nil, redirectWithOAuthError(c, req, "invalid_request", "Public clients must use PKCE")
+	}
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != models.PKCEMethodS256 {
+		return nil, redirectWithOAuthError(c, req, "invalid_request", "Transform algorithm not supported")
+	}
+
+	return client, nil
+}
+
+// Service accounts authenticate with their own client credentials rather than
+// those of a configured OAuth client. The token is scoped to their organisation.
+func (h *handler) oauthClientCredentialsGrant(c *fiber.Ctx) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	clientID, clientSecret := oauthClientCredentials(c)
+	user, err := h.usersStore.AuthenticateServiceAccount(c.Context(), clientID, clientSecret)
+	if err != nil {
+		log.Error().Err(err).Msg("Error authenticating service account")
+		return fiber.ErrInternalServerError
+	}
+	if user == nil {
+		log.Debug().Str("clientID", clientID).Msg("Invalid service account credentials")
+		return oauthErrorResponse(c, fiber.StatusUnauthorized, "invalid_client")
+	}
+
+	// Service accounts can only act within their organisation
+	activeOrg, err := h.orgsStore.ActiveOrg(c.Context(), user.ServiceAccount.OrgID, user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting service account organisation")
+		return fiber.ErrInternalServerError
+	}
+	if activeOrg == nil {
+		log.Debug().Str("clientID", clientID).Msg("Service account is not a member of its organisation")
+		return oauthErrorResponse(c, fiber.StatusUnauthorized, "invalid_client")
+	}
+
+	accessToken, err := user.GenerateOrgAuthToken(h.config, activeOrg)
+	if err != nil {
+		log.Error().Err(err).Msg("Error generating access token")
+		return fiber.ErrInternalServerError
+	}
+
+	return c.JSON(models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(h.config.JWT.ExpiresIn.Seconds()),
+		TokenType:   "Bearer",
+	})
+}
+
+// Get the client credentials from either the basic auth header or the form body
+func oauthClientCredentials(c *fiber.Ctx) (clientID, clientSecret string) {
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Basic ") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+		if err == nil {
+			if id, secret, ok := strings.Cut(string(decoded), ":"); ok {
+				// Credentials are form encoded before being put in the header
+				id, _ = url.QueryUnescape(id)
+				secret, _ = url.QueryUnescape(secret)
+				return id, secret
+			}
+		}
+	}
+
+	return c.FormValue("client_id"), c.FormValue("client_secret")
+}
+
+func oauthErrorResponse(c *fiber.Ctx, status int, code string) error {
+	return c.Status(status).JSON(models.OAuthError{
+		Error: code,
+	})
+}
+
+func redirectWithOAuthError(c *fiber.Ctx, req *models.OAuthAuthorizeRequest, code, description string) error {
+	q := url.Values{}
+	q.Set("error", code)
+	if description != "" {
+		q.Set("error_description", description)
+	}
+
+	return redirectWithOAuthParams(c, req, q)
+}
+
+func redirectWithOAuthParams(c *fiber.Ctx, req *models.OAuthAuthorizeRequest, params url.Values) error {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid redirect URI")
+	}
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	return c.Redirect(u.String())
+}
@@ -23,7 +23,6 @@ import (
 	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 )
 
 type OrgGetResponse struct {
@@ -32,7 +31,7 @@ type OrgGetResponse struct {
 
 // Create organisation godoc
 // @Summary		Create organisation
-// @Description Create new organisation
+// @Description Create new organisation, owned by the logged-in user. Other users are added once it exists.
 // @Tags		Organisations
 // @Accept		json
 // @Produce		json
@@ -56,24 +55,21 @@ func (h *handler) OrganisationCreate(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
 
-	// Ensure current user is org maintainer
-	hasCurrentUser := false
-	for key, value := range org.Users {
-		if value.UserID == user.ID {
-			hasCurrentUser = true
-			// Force maintainer role
-			// @todo(sje): ensure correct role
-			org.Users[key].Role = "ORG_MAINTAINER"
+	// Other users must be added once the organisation exists, so they get
+	// the same checks as any other new member
+	for _, u := range org.Users {
+		if u.UserID != user.ID {
+			log.Debug().Str("userID", u.UserID).Msg("Other users cannot be added when creating an organisation")
+			return fiber.NewError(fiber.StatusBadRequest, "Only the current user can be added when creating an organisation")
 		}
 	}
-	if !hasCurrentUser {
-		// Current user not present
-		log.Debug().Str("userID", user.ID).Msg("Adding current user to organisation")
-		org.Users = append(org.Users, &models.OrgUserDTO{
+
+	// Ensure current user is org owner
+	org.Users = []*models.OrgUserDTO{
+		{
 			UserID: user.ID,
-			// @todo(sje): ensure correct role
-			Role: "ORG_MAINTAINER",
-		})
+			Role:   models.OrgRoleOwner,
+		},
 	}
 
 	// Validate the organisation
@@ -92,7 +88,10 @@ func (h *handler) OrganisationCreate(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Slug in use")
 	}
 
-	organisation, err := h.db.SaveOrganisationRecord(c.Context(), org.ToModel())
+	model := org.ToModel()
+	model.OwnerID = user.ID
+
+	organisation, err := h.db.SaveOrganisationRecord(c.Context(), model)
 	if err != nil {
 		return err
 	}
@@ -100,6 +99,32 @@ func (h *handler) OrganisationCreate(c *fiber.Ctx) error {
 	return c.JSON(organisation)
 }
 
+// Leave organisation godoc
+// @Summary		Leave organisation
+// @Description Remove the logged-in user from the organisation. The last owner cannot leave.
+// @Tags		Organisations
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Success		204	"No response"
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/leave [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) OrganisationLeave(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.orgsStore.LeaveOrganisation(c.Context(), org, user.ID); err != nil {
+		return orgUserError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 // List organisations godoc
 // @Summary		List organisations
 // @Description List all organisations for the user
@@ -140,7 +165,7 @@ func (h *handler) OrganisationList(c *fiber.Ctx) error {
 
 // Delete organisation godoc
 // @Summary		Delete organisation
-// @Description Delete organisation
+// @Description Delete organisation. Only the owner can do this. It can be restored until the retention period ends.
 // @Tags		Organisations
 // @Accept		json
 // @Produce		json
@@ -148,19 +173,20 @@ func (h *handler) OrganisationList(c *fiber.Ctx) error {
 // @Success		204	"No response"
 // @Failure		400 "Validation error"
 // @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
 // @Router		/v1/orgs/{orgID} [delete]
 // @Security	Bearer
 // @Security	Token
 func (h *handler) OrganisationDelete(c *fiber.Ctx) error {
-	orgID := c.Params("orgID")
+	org := c.Locals(orgContextKey).(*models.Organisation)
 	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
 
-	if err := h.db.DeleteOrganisation(c.Context(), orgID, user.ID); err != nil {
-		log.Error().Err(err).Msg("Error deleting organisation")
+	if err := h.orgsStore.DeleteOrganisation(c.Context(), org, user.ID); err != nil {
 		if errors.Is(err, common.ErrNotDeleted) {
 			return fiber.ErrNotFound
 		}
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		return orgUserError(log, err)
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
@@ -168,32 +194,69 @@ func (h *handler) OrganisationDelete(c *fiber.Ctx) error {
 
 // Get organisation godoc
 // @Summary		Get organisation
-// @Description Get organisation
+// @Description Get organisation. Deactivated users are hidden.
 // @Tags		Organisations
 // @Accept		json
 // @Produce		json
 // @Param		orgID	path	string	true	"Organisation ID" example(67e58132a5d5257f95a32518)
 // @Success		200	{object}	OrgGetResponse
 // @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
 // @Router		/v1/orgs/{orgID} [get]
 // @Security	Bearer
 // @Security	Token
 func (h *handler) OrganisationGet(c *fiber.Ctx) error {
-	orgID := c.Params("orgID")
-	user := c.Locals(userContextKey).(*models.User)
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
 
-	org, err := h.db.GetOrgByID(c.Context(), orgID, user.ID)
+	org, err := h.orgsStore.GetOrganisation(c.Context(), org)
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting organisation")
 		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
-	if org == nil {
-		return fiber.ErrNotFound
-	}
 
 	return c.JSON(OrgGetResponse{Org: org})
 }
 
+// Add organisation user godoc
+// @Summary		Add organisation user
+// @Description Add an existing user to the organisation
+// @Tags		Organisations
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string				true	"Organisation ID"
+// @Param		user	body	models.OrgUserDTO	true	"Input"
+// @Success		200	{object}	models.OrganisationUser
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/users [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) OrganisationAddUser(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.OrgUserDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Organisation user object invalid")
+		return err
+	}
+
+	member, err := h.orgsStore.AddUser(c.Context(), org, user.ID, input)
+	if err != nil {
+		return orgUserError(log, err)
+	}
+
+	return c.JSON(member)
+}
+
 // List organisation's users godoc
 // @Summary		List organisation's users
 // @Description List all the users attached to an organisation.
@@ -203,6 +266,7 @@ func (h *handler) OrganisationGet(c *fiber.Ctx) error {
 // @Param		orgID	path	string	true	"Organisation ID" example(67e58132a5d5257f95a32518)
 // @Success		200	{object}	models.Pagination[OrganisationUser]
 // @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
 // @Router		/v1/orgs/{orgID}/users [get]
 // @Security	Bearer
 // @Security	Token
@@ -236,24 +300,278 @@ func (h *handler) OrganisationListUsers(c *fiber.Ctx) error {
 	return c.JSON(org)
 }
 
+// Remove organisation user godoc
+// @Summary		Remove organisation user
+// @Description Remove a user from the organisation. The last owner cannot be removed.
+// @Tags		Organisations
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		userID	path	string	true	"User ID"
+// @Success		204	"No response"
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/users/{userID} [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) OrganisationRemoveUser(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.orgsStore.RemoveUser(c.Context(), org, user.ID, c.Params("userID")); err != nil {
+		return orgUserError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Restore organisation godoc
+// @Summary		Restore organisation
+// @Description Restore a deleted organisation. Only the owner can do this, before the retention period ends.
+// @Tags		Organisations
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Success		200	{object}	models.Organisation
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/restore [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) OrganisationRestore(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	org, err := h.orgsStore.RestoreOrganisation(c.Context(), c.Params("orgID"), user.ID)
+	if err != nil {
+		return orgUserError(log, err)
+	}
+	if org == nil {
+		return fiber.ErrNotFound
+	}
+
+	return c.JSON(org)
+}
+
+// Transfer organisation ownership godoc
+// @Summary		Transfer organisation ownership
+// @Description Offer ownership of the organisation to another member. They must accept it before it takes effect.
+// @Tags		Organisations
+// @Accept		json
+// @Produce		json
+// @Param		orgID		path	string					true	"Organisation ID"
+// @Param		transfer	body	models.OrgTransferDTO	true	"Input"
+// @Success		200	{object}	models.OwnershipTransfer
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/transfer [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) OrganisationTransfer(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.OrgTransferDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Ownership transfer object invalid")
+		return err
+	}
+
+	transfer, err := h.orgsStore.TransferOwnership(c.Context(), org, user.ID, input.UserID)
+	if err != nil {
+		return orgUserError(log, err)
+	}
+
+	return c.JSON(transfer)
+}
+
+// Accept organisation ownership godoc
+// @Summary		Accept organisation ownership
+// @Description Accept the pending ownership transfer. The logged-in user must be the recipient.
+// @Tags		Organisations
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Success		204	"No response"
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/transfer/accept [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) OrganisationTransferAccept(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.orgsStore.AcceptOwnershipTransfer(c.Context(), org, user.ID); err != nil {
+		return orgUserError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Cancel organisation ownership transfer godoc
+// @Summary		Cancel organisation ownership transfer
+// @Description Cancel the pending ownership transfer. The owner can cancel it or the recipient can decline it.
+// @Tags		Organisations
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Success		204	"No response"
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/transfer [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) OrganisationTransferCancel(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.orgsStore.CancelOwnershipTransfer(c.Context(), org, user.ID); err != nil {
+		return orgUserError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 // Update organisation godoc
 // @Summary		Update organisation
-// @Description Update organisation
+// @Description Update organisation. Only the fields sent are updated. If users are sent, they replace the existing members.
+// @Description The owner must remain with the ORG_OWNER role, and only callers who can manage owners can change who has it.
 // @Tags		Organisations
 // @Accept		json
 // @Produce		json
 // @Param		orgID	path	string	true	"Organisation ID"
+// @Param		org		body	models.OrgUpdateDTO	true	"Input"
 // @Success		200	{object}	models.Organisation
 // @Failure		400 "Validation error"
 // @Failure		401 "Unauthorised error"
+// @Failure		404 "Not found"
+// @Failure		403 "Forbidden error"
+// @Failure		409 "Organisation changed during the update"
 // @Router		/v1/orgs/{orgID} [patch]
 // @Security	Bearer
 // @Security	Token
 func (h *handler) OrganisationUpdate(c *fiber.Ctx) error {
 	orgID := c.Params("orgID")
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.OrgUpdateDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Organisation update object invalid")
+		return err
+	}
+
+	org, err := h.orgsStore.UpdateOrganisation(c.Context(), orgID, user.ID, input)
+	if err != nil {
+		if errors.Is(err, common.ErrForbidden) {
+			log.Debug().Err(err).Msg("Organisation update forbidden")
+			return fiber.NewError(fiber.StatusForbidden, err.Error())
+		}
+		if errors.Is(err, common.ErrOrgChanged) {
+			log.Debug().Err(err).Msg("Organisation changed during update")
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
+		if errors.Is(err, common.ErrSlugInUse) ||
+			errors.Is(err, common.ErrNoOrgOwner) ||
+			errors.Is(err, common.ErrOrgOwner) ||
+			errors.Is(err, common.ErrDuplicateOrgUser) ||
+			errors.Is(err, common.ErrUnknownRole) ||
+			errors.Is(err, common.ErrUnknownUser) {
+			log.Debug().Err(err).Msg("Invalid organisation update")
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		log.Error().Err(err).Msg("Error updating organisation")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if org == nil {
+		return fiber.ErrNotFound
+	}
 
-	return c.JSON(fiber.Map{
-		"type":  "update org",
-		"orgID": orgID,
-	})
+	return c.JSON(org)
+}
+
+// Update organisation user godoc
+// @Summary		Update organisation user
+// @Description Change a user's role in the organisation. The last owner cannot be demoted.
+// @Tags		Organisations
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string					true	"Organisation ID"
+// @Param		userID	path	string					true	"User ID"
+// @Param		user	body	models.OrgUserRoleDTO	true	"Input"
+// @Success		200	{object}	models.OrganisationUser
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/users/{userID} [patch]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) OrganisationUpdateUser(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.OrgUserRoleDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Organisation user object invalid")
+		return err
+	}
+
+	member, err := h.orgsStore.UpdateUserRole(c.Context(), org, user.ID, c.Params("userID"), input.Role)
+	if err != nil {
+		return orgUserError(log, err)
+	}
+
+	return c.JSON(member)
+}
+
+func orgUserError(log zerolog.Logger, err error) error {
+	switch {
+	case errors.Is(err, common.ErrOrgNotFound):
+		return fiber.ErrNotFound
+	case errors.Is(err, common.ErrForbidden):
+		log.Debug().Err(err).Msg("Organisation user change forbidden")
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, common.ErrUnknownUser):
+		log.Debug().Err(err).Msg("Unknown organisation user")
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, common.ErrDuplicateOrgUser),
+		errors.Is(err, common.ErrInvalidTransfer),
+		errors.Is(err, common.ErrNoOrgOwner),
+		errors.Is(err, common.ErrNoTransfer),
+		errors.Is(err, common.ErrOrgOwner),
+		errors.Is(err, common.ErrUnknownRole):
+		log.Debug().Err(err).Msg("Invalid organisation user change")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	default:
+		log.Error().Err(err).Msg("Error changing organisation user")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
 }
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Create personal access token godoc
+// @Summary		Create personal access token
+// @Description Create a personal access token for the user, only returned once. Tokens can't create tokens that outlive them.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Param		token	body	models.PersonalAccessTokenDTO	true	"Input"
+// @Success		200	{object}	models.PersonalAccessTokenCreatedDTO
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user/tokens [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserTokenCreate(c *fiber.Ctx) error {
+	principal := c.Locals(principalContextKey).(*models.Principal)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.PersonalAccessTokenDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Personal access token object invalid")
+		return err
+	}
+
+	token, key, err := h.patStore.CreatePersonalAccessToken(c.Context(), principal, input)
+	if err != nil {
+		return personalAccessTokenError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionTokenCreated, principal.User.ID, map[string]string{"tokenId": token.ID})
+
+	return c.JSON(models.PersonalAccessTokenCreatedDTO{
+		Token: token,
+		Key:   key,
+	})
+}
+
+// Delete personal access token godoc
+// @Summary		Delete personal access token
+// @Description Delete a personal access token. It can no longer be used to authenticate.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Param		tokenID	path	string	true	"Token ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/user/tokens/{tokenID} [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserTokenDelete(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	tokenID := c.Params("tokenID")
+	if err := h.patStore.DeletePersonalAccessToken(c.Context(), user.ID, tokenID); err != nil {
+		return personalAccessTokenError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionTokenDeleted, user.ID, map[string]string{"tokenId": tokenID})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// List personal access tokens godoc
+// @Summary		List personal access tokens
+// @Description List the user's personal access tokens. The tokens themselves are never returned.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Param		page	query	int		false	"Page number"	default(1)
+// @Param		perPage	query	int		false	"Results per page"	default(25)
+// @Success		200	{object}	models.Pagination[models.PersonalAccessToken]
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user/tokens [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserTokenList(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	page := max(c.QueryInt("page", 1), 1)
+	perPage := min(max(c.QueryInt("perPage", 25), 1), 100)
+
+	offset := perPage * (page - 1)
+
+	tokens, err := h.patStore.ListPersonalAccessTokens(c.Context(), offset, perPage, user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting list of personal access tokens")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(tokens)
+}
+
+func personalAccessTokenError(log zerolog.Logger, err error) error {
+	switch {
+	case errors.Is(err, common.ErrNotDeleted):
+		return fiber.ErrNotFound
+	case errors.Is(err, common.ErrForbidden):
+		log.Debug().Err(err).Msg("Forbidden personal access token change")
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, common.ErrInvalidExpiry),
+		errors.Is(err, common.ErrInvalidScope):
+		log.Debug().Err(err).Msg("Invalid personal access token")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	default:
+		log.Error().Err(err).Msg("Error changing personal access token")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+}
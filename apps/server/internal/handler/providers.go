@@ -18,12 +18,14 @@ package handler
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/url"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
 	"github.com/mrsimonemms/opensesame/apps/server/internal/providers"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
 	"github.com/rs/zerolog"
 )
@@ -36,7 +38,8 @@ type ProviderLoginResponse struct {
 
 // List providers godoc
 // @Summary		List providers
-// @Description Display a list of all providers available. Output in the order set in the config file
+// @Description Display a list of all providers available. Output in the order set in the config file. Where the
+// @Description provider describes itself, its routes, capabilities and how to display it are included.
 // @Tags		Providers
 // @Accept		json
 // @Produce		json
@@ -44,34 +47,27 @@ type ProviderLoginResponse struct {
 // @Router		/v1/providers [get]
 // @Security	Token
 func (h *handler) ProvidersList(c *fiber.Ctx) error {
-	providers := []models.ProviderModel{}
-
-	for _, i := range h.config.Providers {
-		providers = append(providers, models.ProviderModel{
-			ID:   i.ID,
-			Name: i.Name,
-		})
-	}
-
-	return c.JSON(providers)
+	return c.JSON(h.descriptions.Models(c.Context(), h.config.Providers))
 }
 
 // Login godoc
 // @Summary		Login
-// @Description Login to a provider
+// @Description Login to a provider. The callback URL must be in the server's allowlist.
 // @Tags		Providers
 // @Accept		json
 // @Produce		json
 // @Success		200	{object}	ProviderLoginResponse
-// @Response	302	"Redirect to provider login page"
+// @Response	302	"Redirect to provider login page or callback URL"
+// @Failure		400 "Validation error"
 // @Param		providerID	path	string	true	"Provider ID"	default(github)
+// @Param		callback	query	string	false	"URL to send the user to after login"
+// @Param		state		query	string	false	"Value returned unchanged to the callback URL"
+// @Param		delivery	query	string	false	"Send a one-time code to the callback URL instead of the token"	Enums(query, code)
 // @Router		/v1/providers/{providerID}/login [get]
 // @Router		/v1/providers/{providerID}/login [post]
 // @Router		/v1/providers/{providerID}/login/callback [get]
 // @Security	Token
 func (h *handler) ProvidersLogin(c *fiber.Ctx) error {
-	handleLoginInputCookies(c)
-
 	log := c.Locals("logger").(zerolog.Logger)
 
 	providerID := c.Params("providerID")
@@ -83,6 +79,15 @@ func (h *handler) ProvidersLogin(c *fiber.Ctx) error {
 
 	l := log.With().Str("providerID", providerID).Logger()
 
+	state, err := h.getLoginState(c)
+	if err != nil {
+		return err
+	}
+	if state.UserID != "" && !h.descriptions.SupportsLinking(c.Context(), *provider) {
+		l.Debug().Msg("Provider cannot be linked to an existing user")
+		return fiber.NewError(fiber.StatusBadRequest, "Provider cannot be linked to an existing user")
+	}
+
 	l.Debug().Msg("Authenticating against provider")
 	providerUser, err := providers.Authenticate(c, *provider)
 	if err != nil {
@@ -94,20 +99,30 @@ func (h *handler) ProvidersLogin(c *fiber.Ctx) error {
 		return nil
 	}
 
+	// The login attempt is complete
+	h.clearLoginState(c)
+
 	l.Info().Msg("User authenticated by provider - saving to database")
 	var existingUserID *string
-	if userID := c.Cookies(existingUserCookieKey); userID != "" {
-		l.Info().Str("existingUserID", userID).Msg("Existing user cookie found")
-		existingUserID = &userID
+	if state.UserID != "" {
+		l.Info().Str("existingUserID", state.UserID).Msg("Existing user found in login state")
+		existingUserID = &state.UserID
 	}
 
 	l.Debug().Msg("Triggering user upsert")
-	userModel, err := h.usersStore.CreateOrUpdateUserFromProvider(c.Context(), providerID, providerUser, existingUserID)
+	canLink := h.descriptions.SupportsLinking(c.Context(), *provider)
+	userModel, err := h.usersStore.CreateOrUpdateUserFromProvider(c.Context(), providerID, providerUser, existingUserID, canLink)
 	if err != nil {
+		if errors.Is(err, common.ErrUserDeactivated) {
+			l.Debug().Err(err).Msg("User is deactivated")
+			return fiber.NewError(fiber.StatusForbidden, "User is deactivated")
+		}
 		l.Error().Err(err).Msg("Error creating user from provider")
 		return fiber.NewError(fiber.StatusServiceUnavailable, "Error creating user from provider")
 	}
 
+	h.recordAuditEvent(c, models.AuditActionLogin, userModel.ID, map[string]string{"providerId": providerID})
+
 	l.Debug().Msg("Generate the auth token")
 	token, err := userModel.GenerateAuthToken(h.config)
 	if err != nil {
@@ -115,72 +130,48 @@ func (h *handler) ProvidersLogin(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "Error generating auth token")
 	}
 
-	if redirectURL := c.Cookies(callbackCookieKey); redirectURL != "" {
-		l.Info().Msg("Redirecting to URL with token")
-
-		u, err := url.Parse(redirectURL)
-		if err != nil {
-			l.Error().Err(err).Msg("Error parsing redirect URL")
-			return fiber.NewError(fiber.StatusInternalServerError)
-		}
-
-		encodedToken := base64.URLEncoding.EncodeToString([]byte(token))
-
-		q := u.Query()
-		q.Add("token", encodedToken)
-		u.RawQuery = q.Encode()
-
-		return c.Redirect(u.String())
-	}
-
-	if err := userModel.DecryptTokens(h.config); err != nil {
-		l.Error().Err(err).Msg("Error decrypting account tokens")
-		return fiber.NewError(fiber.StatusInternalServerError)
+	if state.Callback != "" {
+		return h.redirectToLoginCallback(c, state, userModel, token)
 	}
 
 	l.Info().Msg("Outputting the user object")
 	return c.JSON(ProviderLoginResponse{
 		Token: token,
-		User:  userModel,
+		User:  userModel.WithoutTokens(),
 	})
 }
 
-func handleLoginInputCookies(c *fiber.Ctx) {
+// Send the user to the callback URL with either the token or a one-time code
+func (h *handler) redirectToLoginCallback(c *fiber.Ctx, state *loginState, user *models.User, token string) error {
 	log := c.Locals("logger").(zerolog.Logger)
 
-	// Check if there is an existing user loaded
-	if u := c.Locals(userContextKey); u != nil {
-		existingUserID := (u.(*models.User)).ID
-		log.Debug().Str("userID", existingUserID).Msg("Setting user ID to cookie")
+	u, err := url.Parse(state.Callback)
+	if err != nil {
+		log.Error().Err(err).Msg("Error parsing redirect URL")
+		return fiber.NewError(fiber.StatusInternalServerError)
+	}
+
+	q := u.Query()
+
+	if state.Delivery == config.TokenDeliveryCode {
+		log.Info().Msg("Redirecting to URL with one-time code")
 
-		c.Cookie(&fiber.Cookie{
-			Name:  existingUserCookieKey,
-			Value: existingUserID,
-		})
+		code, err := h.oauthStore.CreateLoginCode(c.Context(), user.ID, state.Callback)
+		if err != nil {
+			log.Error().Err(err).Msg("Error creating login code")
+			return fiber.NewError(fiber.StatusInternalServerError)
+		}
+		q.Add("code", code)
 	} else {
-		log.Debug().Msg("Clearing user ID cookie")
-		// The c.ClearCookie function doesn't seem to work with encrypt cookie
-		c.Cookie(&fiber.Cookie{
-			Name:    existingUserCookieKey,
-			Expires: time.Now().Add(-time.Hour * 24),
-			Value:   "",
-		})
+		log.Info().Msg("Redirecting to URL with token")
+		q.Add("token", base64.URLEncoding.EncodeToString([]byte(token)))
 	}
 
-	if callbackURL := c.Query("callback", ""); callbackURL != "" {
-		// Set a callback URL for after a success resolution
-		log.Debug().Msg("Setting callback cookie")
-		c.Cookie(&fiber.Cookie{
-			Name:  callbackCookieKey,
-			Value: callbackURL,
-		})
-	} else {
-		log.Debug().Msg("Clearing callback cookie")
-		// The c.ClearCookie function doesn't seem to work with encrypt cookie
-		c.Cookie(&fiber.Cookie{
-			Name:    callbackCookieKey,
-			Expires: time.Now().Add(-time.Hour * 24),
-			Value:   "",
-		})
+	if state.ClientState != "" {
+		q.Add("state", state.ClientState)
 	}
+
+	u.RawQuery = q.Encode()
+
+	return c.Redirect(u.String())
 }
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Create role godoc
+// @Summary		Create role
+// @Description Create a custom role for the organisation. Only permissions the caller has and that are not owner-only can be granted.
+// @Tags		Roles
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		role	body	models.OrgRoleDTO	true	"Input"
+// @Success		200	{object}	models.OrganisationRole
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/roles [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) RoleCreate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.OrgRoleDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Role object invalid")
+		return err
+	}
+
+	role, err := h.orgsStore.CreateRole(c.Context(), org, user.ID, input)
+	if err != nil {
+		return roleError(log, err)
+	}
+
+	return c.JSON(role)
+}
+
+// Delete role godoc
+// @Summary		Delete role
+// @Description Delete a custom role. Roles assigned to users cannot be deleted.
+// @Tags		Roles
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		role	path	string	true	"Role name"
+// @Success		204	"No response"
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/roles/{role} [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) RoleDelete(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.orgsStore.DeleteRole(c.Context(), org, c.Params("role")); err != nil {
+		return roleError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// List roles godoc
+// @Summary		List roles
+// @Description List the built-in and custom roles available in the organisation
+// @Tags		Roles
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Success		200	{object}	[]models.OrganisationRole
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/roles [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) RoleList(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+
+	return c.JSON(h.orgsStore.ListRoles(org))
+}
+
+// Update role godoc
+// @Summary		Update role
+// @Description Update a custom role. Built-in roles cannot be changed and permissions the caller does not have cannot be granted.
+// @Tags		Roles
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		role	path	string	true	"Role name"
+// @Param		input	body	models.OrgRoleUpdateDTO	true	"Input"
+// @Success		200	{object}	models.OrganisationRole
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/roles/{role} [patch]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) RoleUpdate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.OrgRoleUpdateDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Role object invalid")
+		return err
+	}
+
+	role, err := h.orgsStore.UpdateRole(c.Context(), org, user.ID, c.Params("role"), input)
+	if err != nil {
+		return roleError(log, err)
+	}
+	if role == nil {
+		return fiber.ErrNotFound
+	}
+
+	return c.JSON(role)
+}
+
+// Convert the role store errors to HTTP errors
+func roleError(log zerolog.Logger, err error) error {
+	switch {
+	case errors.Is(err, common.ErrNotDeleted):
+		return fiber.ErrNotFound
+	case errors.Is(err, common.ErrBuiltInRole),
+		errors.Is(err, common.ErrInvalidRole),
+		errors.Is(err, common.ErrRoleExists),
+		errors.Is(err, common.ErrRoleInUse):
+		log.Debug().Err(err).Msg("Invalid role change")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, common.ErrForbidden):
+		log.Debug().Err(err).Msg("Role change forbidden")
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	default:
+		log.Error().Err(err).Msg("Error changing role")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+}
@@ -26,6 +26,8 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/rbac"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
 	"github.com/mrsimonemms/opensesame/packages/authentication/v1"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
@@ -81,21 +83,137 @@ func (h *handler) Register(app *fiber.App) {
 	}))
 	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
+	// SCIM provisioning, authenticated with an organisation's API key
+	app.Route("/scim/v2", func(router fiber.Router) {
+		router.
+			Use(h.VerifyUser(), h.VerifySCIM).
+			Get("/ServiceProviderConfig", h.SCIMServiceProviderConfig)
+
+		router.Route("/Groups", func(groups fiber.Router) {
+			groups.
+				Get("/", h.SCIMGroupList).
+				Post("/", h.SCIMGroupCreate).
+				Get("/:groupID", h.SCIMGroupGet).
+				Put("/:groupID", h.SCIMGroupReplace).
+				Patch("/:groupID", h.SCIMGroupPatch).
+				Delete("/:groupID", h.SCIMGroupDelete)
+		})
+
+		router.Route("/Users", func(users fiber.Router) {
+			users.
+				Get("/", h.SCIMUserList).
+				Post("/", h.SCIMUserCreate).
+				Get("/:userID", h.SCIMUserGet).
+				Put("/:userID", h.SCIMUserReplace).
+				Patch("/:userID", h.SCIMUserPatch).
+				Delete("/:userID", h.SCIMUserDelete)
+		})
+	})
+
 	// Versioned endpoints
 	v1 := app.Group("/v1")
 
+	if h.config.OAuth != nil {
+		// OpenID Connect provider
+		app.Get("/.well-known/openid-configuration", h.OAuthDiscovery)
+
+		v1.Route("/oauth", func(router fiber.Router) {
+			router.Get("/authorize", h.VerifyUser(true), h.OAuthAuthorize)
+			router.Get("/authorize/callback", h.OAuthAuthorizeCallback)
+			router.Post("/introspect", h.OAuthIntrospect)
+			router.Get("/jwks", h.OAuthJWKS)
+		})
+	}
+
+	v1.Route("/admin", func(router fiber.Router) {
+		router.
+			Use(h.VerifyUser(), h.RequireSession, h.RequireAdmin).
+			Post("/users/:userID/deactivate", h.AdminUserDeactivate).
+			Post("/users/:userID/reactivate", h.AdminUserReactivate)
+	})
+
+	// Service accounts use the client credentials grant even if the OpenID Connect provider is disabled
+	v1.Post("/oauth/token", h.OAuthToken)
+
+	v1.Route("/invitations", func(router fiber.Router) {
+		router.
+			Use(h.VerifyUser(), h.RequireUser, h.RequireScope(models.ScopeReadOrgs, models.ScopeWriteOrgs)).
+			Post("/accept", h.InvitationAccept).
+			Post("/decline", h.InvitationDecline)
+	})
+
 	v1.Route("/orgs", func(router fiber.Router) {
 		router.
-			Use(h.VerifyUser()).
-			Get("/", h.OrganisationList).
-			Post("/", h.OrganisationCreate)
+			Use(h.VerifyUser(), h.RequireScope(models.ScopeReadOrgs, models.ScopeWriteOrgs)).
+			Get("/", h.RequireUser, h.OrganisationList).
+			Post("/", h.RequireUser, h.OrganisationCreate)
 
 		router.Route("/:orgID", func(r fiber.Router) {
 			r.
-				Get("/", h.OrganisationGet).
-				Delete("/", h.OrganisationDelete).
-				Patch("/", h.OrganisationUpdate).
-				Get("/users", h.OrganisationListUsers)
+				Get("/", h.VerifyRBACPermissions(rbac.PermissionOrgRead), h.OrganisationGet).
+				Delete("/", h.RequireUser, h.VerifyRBACPermissions(rbac.PermissionOrgDelete), h.OrganisationDelete).
+				Patch("/", h.RequireUser, h.VerifyRBACPermissions(rbac.PermissionOrgUpdate), h.OrganisationUpdate).
+				Post("/leave", h.RequireUser, h.VerifyRBACPermissions(rbac.PermissionOrgRead), h.OrganisationLeave).
+				Post("/restore", h.RequireUser, h.OrganisationRestore). // Deleted organisations aren't visible to the RBAC check
+				Post("/transfer", h.RequireUser, h.VerifyRBACPermissions(rbac.PermissionOrgOwnersManage), h.OrganisationTransfer).
+				Delete("/transfer", h.RequireUser, h.VerifyRBACPermissions(rbac.PermissionOrgRead), h.OrganisationTransferCancel).
+				Post("/transfer/accept", h.RequireUser, h.VerifyRBACPermissions(rbac.PermissionOrgRead), h.OrganisationTransferAccept)
+
+			r.Route("/api-keys", func(apiKeys fiber.Router) {
+				apiKeys.
+					Use(h.RequireUser).
+					Get("/", h.VerifyRBACPermissions(rbac.PermissionOrgAPIKeysWrite), h.APIKeyList).
+					Post("/", h.VerifyRBACPermissions(rbac.PermissionOrgAPIKeysWrite), h.APIKeyCreate).
+					Delete("/:keyID", h.VerifyRBACPermissions(rbac.PermissionOrgAPIKeysWrite), h.APIKeyDelete)
+			})
+
+			r.Route("/service-accounts", func(serviceAccounts fiber.Router) {
+				serviceAccounts.
+					Use(h.RequireUser).
+					Get("/", h.VerifyRBACPermissions(rbac.PermissionOrgUsersRead), h.ServiceAccountList).
+					Post("/", h.VerifyRBACPermissions(rbac.PermissionOrgUsersWrite), h.ServiceAccountCreate).
+					Delete("/:userID", h.VerifyRBACPermissions(rbac.PermissionOrgUsersWrite), h.ServiceAccountDelete)
+			})
+
+			r.Route("/users", func(users fiber.Router) {
+				users.
+					Use(h.RequireUser).
+					Get("/", h.VerifyRBACPermissions(rbac.PermissionOrgUsersRead), h.OrganisationListUsers).
+					Post("/", h.VerifyRBACPermissions(rbac.PermissionOrgUsersWrite), h.OrganisationAddUser).
+					Patch("/:userID", h.VerifyRBACPermissions(rbac.PermissionOrgUsersWrite), h.OrganisationUpdateUser).
+					Delete("/:userID", h.VerifyRBACPermissions(rbac.PermissionOrgUsersWrite), h.OrganisationRemoveUser)
+			})
+
+			r.Route("/invitations", func(invitations fiber.Router) {
+				invitations.
+					Get("/", h.VerifyRBACPermissions(rbac.PermissionOrgUsersRead), h.InvitationList).
+					Post("/", h.RequireUser, h.VerifyRBACPermissions(rbac.PermissionOrgUsersWrite), h.InvitationCreate).
+					Delete("/:invitationID", h.RequireUser, h.VerifyRBACPermissions(rbac.PermissionOrgUsersWrite), h.InvitationRevoke)
+			})
+
+			r.Route("/teams", func(teams fiber.Router) {
+				teams.
+					Get("/", h.VerifyRBACPermissions(rbac.PermissionOrgTeamsRead), h.TeamList).
+					Post("/", h.VerifyRBACPermissions(rbac.PermissionOrgTeamsWrite), h.TeamCreate)
+
+				teams.Route("/:teamID", func(team fiber.Router) {
+					team.
+						Use(h.VerifyRBACPermissions(rbac.PermissionOrgRead)).
+						Get("/", h.VerifyTeamPermissions(rbac.PermissionTeamRead), h.TeamGet).
+						Patch("/", h.VerifyTeamPermissions(rbac.PermissionTeamUpdate), h.TeamUpdate).
+						Delete("/", h.VerifyRBACPermissions(rbac.PermissionOrgTeamsWrite), h.TeamDelete).
+						Put("/users/:userID", h.VerifyTeamPermissions(rbac.PermissionTeamUsersWrite), h.TeamSetUser).
+						Delete("/users/:userID", h.VerifyTeamPermissions(rbac.PermissionTeamUsersWrite), h.TeamRemoveUser)
+				})
+			})
+
+			r.Route("/roles", func(roles fiber.Router) {
+				roles.
+					Get("/", h.VerifyRBACPermissions(rbac.PermissionOrgRead), h.RoleList).
+					Post("/", h.VerifyRBACPermissions(rbac.PermissionOrgRolesWrite), h.RoleCreate).
+					Patch("/:role", h.VerifyRBACPermissions(rbac.PermissionOrgRolesWrite), h.RoleUpdate).
+					Delete("/:role", h.VerifyRBACPermissions(rbac.PermissionOrgRolesWrite), h.RoleDelete)
+			})
 		})
 	})
 
@@ -105,21 +223,45 @@ func (h *handler) Register(app *fiber.App) {
 			"/:providerID/login",
 			h.IsRouteEnabled(authentication.Route_ROUTE_LOGIN_GET),
 			h.VerifyUser(true),
+			h.SetLoginState,
 			h.ProvidersLogin,
 		)
 		router.Post(
 			"/:providerID/login",
 			h.IsRouteEnabled(authentication.Route_ROUTE_LOGIN_POST),
 			h.VerifyUser(true),
+			h.SetLoginState,
 			h.ProvidersLogin,
 		)
 		router.Get("/:providerID/login/callback", h.IsRouteEnabled(authentication.Route_ROUTE_CALLBACK_GET), h.ProvidersLogin)
 	})
 
+	v1.Route("/token", func(router fiber.Router) {
+		router.Post("/code", h.TokenCodeExchange)
+		router.Post("/exchange", h.VerifyUser(), h.RequireSession, h.TokenExchange)
+	})
+
+	v1.Get("/userinfo", h.VerifyUser(), h.RequireUser, h.RequireUserInfoScope, h.UserInfo)
+
 	v1.Route("/user", func(router fiber.Router) {
 		router.
-			Use(h.VerifyUser()).
+			Use(h.VerifyUser(), h.RequireUser, h.RequireScope(models.ScopeReadUser, models.ScopeWriteUser)).
 			Get("/", h.UserGet).
-			Delete("/provider/:providerID", h.UserProviderDelete)
+			Patch("/", h.UserUpdate).
+			Delete("/", h.RequireSession, h.UserDelete).
+			Post("/deactivate", h.RequireSession, h.UserDeactivate).
+			Get("/export", h.UserExport).
+			Post("/logout", h.RequireSession, h.UserLogout).
+			Post("/merge", h.RequireSession, h.UserMerge).
+			Delete("/provider/:providerID", h.UserProviderDelete).
+			Post("/provider/:providerID/refresh", h.UserProviderRefresh).
+			Get("/provider/:providerID/token", h.RequireScopeForAllMethods(models.ScopeReadProviderTokens), h.UserProviderToken)
+
+		router.Route("/tokens", func(tokens fiber.Router) {
+			tokens.
+				Get("/", h.UserTokenList).
+				Post("/", h.UserTokenCreate).
+				Delete("/:tokenID", h.UserTokenDelete)
+		})
 	})
 }
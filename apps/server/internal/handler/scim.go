@@ -0,0 +1,459 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/stores"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+const scimContentType = "application/scim+json"
+
+// SCIM service provider config godoc
+// @Summary		SCIM service provider config
+// @Description The SCIM features supported, as defined in RFC 7643
+// @Tags		SCIM
+// @Produce		json
+// @Success		200	{object}	models.SCIMServiceProviderConfig
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/scim/v2/ServiceProviderConfig [get]
+// @Security	Bearer
+func (h *handler) SCIMServiceProviderConfig(c *fiber.Ctx) error {
+	return c.JSON(models.SCIMServiceProviderConfig{
+		Schemas: []string{models.SCIMSchemaServiceProviderConfig},
+		Patch:   models.SCIMSupported{Supported: true},
+		Filter: models.SCIMFilterSupported{
+			Supported:  true,
+			MaxResults: stores.SCIMMaxResults,
+		},
+		AuthenticationSchemes: []map[string]string{
+			{
+				"type":        "oauthbearertoken",
+				"name":        "API key",
+				"description": "Organisation API key with the org:scim scope",
+			},
+		},
+	}, scimContentType)
+}
+
+// Create SCIM group godoc
+// @Summary		Create SCIM group
+// @Description Create a team in the organisation
+// @Tags		SCIM
+// @Accept		json
+// @Produce		json
+// @Param		group	body	models.SCIMGroup	true	"Input"
+// @Success		201	{object}	models.SCIMGroup
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		409	{object}	models.SCIMError
+// @Router		/scim/v2/Groups [post]
+// @Security	Bearer
+func (h *handler) SCIMGroupCreate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.SCIMGroup)
+	if err := h.parseSCIMBody(c, input); err != nil {
+		return err
+	}
+
+	group, err := h.scimStore.CreateGroup(c.Context(), org, input)
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(group, scimContentType)
+}
+
+// Delete SCIM group godoc
+// @Summary		Delete SCIM group
+// @Description Delete a team. Its members remain in the organisation.
+// @Tags		SCIM
+// @Produce		json
+// @Param		groupID	path	string	true	"Team ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404	{object}	models.SCIMError
+// @Router		/scim/v2/Groups/{groupID} [delete]
+// @Security	Bearer
+func (h *handler) SCIMGroupDelete(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.scimStore.DeleteGroup(c.Context(), org, c.Params("groupID")); err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Get SCIM group godoc
+// @Summary		Get SCIM group
+// @Description Get a team
+// @Tags		SCIM
+// @Produce		json
+// @Param		groupID	path	string	true	"Team ID"
+// @Success		200	{object}	models.SCIMGroup
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404	{object}	models.SCIMError
+// @Router		/scim/v2/Groups/{groupID} [get]
+// @Security	Bearer
+func (h *handler) SCIMGroupGet(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	group, err := h.scimStore.GetGroup(org, c.Params("groupID"))
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.JSON(group, scimContentType)
+}
+
+// List SCIM groups godoc
+// @Summary		List SCIM groups
+// @Description List the organisation's teams. Only the "eq" filter operator is supported.
+// @Tags		SCIM
+// @Produce		json
+// @Param		filter		query	string	false	"Filter"	example(displayName eq "Engineering")
+// @Param		startIndex	query	int		false	"1-based index of the first result"	default(1)
+// @Param		count		query	int		false	"Results per page"	default(100)
+// @Success		200	{object}	models.SCIMListResponse[models.SCIMGroup]
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/scim/v2/Groups [get]
+// @Security	Bearer
+func (h *handler) SCIMGroupList(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	groups, err := h.scimStore.ListGroups(
+		org,
+		c.Query("filter"),
+		c.QueryInt("startIndex", 1),
+		c.QueryInt("count", stores.SCIMMaxResults),
+	)
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.JSON(groups, scimContentType)
+}
+
+// Patch SCIM group godoc
+// @Summary		Patch SCIM group
+// @Description Change a team's name or members
+// @Tags		SCIM
+// @Accept		json
+// @Produce		json
+// @Param		groupID	path	string					true	"Team ID"
+// @Param		patch	body	models.SCIMPatchRequest	true	"Input"
+// @Success		200	{object}	models.SCIMGroup
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404	{object}	models.SCIMError
+// @Router		/scim/v2/Groups/{groupID} [patch]
+// @Security	Bearer
+func (h *handler) SCIMGroupPatch(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.SCIMPatchRequest)
+	if err := h.parseSCIMBody(c, input); err != nil {
+		return err
+	}
+
+	group, err := h.scimStore.PatchGroup(c.Context(), org, c.Params("groupID"), input)
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.JSON(group, scimContentType)
+}
+
+// Replace SCIM group godoc
+// @Summary		Replace SCIM group
+// @Description Replace a team's name and members
+// @Tags		SCIM
+// @Accept		json
+// @Produce		json
+// @Param		groupID	path	string				true	"Team ID"
+// @Param		group	body	models.SCIMGroup	true	"Input"
+// @Success		200	{object}	models.SCIMGroup
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404	{object}	models.SCIMError
+// @Router		/scim/v2/Groups/{groupID} [put]
+// @Security	Bearer
+func (h *handler) SCIMGroupReplace(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.SCIMGroup)
+	if err := h.parseSCIMBody(c, input); err != nil {
+		return err
+	}
+
+	group, err := h.scimStore.ReplaceGroup(c.Context(), org, c.Params("groupID"), input)
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.JSON(group, scimContentType)
+}
+
+// Create SCIM user godoc
+// @Summary		Create SCIM user
+// @Description Create a user and add them to the organisation. Existing users must be invited instead.
+// @Tags		SCIM
+// @Accept		json
+// @Produce		json
+// @Param		user	body	models.SCIMUser	true	"Input"
+// @Success		201	{object}	models.SCIMUser
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		409	{object}	models.SCIMError
+// @Router		/scim/v2/Users [post]
+// @Security	Bearer
+func (h *handler) SCIMUserCreate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.SCIMUser)
+	if err := h.parseSCIMBody(c, input); err != nil {
+		return err
+	}
+
+	user, err := h.scimStore.CreateUser(c.Context(), org, input)
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(user, scimContentType)
+}
+
+// Delete SCIM user godoc
+// @Summary		Delete SCIM user
+// @Description Remove a user provisioned by the organisation from it
+// @Tags		SCIM
+// @Produce		json
+// @Param		userID	path	string	true	"User ID"
+// @Success		204	"No response"
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404	{object}	models.SCIMError
+// @Router		/scim/v2/Users/{userID} [delete]
+// @Security	Bearer
+func (h *handler) SCIMUserDelete(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.scimStore.DeleteUser(c.Context(), org, c.Params("userID")); err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Get SCIM user godoc
+// @Summary		Get SCIM user
+// @Description Get an organisation member
+// @Tags		SCIM
+// @Produce		json
+// @Param		userID	path	string	true	"User ID"
+// @Success		200	{object}	models.SCIMUser
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404	{object}	models.SCIMError
+// @Router		/scim/v2/Users/{userID} [get]
+// @Security	Bearer
+func (h *handler) SCIMUserGet(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	user, err := h.scimStore.GetUser(c.Context(), org, c.Params("userID"))
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.JSON(user, scimContentType)
+}
+
+// List SCIM users godoc
+// @Summary		List SCIM users
+// @Description List the organisation's members. Only the "eq" filter operator is supported.
+// @Tags		SCIM
+// @Produce		json
+// @Param		filter		query	string	false	"Filter"	example(userName eq "test@test.com")
+// @Param		startIndex	query	int		false	"1-based index of the first result"	default(1)
+// @Param		count		query	int		false	"Results per page"	default(100)
+// @Success		200	{object}	models.SCIMListResponse[models.SCIMUser]
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/scim/v2/Users [get]
+// @Security	Bearer
+func (h *handler) SCIMUserList(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	users, err := h.scimStore.ListUsers(
+		c.Context(),
+		org,
+		c.Query("filter"),
+		c.QueryInt("startIndex", 1),
+		c.QueryInt("count", stores.SCIMMaxResults),
+	)
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.JSON(users, scimContentType)
+}
+
+// Patch SCIM user godoc
+// @Summary		Patch SCIM user
+// @Description Change a user the organisation provisioned who is in no other organisation. Setting active to false deactivates them.
+// @Tags		SCIM
+// @Accept		json
+// @Produce		json
+// @Param		userID	path	string					true	"User ID"
+// @Param		patch	body	models.SCIMPatchRequest	true	"Input"
+// @Success		200	{object}	models.SCIMUser
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404	{object}	models.SCIMError
+// @Router		/scim/v2/Users/{userID} [patch]
+// @Security	Bearer
+func (h *handler) SCIMUserPatch(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.SCIMPatchRequest)
+	if err := h.parseSCIMBody(c, input); err != nil {
+		return err
+	}
+
+	user, err := h.scimStore.PatchUser(c.Context(), org, c.Params("userID"), input)
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.JSON(user, scimContentType)
+}
+
+// Replace SCIM user godoc
+// @Summary		Replace SCIM user
+// @Description Replace a user the organisation provisioned who is in no other organisation. Setting active to false deactivates them.
+// @Tags		SCIM
+// @Accept		json
+// @Produce		json
+// @Param		userID	path	string			true	"User ID"
+// @Param		user	body	models.SCIMUser	true	"Input"
+// @Success		200	{object}	models.SCIMUser
+// @Failure		400	{object}	models.SCIMError
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404	{object}	models.SCIMError
+// @Router		/scim/v2/Users/{userID} [put]
+// @Security	Bearer
+func (h *handler) SCIMUserReplace(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.SCIMUser)
+	if err := h.parseSCIMBody(c, input); err != nil {
+		return err
+	}
+
+	user, err := h.scimStore.ReplaceUser(c.Context(), org, c.Params("userID"), input)
+	if err != nil {
+		return scimError(c, log, err)
+	}
+
+	return c.JSON(user, scimContentType)
+}
+
+func (h *handler) parseSCIMBody(c *fiber.Ctx, input any) error {
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return scimErrorResponse(c, fiber.StatusBadRequest, "invalidSyntax", err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("SCIM object invalid")
+		return scimErrorResponse(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+	}
+
+	return nil
+}
+
+func scimError(c *fiber.Ctx, log zerolog.Logger, err error) error {
+	switch {
+	case errors.Is(err, common.ErrNotDeleted),
+		errors.Is(err, common.ErrTeamNotFound),
+		errors.Is(err, common.ErrUnknownUser):
+		return scimErrorResponse(c, fiber.StatusNotFound, "", err.Error())
+	case errors.Is(err, common.ErrDuplicateOrgUser),
+		errors.Is(err, common.ErrEmailInUse),
+		errors.Is(err, common.ErrSlugInUse):
+		log.Debug().Err(err).Msg("SCIM resource already exists")
+		return scimErrorResponse(c, fiber.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, common.ErrInvalidFilter):
+		log.Debug().Err(err).Msg("Invalid SCIM filter")
+		return scimErrorResponse(c, fiber.StatusBadRequest, "invalidFilter", err.Error())
+	case errors.Is(err, common.ErrInvalidPatch):
+		log.Debug().Err(err).Msg("Invalid SCIM patch")
+		return scimErrorResponse(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+	case errors.Is(err, common.ErrForbidden),
+		errors.Is(err, common.ErrNoOrgOwner),
+		errors.Is(err, common.ErrOrgOwner):
+		log.Debug().Err(err).Msg("SCIM change not allowed")
+		return scimErrorResponse(c, fiber.StatusBadRequest, "mutability", err.Error())
+	default:
+		log.Error().Err(err).Msg("Error handling SCIM request")
+		return scimErrorResponse(c, fiber.StatusInternalServerError, "", err.Error())
+	}
+}
+
+func scimErrorResponse(c *fiber.Ctx, status int, scimType, detail string) error {
+	return c.Status(status).JSON(models.SCIMError{
+		Schemas:  []string{models.SCIMSchemaError},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   detail,
+	}, scimContentType)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Create service account godoc
+// @Summary		Create service account
+// @Description Create a service account in the organisation. The client secret is only returned once.
+// @Tags		Service Accounts
+// @Accept		json
+// @Produce		json
+// @Param		orgID			path	string						true	"Organisation ID"
+// @Param		serviceAccount	body	models.ServiceAccountDTO	true	"Input"
+// @Success		200	{object}	models.ServiceAccountCreatedDTO
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/service-accounts [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) ServiceAccountCreate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.ServiceAccountDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Service account object invalid")
+		return err
+	}
+
+	serviceAccount, secret, err := h.orgsStore.CreateServiceAccount(c.Context(), org, user.ID, input)
+	if err != nil {
+		return serviceAccountError(log, err)
+	}
+
+	return c.JSON(models.ServiceAccountCreatedDTO{
+		User:         serviceAccount,
+		ClientID:     serviceAccount.ServiceAccount.ClientID,
+		ClientSecret: secret,
+	})
+}
+
+// Delete service account godoc
+// @Summary		Delete service account
+// @Description Remove the service account from the organisation and delete it
+// @Tags		Service Accounts
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		userID	path	string	true	"Service account user ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/service-accounts/{userID} [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) ServiceAccountDelete(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.orgsStore.DeleteServiceAccount(c.Context(), org, c.Params("userID")); err != nil {
+		return serviceAccountError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// List service accounts godoc
+// @Summary		List service accounts
+// @Description List the organisation's service accounts
+// @Tags		Service Accounts
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		page	query	int		false	"Page number"	default(1)
+// @Param		perPage	query	int		false	"Results per page"	default(25)
+// @Success		200	{object}	models.Pagination[models.User]
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/service-accounts [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) ServiceAccountList(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	page := max(c.QueryInt("page", 1), 1)
+	perPage := min(max(c.QueryInt("perPage", 25), 1), 100)
+
+	offset := perPage * (page - 1)
+
+	serviceAccounts, err := h.orgsStore.ListServiceAccounts(c.Context(), offset, perPage, org.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting list of service accounts")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(serviceAccounts)
+}
+
+func serviceAccountError(log zerolog.Logger, err error) error {
+	if errors.Is(err, common.ErrNotDeleted) {
+		return fiber.ErrNotFound
+	}
+
+	return orgUserError(log, err)
+}
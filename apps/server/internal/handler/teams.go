@@ -0,0 +1,258 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Create team godoc
+// @Summary		Create team
+// @Description Create a team in the organisation. Team members must be members of the organisation.
+// @Tags		Teams
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string			true	"Organisation ID"
+// @Param		team	body	models.TeamDTO	true	"Input"
+// @Success		200	{object}	models.Team
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/teams [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) TeamCreate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := &models.TeamDTO{
+		Users: []*models.TeamUserDTO{},
+	}
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Team object invalid")
+		return err
+	}
+
+	team, err := h.orgsStore.CreateTeam(c.Context(), org, input)
+	if err != nil {
+		return teamError(log, err)
+	}
+
+	return c.JSON(team)
+}
+
+// Delete team godoc
+// @Summary		Delete team
+// @Description Delete a team. Its members remain in the organisation.
+// @Tags		Teams
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		teamID	path	string	true	"Team ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/teams/{teamID} [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) TeamDelete(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.orgsStore.DeleteTeam(c.Context(), org, c.Params("teamID")); err != nil {
+		return teamError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Get team godoc
+// @Summary		Get team
+// @Description Get a team and its members
+// @Tags		Teams
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		teamID	path	string	true	"Team ID"
+// @Success		200	{object}	models.Team
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/teams/{teamID} [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) TeamGet(c *fiber.Ctx) error {
+	return c.JSON(c.Locals(teamContextKey).(*models.Team))
+}
+
+// List teams godoc
+// @Summary		List teams
+// @Description List the organisation's teams
+// @Tags		Teams
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Success		200	{array}	models.Team
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/orgs/{orgID}/teams [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) TeamList(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+
+	return c.JSON(org.Teams)
+}
+
+// Remove team user godoc
+// @Summary		Remove team user
+// @Description Remove a user from the team. They remain a member of the organisation.
+// @Tags		Teams
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string	true	"Organisation ID"
+// @Param		teamID	path	string	true	"Team ID"
+// @Param		userID	path	string	true	"User ID"
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/teams/{teamID}/users/{userID} [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) TeamRemoveUser(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	team := c.Locals(teamContextKey).(*models.Team)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if err := h.orgsStore.RemoveTeamUser(c.Context(), org, team, c.Params("userID")); err != nil {
+		return teamError(log, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Set team user godoc
+// @Summary		Set team user
+// @Description Add an organisation member to the team or change their team role
+// @Tags		Teams
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string					true	"Organisation ID"
+// @Param		teamID	path	string					true	"Team ID"
+// @Param		userID	path	string					true	"User ID"
+// @Param		user	body	models.TeamUserRoleDTO	true	"Input"
+// @Success		200	{object}	models.TeamUser
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/teams/{teamID}/users/{userID} [put]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) TeamSetUser(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	team := c.Locals(teamContextKey).(*models.Team)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.TeamUserRoleDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Team user object invalid")
+		return err
+	}
+
+	member, err := h.orgsStore.SetTeamUser(c.Context(), org, team, c.Params("userID"), input.Role)
+	if err != nil {
+		return teamError(log, err)
+	}
+
+	return c.JSON(member)
+}
+
+// Update team godoc
+// @Summary		Update team
+// @Description Update team. Only the fields sent are updated.
+// @Tags		Teams
+// @Accept		json
+// @Produce		json
+// @Param		orgID	path	string					true	"Organisation ID"
+// @Param		teamID	path	string					true	"Team ID"
+// @Param		team	body	models.TeamUpdateDTO	true	"Input"
+// @Success		200	{object}	models.Team
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found"
+// @Router		/v1/orgs/{orgID}/teams/{teamID} [patch]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) TeamUpdate(c *fiber.Ctx) error {
+	org := c.Locals(orgContextKey).(*models.Organisation)
+	team := c.Locals(teamContextKey).(*models.Team)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.TeamUpdateDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("Team update object invalid")
+		return err
+	}
+
+	team, err := h.orgsStore.UpdateTeam(c.Context(), org, team, input)
+	if err != nil {
+		return teamError(log, err)
+	}
+
+	return c.JSON(team)
+}
+
+func teamError(log zerolog.Logger, err error) error {
+	switch {
+	case errors.Is(err, common.ErrNotDeleted),
+		errors.Is(err, common.ErrOrgNotFound),
+		errors.Is(err, common.ErrTeamNotFound):
+		return fiber.ErrNotFound
+	case errors.Is(err, common.ErrDuplicateOrgUser),
+		errors.Is(err, common.ErrSlugInUse),
+		errors.Is(err, common.ErrUnknownUser):
+		log.Debug().Err(err).Msg("Invalid team change")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	default:
+		log.Error().Err(err).Msg("Error changing team")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+}
@@ -17,9 +17,15 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
 	"github.com/rs/zerolog"
 )
@@ -28,9 +34,76 @@ type UserGetResponse struct {
 	User *models.User `json:"user"`
 }
 
+type UserLogoutResponse struct {
+	Revocations []*models.ProviderRevocation `json:"revocations"`
+}
+
+type UserProviderTokenResponse struct {
+	AccessToken string     `json:"accessToken" example:"this-is-an-access-token"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Delete user godoc
+// @Summary		Delete
+// @Description Delete the user's account. They are removed from their organisations and their data is purged once the
+// @Description retention period has passed. Organisation owners must transfer ownership first.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Success		204	"No response"
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user [delete]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserDelete(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	deleted, err := h.usersStore.DeleteUser(c.Context(), user.ID)
+	if err != nil {
+		return userError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionUserDeleted, user.ID, nil)
+
+	log.Info().Str("userID", user.ID).Time("purgeAfter", *deleted.PurgeAfter).Msg("User deleted their account")
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Deactivate user godoc
+// @Summary		Deactivate
+// @Description Deactivate the user's account. Their auth tokens are revoked and personal access tokens deleted. Only
+// @Description an admin can reactivate the account.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Success		204	"No response"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user/deactivate [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserDeactivate(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	if _, err := h.usersStore.DeactivateUser(c.Context(), user.ID); err != nil {
+		return userError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionUserDeactivated, user.ID, nil)
+
+	log.Info().Str("userID", user.ID).Msg("User deactivated their account")
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 // Get user godoc
 // @Summary		User
-// @Description Return the user data
+// @Description Return the user data. Provider tokens are not included - use the provider token endpoint instead.
 // @Tags		User
 // @Accept		json
 // @Produce		json
@@ -41,26 +114,217 @@ type UserGetResponse struct {
 // @Security	Token
 func (h *handler) UserGet(c *fiber.Ctx) error {
 	user := c.Locals(userContextKey).(*models.User)
+
+	return c.JSON(UserGetResponse{User: user.WithoutTokens()})
+}
+
+// Export user godoc
+// @Summary		Export
+// @Description Download the data held about the user, their organisation memberships and audit events. Provider
+// @Description tokens are not included.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Success		200	{object}	models.UserExport
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user/export [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserExport(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	export, err := h.usersStore.ExportUser(c.Context(), user)
+	if err != nil {
+		log.Error().Err(err).Msg("Error exporting user")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	h.recordAuditEvent(c, models.AuditActionUserExported, user.ID, nil)
+
+	c.Attachment(fmt.Sprintf("opensesame-%s.json", user.ID))
+
+	return c.JSON(export)
+}
+
+// User info godoc
+// @Summary		User info
+// @Description OpenID Connect claims about the authenticated user. Tokens issued to an OAuth client only get the
+// @Description claims for the scopes the user consented to.
+// @Tags		User
+// @Produce		json
+// @Success		200	{object}	map[string]any
+// @Failure		401 "Unauthorised error"
+// @Router		/v1/userinfo [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserInfo(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	principal := c.Locals(principalContextKey).(*models.Principal)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	// The user's own tokens aren't limited by scope
+	scope := strings.Join(oauthScopesSupported, " ")
+	if principal.Type == models.PrincipalTypeOAuthClient {
+		scope = strings.Join(principal.Scopes, " ")
+	}
+
+	claims, err := h.oauthStore.UserClaims(c.Context(), user, scope)
+	if err != nil {
+		log.Error().Err(err).Msg("Error generating user claims")
+		return fiber.ErrInternalServerError
+	}
+
+	return c.JSON(claims)
+}
+
+// Update user godoc
+// @Summary		Update
+// @Description Update the user's profile. The email address can follow one of the linked provider accounts and the
+// @Description profile can be copied from a provider account every time the user logs in with it.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Param		user	body	models.UserUpdateDTO	true	"Input"
+// @Success		200	{object}	UserGetResponse
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user [patch]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserUpdate(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.UserUpdateDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("User object invalid")
+		return err
+	}
+
+	updated, err := h.usersStore.UpdateUser(c.Context(), user.ID, input)
+	if err != nil {
+		return userError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionUserUpdated, user.ID, nil)
+
+	return c.JSON(UserGetResponse{User: updated.WithoutTokens()})
+}
+
+// Logout user godoc
+// @Summary		Logout
+// @Description Revoke every auth token issued to the user, logging them out everywhere. The tokens with each
+// @Description provider can also be revoked - failures are returned but don't stop the user logging out.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Param		user	body	models.UserLogoutDTO	false	"Input"
+// @Success		200	{object}	UserLogoutResponse
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user/logout [post]
+// @Security	Bearer
+func (h *handler) UserLogout(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
 	log := c.Locals("logger").(zerolog.Logger)
 
-	for providerID, a := range user.Accounts {
-		if err := a.DecryptTokens(h.config); err != nil {
-			log.Error().Err(err).Str("providerID", providerID).Msg("Error decrypting provider token")
-			return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Error decrypting provider token: %s", providerID))
+	input := new(models.UserLogoutDTO)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(input); err != nil {
+			log.Warn().Err(err).Msg("Error parsing body")
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
 		}
 	}
 
-	return c.JSON(UserGetResponse{User: user})
+	revocations, err := h.usersStore.LogoutUser(c.Context(), user.ID, input.RevokeProviders)
+	if err != nil {
+		return userError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionLogout, user.ID, map[string]string{
+		"revokeProviders": strconv.FormatBool(input.RevokeProviders),
+	})
+
+	return c.JSON(UserLogoutResponse{Revocations: revocations})
+}
+
+// Merge user godoc
+// @Summary		Merge
+// @Description Merge another user into this one. The auth token of the other user proves control of both users. Its
+// @Description provider accounts, organisation memberships, tokens and API keys move to this user and it is deactivated.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Param		user	body	models.UserMergeDTO	true	"Input"
+// @Success		200	{object}	UserGetResponse
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user/merge [post]
+// @Security	Bearer
+func (h *handler) UserMerge(c *fiber.Ctx) error {
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	input := new(models.UserMergeDTO)
+	if err := c.BodyParser(input); err != nil {
+		log.Warn().Err(err).Msg("Error parsing body")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if err := h.validator.Struct(input); err != nil {
+		log.Debug().Err(err).Msg("User merge object invalid")
+		return err
+	}
+
+	token, err := h.parseAuthToken(input.Token)
+	if err != nil {
+		log.Debug().Err(err).Msg("Invalid merge token")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	// Only a session token proves control of the whole user
+	if claims, ok := token.Claims.(jwt.MapClaims); !ok || claims["org_id"] != nil || claims["client_id"] != nil {
+		log.Debug().Msg("Merge token is not a session token")
+		return fiber.NewError(fiber.StatusBadRequest, "Merge token must be a session token")
+	}
+
+	source, err := h.getUserFromToken(c.Context(), token)
+	if err != nil {
+		log.Debug().Err(err).Msg("Invalid merge token")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	log = log.With().Str("mergedUserId", source.ID).Logger()
+
+	merged, err := h.usersStore.MergeUsers(c.Context(), user.ID, source.ID)
+	if err != nil {
+		return userError(log, err)
+	}
+
+	h.recordAuditEvent(c, models.AuditActionUserMerged, user.ID, map[string]string{"mergedUserId": source.ID})
+
+	return c.JSON(UserGetResponse{User: merged.WithoutTokens()})
 }
 
 // Delete provider godoc
 // @Summary		Delete provider
-// @Description Remove the provider authentication from the user
+// @Description Remove the provider authentication from the user and revoke its tokens with the provider. The account
+// @Description is removed even if the provider fails to revoke the tokens.
 // @Tags		User
 // @Accept		json
 // @Produce		json
 // @Param		providerID	path	string	true	"Provider ID"	default(github)
-// @Success		204	"No response"
+// @Success		200	{object}	models.ProviderRevocation
 // @Failure		400 "Validation error"
 // @Failure		401 "Unauthorised error"
 // @Router		/v1/user/provider/{providerID} [delete]
@@ -73,11 +337,111 @@ func (h *handler) UserProviderDelete(c *fiber.Ctx) error {
 
 	log = log.With().Str("providerID", providerID).Logger()
 
-	_, err := h.usersStore.RemoveProviderFromUser(c.Context(), user.ID, providerID)
+	_, revocation, err := h.usersStore.RemoveProviderFromUser(c.Context(), user.ID, providerID)
 	if err != nil {
 		log.Warn().Err(err).Msg("Error updating user")
 		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
 
+	h.recordAuditEvent(c, models.AuditActionProviderRemoved, user.ID, map[string]string{
+		"providerId": providerID,
+		"revoked":    strconv.FormatBool(revocation.Revoked),
+	})
+
+	return c.JSON(revocation)
+}
+
+// Refresh provider tokens godoc
+// @Summary		Refresh provider tokens
+// @Description Exchange the provider account's refresh token for new tokens. Use the provider token endpoint to
+// @Description get the new access token.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Param		providerID	path	string	true	"Provider ID"	default(github)
+// @Success		204	"No response"
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Router		/v1/user/provider/{providerID}/refresh [post]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserProviderRefresh(c *fiber.Ctx) error {
+	providerID := c.Params("providerID")
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	log = log.With().Str("providerID", providerID).Logger()
+
+	if _, err := h.usersStore.RefreshProviderTokens(c.Context(), user.ID, providerID); err != nil {
+		return userError(log, err)
+	}
+
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+// Get provider token godoc
+// @Summary		Get provider token
+// @Description Return the access token for the provider account so it can be used with the provider's API. Expired
+// @Description tokens are refreshed first where the provider supports it. Personal access tokens and OAuth clients need
+// @Description the read:provider_tokens scope.
+// @Tags		User
+// @Accept		json
+// @Produce		json
+// @Param		providerID	path	string	true	"Provider ID"	default(github)
+// @Success		200	{object}	UserProviderTokenResponse
+// @Failure		400 "Validation error"
+// @Failure		401 "Unauthorised error"
+// @Failure		403 "Forbidden error"
+// @Failure		404 "Not found error"
+// @Router		/v1/user/provider/{providerID}/token [get]
+// @Security	Bearer
+// @Security	Token
+func (h *handler) UserProviderToken(c *fiber.Ctx) error {
+	providerID := c.Params("providerID")
+	user := c.Locals(userContextKey).(*models.User)
+	log := c.Locals("logger").(zerolog.Logger)
+
+	log = log.With().Str("providerID", providerID).Logger()
+
+	account, err := h.usersStore.GetProviderAccount(c.Context(), user.ID, providerID)
+	if err != nil {
+		return userError(log, err)
+	}
+
+	accessToken, ok := account.Tokens["accessToken"]
+	if !ok {
+		log.Debug().Msg("Provider account has no access token")
+		return fiber.NewError(fiber.StatusNotFound, "Provider account has no access token")
+	}
+
+	h.recordAuditEvent(c, models.AuditActionProviderTokenRead, user.ID, map[string]string{"providerId": providerID})
+
+	return c.JSON(UserProviderTokenResponse{
+		AccessToken: accessToken,
+		ExpiresAt:   account.TokensExpireAt,
+	})
+}
+
+func userError(log zerolog.Logger, err error) error {
+	switch {
+	case errors.Is(err, common.ErrUnknownUser):
+		log.Debug().Err(err).Msg("Unknown user")
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, common.ErrForbidden):
+		log.Debug().Err(err).Msg("User change forbidden")
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, common.ErrEmailInUse),
+		errors.Is(err, common.ErrInvalidMerge),
+		errors.Is(err, common.ErrInvalidProvider),
+		errors.Is(err, common.ErrNoOrgOwner),
+		errors.Is(err, common.ErrOrgOwner),
+		errors.Is(err, common.ErrRefreshFailed),
+		errors.Is(err, common.ErrUserDeactivated):
+		log.Debug().Err(err).Msg("Invalid user change")
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	default:
+		log.Error().Err(err).Msg("Error updating user")
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+}
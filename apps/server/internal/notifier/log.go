@@ -0,0 +1,42 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Log writes the notification to the logs. This is useful in development,
+// but the notification may contain secrets so shouldn't be used in production.
+type Log struct{}
+
+func (l *Log) Send(ctx context.Context, notification *Notification) error {
+	// The data may contain tokens, so is only logged at debug level
+	log.Info().
+		Str("type", string(notification.Type)).
+		Str("emailAddress", notification.EmailAddress).
+		Msg("Sending notification")
+
+	log.Debug().
+		Str("type", string(notification.Type)).
+		Interface("data", notification.Data).
+		Msg("Notification data")
+
+	return nil
+}
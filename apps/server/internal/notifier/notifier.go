@@ -0,0 +1,57 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notifier
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+)
+
+type NotificationType string
+
+const (
+	NotificationTypeInvitation NotificationType = "invitation"
+)
+
+// Notification is a message to be delivered to someone outside of the
+// application, such as by email. How it's delivered is up to the notifier.
+type Notification struct {
+	Type         NotificationType  `json:"type"`
+	EmailAddress string            `json:"emailAddress"`
+	Data         map[string]string `json:"data"`
+}
+
+// Common notifier interface to allow multiple delivery types
+type Notifier interface {
+	Send(ctx context.Context, notification *Notification) error
+}
+
+func New(cfg config.Notifier) (Notifier, error) {
+	var n Notifier
+	switch cfg.Type {
+	case config.NotifierTypeLog:
+		n = &Log{}
+	case config.NotifierTypeWebhook:
+		n = NewWebhook(cfg.Webhook)
+	default:
+		return nil, fmt.Errorf("unknown notifier type")
+	}
+
+	return n, nil
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package providers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/mrsimonemms/opensesame/packages/authentication/v1"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// How long a provider's description is cached for
+	describeCacheTTL = time.Minute * 5
+	// How long to wait before asking a provider that failed to describe itself again
+	describeRetryAfter = time.Second * 30
+	// How long to wait for a provider to describe itself
+	describeTimeout = time.Second * 2
+)
+
+// The routes in the same format as the proto comments
+var routePaths = map[authentication.Route]string{
+	authentication.Route_ROUTE_LOGIN_GET:    "GET:/login",
+	authentication.Route_ROUTE_LOGIN_POST:   "POST:/login",
+	authentication.Route_ROUTE_CALLBACK_GET: "GET:/login/callback",
+}
+
+type description struct {
+	res     *authentication.DescribeResponse
+	expires time.Time
+}
+
+// Descriptions caches what each provider supports so they aren't asked on
+// every request
+type Descriptions struct {
+	mu    sync.RWMutex
+	cache map[string]*description
+
+	// Shares a describe call between everyone waiting for the same provider
+	group singleflight.Group
+}
+
+func NewDescriptions() *Descriptions {
+	return &Descriptions{
+		cache: map[string]*description{},
+	}
+}
+
+// Get returns the provider's description, asking the provider if it's not
+// cached. Returns nil if the provider can't describe itself.
+func (d *Descriptions) Get(ctx context.Context, provider config.Provider) *authentication.DescribeResponse {
+	if res, ok := d.cached(provider.ID); ok {
+		return res
+	}
+
+	res, _, _ := d.group.Do(provider.ID, func() (any, error) {
+		// Another caller may have finished describing it while this waited
+		if res, ok := d.cached(provider.ID); ok {
+			return res, nil
+		}
+		// The call is shared, so one caller giving up mustn't cancel it
+		return d.describe(context.WithoutCancel(ctx), provider), nil
+	})
+
+	return res.(*authentication.DescribeResponse)
+}
+
+// Models returns each provider with its description, in the order given. The
+// providers are described in parallel.
+func (d *Descriptions) Models(ctx context.Context, providers []config.Provider) []models.ProviderModel {
+	list := make([]models.ProviderModel, len(providers))
+
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list[i] = d.Model(ctx, provider)
+		}()
+	}
+	wg.Wait()
+
+	return list
+}
+
+// Model returns the provider with its description, if it has one
+func (d *Descriptions) Model(ctx context.Context, provider config.Provider) models.ProviderModel {
+	model := models.ProviderModel{
+		ID:   provider.ID,
+		Name: provider.Name,
+	}
+
+	res := d.Get(ctx, provider)
+	if res == nil {
+		return model
+	}
+
+	model.Capabilities = &models.ProviderCapabilities{
+		Linking: res.Linking,
+		Refresh: res.Refresh,
+		Revoke:  res.Revoke,
+	}
+
+	if display := res.Display; display != nil {
+		model.Display = &models.ProviderDisplay{}
+		if display.Icon != nil {
+			model.Display.Icon = *display.Icon
+		}
+		if display.ButtonColour != nil {
+			model.Display.ButtonColour = *display.ButtonColour
+		}
+	}
+
+	model.Routes = make([]string, 0, len(res.Routes))
+	for _, route := range res.Routes {
+		if path, ok := routePaths[route]; ok {
+			model.Routes = append(model.Routes, path)
+		}
+	}
+
+	return model
+}
+
+// SupportsRefresh returns false if the provider said it can't refresh tokens.
+// Providers that can't describe themselves are allowed.
+func (d *Descriptions) SupportsRefresh(ctx context.Context, provider config.Provider) bool {
+	res := d.Get(ctx, provider)
+	return res == nil || res.Refresh
+}
+
+// SupportsLinking returns false if the provider said it can't be linked to
+// an existing user. Providers that can't describe themselves are allowed.
+func (d *Descriptions) SupportsLinking(ctx context.Context, provider config.Provider) bool {
+	res := d.Get(ctx, provider)
+	return res == nil || res.Linking
+}
+
+// Returns the cached description if it hasn't expired
+func (d *Descriptions) cached(providerID string) (*authentication.DescribeResponse, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	cached, ok := d.cache[providerID]
+	if !ok || !cached.expires.After(time.Now()) {
+		return nil, false
+	}
+
+	return cached.res, true
+}
+
+// Asks the provider to describe itself and caches the result
+func (d *Descriptions) describe(ctx context.Context, provider config.Provider) *authentication.DescribeResponse {
+	now := time.Now()
+	l := log.With().Str("providerID", provider.ID).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+
+	l.Debug().Msg("Triggering describe call to gRPC provider")
+	res, err := provider.Client.Describe(ctx, &authentication.DescribeRequest{})
+	if err != nil {
+		l.Warn().Err(err).Msg("Error describing gRPC provider")
+
+		// Keep any previous description until the provider is asked again
+		res = nil
+		d.mu.RLock()
+		if cached, ok := d.cache[provider.ID]; ok {
+			res = cached.res
+		}
+		d.mu.RUnlock()
+		d.set(provider.ID, res, now.Add(describeRetryAfter))
+
+		return res
+	}
+
+	d.set(provider.ID, res, now.Add(describeCacheTTL))
+
+	return res
+}
+
+func (d *Descriptions) set(providerID string, res *authentication.DescribeResponse, expires time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.cache[providerID] = &description{
+		res:     res,
+		expires: expires,
+	}
+}
@@ -17,9 +17,12 @@
 package providers
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
 	"github.com/mrsimonemms/opensesame/packages/authentication/v1"
 	"github.com/rs/zerolog/log"
@@ -91,6 +94,68 @@ func Authenticate(c *fiber.Ctx, provider config.Provider) (*authentication.User,
 	return nil, fiber.ErrUnauthorized
 }
 
+// Exchange the user's refresh token with the remote provider
+func RefreshTokens(
+	ctx context.Context,
+	provider config.Provider,
+	providerUserID string,
+	tokens map[string]string,
+) (*authentication.RefreshTokensResponse, error) {
+	l := log.With().Str("providerID", provider.ID).Logger()
+
+	l.Debug().Msg("Triggering token refresh with gRPC provider")
+	res, err := provider.Client.RefreshTokens(ctx, &authentication.RefreshTokensRequest{
+		ProviderId: providerUserID,
+		Tokens:     tokens,
+	})
+	if err != nil {
+		grpcError := status.Convert(err)
+
+		l.Warn().
+			Err(err).
+			Uint32("grpcCode", uint32(grpcError.Code())).
+			Str("errorMsg", grpcError.Message()).
+			Msg("Error refreshing tokens with gRPC provider")
+
+		switch grpcError.Code() {
+		case codes.Unimplemented:
+			return nil, fmt.Errorf("%w: %w: %s does not support refreshing tokens", common.ErrRefreshFailed, common.ErrRefreshRejected, provider.ID)
+		case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied, codes.FailedPrecondition:
+			// Retrying won't help - the refresh token is missing, expired or revoked
+			return nil, fmt.Errorf("%w: %w: %s", common.ErrRefreshFailed, common.ErrRefreshRejected, grpcError.Message())
+		}
+		return nil, fmt.Errorf("%w: %s", common.ErrRefreshFailed, grpcError.Message())
+	}
+
+	return res, nil
+}
+
+// Revoke the user's tokens with the remote provider
+func Revoke(ctx context.Context, provider config.Provider, providerUserID string, tokens map[string]string) error {
+	l := log.With().Str("providerID", provider.ID).Logger()
+
+	l.Debug().Msg("Triggering token revocation with gRPC provider")
+	if _, err := provider.Client.Revoke(ctx, &authentication.RevokeRequest{
+		ProviderId: providerUserID,
+		Tokens:     tokens,
+	}); err != nil {
+		grpcError := status.Convert(err)
+
+		l.Warn().
+			Err(err).
+			Uint32("grpcCode", uint32(grpcError.Code())).
+			Str("errorMsg", grpcError.Message()).
+			Msg("Error revoking tokens with gRPC provider")
+
+		if grpcError.Code() == codes.Unimplemented {
+			return fmt.Errorf("%w: %s does not support revoking tokens", common.ErrRevokeFailed, provider.ID)
+		}
+		return fmt.Errorf("%w: %s", common.ErrRevokeFailed, grpcError.Message())
+	}
+
+	return nil
+}
+
 func FindProvider(providers []config.Provider, providerID string) *config.Provider {
 	var provider *config.Provider
 	for _, p := range providers {
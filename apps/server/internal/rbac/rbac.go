@@ -0,0 +1,306 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rbac
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+type Permission string
+
+const (
+	PermissionOrgAPIKeysWrite Permission = "org:api-keys:write"
+	PermissionOrgDelete       Permission = "org:delete"
+	PermissionOrgOwnersManage Permission = "org:owners:manage" // Grant or revoke the owner role
+	PermissionOrgRead         Permission = "org:read"
+	PermissionOrgRolesWrite   Permission = "org:roles:write"
+	PermissionOrgSCIM         Permission = "org:scim"        // Provision users and teams with SCIM
+	PermissionOrgTeamsRead    Permission = "org:teams:read"  // View every team
+	PermissionOrgTeamsWrite   Permission = "org:teams:write" // Manage every team
+	PermissionOrgUpdate       Permission = "org:update"
+	PermissionOrgUsersRead    Permission = "org:users:read"
+	PermissionOrgUsersWrite   Permission = "org:users:write"
+
+	PermissionTeamRead       Permission = "team:read"
+	PermissionTeamUpdate     Permission = "team:update"
+	PermissionTeamUsersWrite Permission = "team:users:write"
+)
+
+type builtInRole struct {
+	Name        string
+	Description string
+	Permissions []Permission
+}
+
+// The role catalogue - roles in descending order of privilege
+var builtInRoles = []builtInRole{
+	{
+		Name:        models.OrgRoleOwner,
+		Description: "Full control of the organisation",
+		Permissions: []Permission{
+			PermissionOrgAPIKeysWrite,
+			PermissionOrgDelete,
+			PermissionOrgOwnersManage,
+			PermissionOrgRead,
+			PermissionOrgRolesWrite,
+			PermissionOrgSCIM,
+			PermissionOrgTeamsRead,
+			PermissionOrgTeamsWrite,
+			PermissionOrgUpdate,
+			PermissionOrgUsersRead,
+			PermissionOrgUsersWrite,
+		},
+	},
+	{
+		Name:        models.OrgRoleMaintainer,
+		Description: "Manage the organisation and its members",
+		Permissions: []Permission{
+			PermissionOrgAPIKeysWrite,
+			PermissionOrgRead,
+			PermissionOrgRolesWrite,
+			PermissionOrgSCIM,
+			PermissionOrgTeamsRead,
+			PermissionOrgTeamsWrite,
+			PermissionOrgUpdate,
+			PermissionOrgUsersRead,
+			PermissionOrgUsersWrite,
+		},
+	},
+	{
+		Name:        models.OrgRoleMember,
+		Description: "View the organisation, its members and teams",
+		Permissions: []Permission{
+			PermissionOrgRead,
+			PermissionOrgTeamsRead,
+			PermissionOrgUsersRead,
+		},
+	},
+	{
+		Name:        models.OrgRoleViewer,
+		Description: "View the organisation",
+		Permissions: []Permission{
+			PermissionOrgRead,
+		},
+	},
+}
+
+// Team roles only apply to the team. Organisation permissions are inherited
+// on top of these.
+var teamRoles = map[string][]Permission{
+	models.TeamRoleMaintainer: {
+		PermissionTeamRead,
+		PermissionTeamUpdate,
+		PermissionTeamUsersWrite,
+	},
+	models.TeamRoleMember: {
+		PermissionTeamRead,
+	},
+}
+
+// Permissions that can only ever be held by owners
+var ownerOnlyPermissions = []Permission{
+	PermissionOrgDelete,
+	PermissionOrgOwnersManage,
+}
+
+var roleNameRegex = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
+
+// BuiltInRoles returns the role catalogue
+func BuiltInRoles() []*models.OrganisationRole {
+	roles := make([]*models.OrganisationRole, 0, len(builtInRoles))
+	for _, r := range builtInRoles {
+		role := &models.OrganisationRole{
+			Name:        r.Name,
+			Description: r.Description,
+			Permissions: make([]string, 0, len(r.Permissions)),
+			BuiltIn:     true,
+		}
+		for _, p := range r.Permissions {
+			role.Permissions = append(role.Permissions, string(p))
+		}
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// CanBeGrantedToAPIKey checks the permission can be used as an API key
+// scope. API keys cannot manage API keys.
+func CanBeGrantedToAPIKey(permission string) bool {
+	return CanBeGrantedToCustomRole(permission) && Permission(permission) != PermissionOrgAPIKeysWrite
+}
+
+// CanBeGrantedToCustomRole checks the permission exists and is not reserved for owners
+func CanBeGrantedToCustomRole(permission string) bool {
+	p := Permission(permission)
+
+	if slices.Contains(ownerOnlyPermissions, p) {
+		return false
+	}
+
+	for _, r := range builtInRoles {
+		if slices.Contains(r.Permissions, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanAssignRole checks the caller's role has every permission of the role, so
+// users can't give anyone, or take away, more than they can do themselves
+func CanAssignRole(org *models.Organisation, callerRole, role string) bool {
+	return containsAll(RolePermissions(org, callerRole), RolePermissions(org, role))
+}
+
+// HasPermission checks if the role grants the permission in the organisation
+func HasPermission(org *models.Organisation, role string, permission Permission) bool {
+	return slices.Contains(RolePermissions(org, role), permission)
+}
+
+// HasTeamPermission checks if the user has the permission in the team
+func HasTeamPermission(org *models.Organisation, team *models.Team, userID string, permission Permission) bool {
+	return slices.Contains(TeamPermissions(org, team, userID), permission)
+}
+
+// HigherRole returns whichever role grants every permission of the other. If
+// neither does, such as two unrelated custom roles, the first is returned.
+func HigherRole(org *models.Organisation, a, b string) string {
+	permissionsA := RolePermissions(org, a)
+	permissionsB := RolePermissions(org, b)
+
+	if !containsAll(permissionsA, permissionsB) && containsAll(permissionsB, permissionsA) {
+		return b
+	}
+	return a
+}
+
+// IsBuiltInRole checks if the role is in the role catalogue
+func IsBuiltInRole(role string) bool {
+	return findBuiltInRole(role) != nil
+}
+
+// IsValidRole checks if the role is either built-in or defined by the organisation
+func IsValidRole(org *models.Organisation, role string) bool {
+	return IsBuiltInRole(role) || org.FindRole(role) != nil
+}
+
+// IsValidRoleName checks the name of a custom role. Names are upper case
+// to match the built-in roles.
+func IsValidRoleName(name string) bool {
+	return roleNameRegex.MatchString(name)
+}
+
+// RolePermissions returns the permissions granted by the role. Built-in
+// roles take precedence over custom roles. Unknown roles have no permissions.
+func RolePermissions(org *models.Organisation, role string) []Permission {
+	if r := findBuiltInRole(role); r != nil {
+		return r.Permissions
+	}
+
+	if org == nil {
+		return nil
+	}
+
+	customRole := org.FindRole(role)
+	if customRole == nil {
+		return nil
+	}
+
+	permissions := make([]Permission, 0, len(customRole.Permissions))
+	for _, p := range customRole.Permissions {
+		// Ignore anything that could not have been granted
+		if CanBeGrantedToCustomRole(p) {
+			permissions = append(permissions, Permission(p))
+		}
+	}
+
+	return permissions
+}
+
+// APIKeyScopes returns the API key's scopes that its creator still has. A key
+// can do nothing once its creator leaves the organisation.
+func APIKeyScopes(org *models.Organisation, apiKey *models.APIKey) []string {
+	creator := org.FindUser(apiKey.CreatedBy)
+	if creator == nil {
+		return nil
+	}
+
+	scopes := make([]string, 0, len(apiKey.Scopes))
+	for _, s := range apiKey.Scopes {
+		if HasPermission(org, creator.Role, Permission(s)) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+// APIKeyTeamPermissions returns the team permissions inherited from an API
+// key's scopes. API keys cannot be team members.
+func APIKeyTeamPermissions(scopes []string) []Permission {
+	if slices.Contains(scopes, string(PermissionOrgTeamsWrite)) {
+		return teamRoles[models.TeamRoleMaintainer]
+	}
+	if slices.Contains(scopes, string(PermissionOrgTeamsRead)) {
+		return teamRoles[models.TeamRoleMember]
+	}
+	return nil
+}
+
+// TeamPermissions returns the user's permissions in the team. These come from
+// their team role and are inherited from their organisation role - anyone
+// who can manage every team can manage this one.
+func TeamPermissions(org *models.Organisation, team *models.Team, userID string) []Permission {
+	permissions := make([]Permission, 0)
+
+	if u := team.FindUser(userID); u != nil {
+		permissions = append(permissions, teamRoles[u.Role]...)
+	}
+
+	if member := org.FindUser(userID); member != nil {
+		if HasPermission(org, member.Role, PermissionOrgTeamsWrite) {
+			permissions = append(permissions, teamRoles[models.TeamRoleMaintainer]...)
+		} else if HasPermission(org, member.Role, PermissionOrgTeamsRead) {
+			permissions = append(permissions, teamRoles[models.TeamRoleMember]...)
+		}
+	}
+
+	slices.Sort(permissions)
+
+	return slices.Compact(permissions)
+}
+
+func containsAll(permissions, subset []Permission) bool {
+	for _, p := range subset {
+		if !slices.Contains(permissions, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func findBuiltInRole(role string) *builtInRole {
+	for _, r := range builtInRoles {
+		if r.Name == role {
+			return &r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/rbac"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Number of characters after the prefix that are kept to identify the key
+	apiKeyIdentifierLength = 8
+	// Avoid a database write on every request
+	apiKeyLastUsedInterval = time.Minute
+)
+
+type APIKeys struct {
+	cfg *config.ServerConfig
+	db  database.Driver
+}
+
+// Authenticate returns the API key if it's valid. Returns nil if the key is
+// unknown or expired, or its creator has been deactivated or deleted.
+func (a *APIKeys) Authenticate(ctx context.Context, key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, models.APIKeyPrefix) {
+		return nil, nil
+	}
+
+	apiKey, err := a.db.GetAPIKeyByHash(ctx, models.HashToken(key))
+	if err != nil {
+		return nil, fmt.Errorf("error getting api key: %w", err)
+	}
+	if apiKey == nil || apiKey.IsExpired() {
+		return nil, nil
+	}
+
+	// A key can do no more than its creator
+	active, err := a.db.FilterActiveUserIDs(ctx, []string{apiKey.CreatedBy})
+	if err != nil {
+		return nil, fmt.Errorf("error getting api key creator: %w", err)
+	}
+	if len(active) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedDate == nil || now.Sub(*apiKey.LastUsedDate) > apiKeyLastUsedInterval {
+		if err := a.db.UpdateAPIKeyLastUsed(ctx, apiKey.ID, now); err != nil {
+			// Not worth failing the request for
+			log.Warn().Err(err).Str("apiKeyId", apiKey.ID).Msg("Error updating api key last used")
+		}
+		apiKey.LastUsedDate = &now
+	}
+
+	return apiKey, nil
+}
+
+// CreateAPIKey generates a new API key for the organisation. The key is only
+// returned here - just the hash is stored. Users cannot grant scopes they do
+// not have themselves.
+func (a *APIKeys) CreateAPIKey(
+	ctx context.Context,
+	org *models.Organisation,
+	userID string,
+	input *models.APIKeyDTO,
+) (*models.APIKey, string, error) {
+	caller := org.FindUser(userID)
+	if caller == nil {
+		return nil, "", fmt.Errorf("%w: not a member of the organisation", common.ErrForbidden)
+	}
+
+	scopes := slices.Compact(slices.Sorted(slices.Values(input.Scopes)))
+	for _, s := range scopes {
+		if !rbac.CanBeGrantedToAPIKey(s) {
+			return nil, "", fmt.Errorf("%w: scope cannot be granted: %s", common.ErrInvalidScope, s)
+		}
+		if !rbac.HasPermission(org, caller.Role, rbac.Permission(s)) {
+			return nil, "", fmt.Errorf("%w: cannot grant scope: %s", common.ErrForbidden, s)
+		}
+	}
+
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		return nil, "", fmt.Errorf("%w: expiry is in the past", common.ErrInvalidExpiry)
+	}
+
+	secret, err := models.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating api key: %w", err)
+	}
+	key := models.APIKeyPrefix + secret
+
+	now := time.Now()
+	apiKey, err := a.db.SaveAPIKey(ctx, &models.APIKey{
+		OrgID:       org.ID,
+		Name:        input.Name,
+		Prefix:      key[:len(models.APIKeyPrefix)+apiKeyIdentifierLength],
+		KeyHash:     models.HashToken(key),
+		Scopes:      scopes,
+		CreatedBy:   userID,
+		ExpiresAt:   input.ExpiresAt,
+		CreatedDate: now,
+		UpdatedDate: now,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error saving api key: %w", err)
+	}
+
+	return apiKey, key, nil
+}
+
+func (a *APIKeys) DeleteAPIKey(ctx context.Context, orgID, keyID string) error {
+	return a.db.DeleteAPIKey(ctx, orgID, keyID)
+}
+
+func (a *APIKeys) ListAPIKeys(ctx context.Context, offset, limit int, orgID string) (*models.Pagination[*models.APIKey], error) {
+	return a.db.ListAPIKeys(ctx, offset, limit, orgID)
+}
+
+func NewAPIKeysStore(cfg *config.ServerConfig, db database.Driver) *APIKeys {
+	return &APIKeys{
+		cfg: cfg,
+		db:  db,
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+type apiKeysDriver struct {
+	database.Driver
+
+	apiKey      *models.APIKey
+	activeUsers []string
+}
+
+func (d *apiKeysDriver) FilterActiveUserIDs(_ context.Context, userIDs []string) ([]string, error) {
+	active := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if slices.Contains(d.activeUsers, id) {
+			active = append(active, id)
+		}
+	}
+	return active, nil
+}
+
+func (d *apiKeysDriver) GetAPIKeyByHash(_ context.Context, hash string) (*models.APIKey, error) {
+	if d.apiKey.KeyHash != hash {
+		return nil, nil
+	}
+	return d.apiKey, nil
+}
+
+func (d *apiKeysDriver) UpdateAPIKeyLastUsed(context.Context, string, time.Time) error {
+	return nil
+}
+
+func TestAPIKeyNeedsActiveCreator(t *testing.T) {
+	key := models.APIKeyPrefix + "secret"
+
+	tests := []struct {
+		Name        string
+		ActiveUsers []string
+		Valid       bool
+	}{
+		{
+			Name:        "active creator",
+			ActiveUsers: []string{"creator"},
+			Valid:       true,
+		},
+		{
+			Name:        "deactivated or deleted creator",
+			ActiveUsers: []string{"someone-else"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			db := &apiKeysDriver{
+				apiKey: &models.APIKey{
+					ID:        "key",
+					OrgID:     "org",
+					KeyHash:   models.HashToken(key),
+					CreatedBy: "creator",
+				},
+				activeUsers: test.ActiveUsers,
+			}
+
+			apiKey, err := NewAPIKeysStore(nil, db).Authenticate(context.Background(), key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (apiKey != nil) != test.Valid {
+				t.Errorf("expected valid to be %t, got key %+v", test.Valid, apiKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+type AuditEvents struct {
+	cfg *config.ServerConfig
+	db  database.Driver
+}
+
+// Record saves the audit event. This doesn't fail the request so errors
+// are only logged.
+func (a *AuditEvents) Record(ctx context.Context, event *models.AuditEvent) {
+	event.CreatedDate = time.Now()
+
+	if _, err := a.db.SaveAuditEvent(ctx, event); err != nil {
+		log.Error().Err(err).Str("userID", event.UserID).Str("action", string(event.Action)).Msg("Error recording audit event")
+	}
+}
+
+func NewAuditEventsStore(cfg *config.ServerConfig, db database.Driver) *AuditEvents {
+	return &AuditEvents{
+		cfg: cfg,
+		db:  db,
+	}
+}
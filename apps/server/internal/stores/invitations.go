@@ -0,0 +1,277 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/notifier"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/rbac"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Audience of the invitation token - prevents it being used as an auth token
+const invitationAudience = "invitation"
+
+type Invitations struct {
+	cfg      *config.ServerConfig
+	db       database.Driver
+	notifier notifier.Notifier
+}
+
+// AcceptInvitation adds the user to the organisation with the invited role.
+// The user is added before the invitation is marked as accepted so a failure
+// never leaves an accepted invitation without a member.
+func (i *Invitations) AcceptInvitation(ctx context.Context, token string, user *models.User) (*models.Organisation, error) {
+	invitation, err := i.verify(ctx, token, user)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := i.db.AddOrganisationUser(ctx, invitation.OrgID, &models.OrganisationUser{
+		UserID:      user.ID,
+		Role:        invitation.Role,
+		CreatedDate: now,
+		UpdatedDate: now,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := i.updateStatus(ctx, invitation, models.InvitationStatusAccepted, user.ID); err != nil {
+		// Revoked or responded to in the meantime - undo the membership
+		if rmErr := i.db.RemoveOrganisationUser(ctx, invitation.OrgID, user.ID); rmErr != nil {
+			log.Error().Err(rmErr).Str("invitationId", invitation.ID).Msg("Error removing user after failed invitation")
+		}
+		return nil, err
+	}
+
+	return i.db.GetOrgByID(ctx, invitation.OrgID, user.ID)
+}
+
+// CreateInvitation invites the email address to join the organisation and
+// sends them the invitation token. Callers can only invite with roles whose
+// permissions they have themselves.
+func (i *Invitations) CreateInvitation(
+	ctx context.Context,
+	org *models.Organisation,
+	userID string,
+	input *models.InvitationDTO,
+) (*models.Invitation, error) {
+	caller := org.FindUser(userID)
+	if caller == nil {
+		return nil, fmt.Errorf("%w: not a member of the organisation", common.ErrForbidden)
+	}
+
+	if !rbac.IsValidRole(org, input.Role) {
+		return nil, fmt.Errorf("%w: %s", common.ErrUnknownRole, input.Role)
+	}
+	if err := checkCanAssignRole(org, caller.Role, input.Role); err != nil {
+		return nil, err
+	}
+
+	emailAddress := strings.ToLower(strings.TrimSpace(input.EmailAddress))
+
+	existing, err := i.db.GetPendingInvitationByEmail(ctx, org.ID, emailAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error checking for existing invitation: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrInviteExists, emailAddress)
+	}
+
+	now := time.Now()
+	invitation, err := i.db.SaveInvitation(ctx, &models.Invitation{
+		OrgID:        org.ID,
+		EmailAddress: emailAddress,
+		Role:         input.Role,
+		Status:       models.InvitationStatusPending,
+		InvitedBy:    userID,
+		ExpiresAt:    now.Add(i.cfg.Invitations.ExpiresIn.Duration),
+		CreatedDate:  now,
+		UpdatedDate:  now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error saving invitation: %w", err)
+	}
+
+	token, err := i.generateToken(invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{
+		"expiresAt": invitation.ExpiresAt.Format(time.RFC3339),
+		"orgId":     org.ID,
+		"orgName":   org.Name,
+		"role":      invitation.Role,
+		"token":     token,
+	}
+	if acceptURL := i.acceptURL(token); acceptURL != "" {
+		data["acceptUrl"] = acceptURL
+	}
+
+	// The invitation is still valid if delivery fails - it can be revoked and resent
+	if err := i.notifier.Send(ctx, &notifier.Notification{
+		Type:         notifier.NotificationTypeInvitation,
+		EmailAddress: invitation.EmailAddress,
+		Data:         data,
+	}); err != nil {
+		log.Error().Err(err).Str("invitationId", invitation.ID).Msg("Error sending invitation")
+	}
+
+	return invitation, nil
+}
+
+// DeclineInvitation rejects the invitation so it can no longer be accepted
+func (i *Invitations) DeclineInvitation(ctx context.Context, token string, user *models.User) error {
+	invitation, err := i.verify(ctx, token, user)
+	if err != nil {
+		return err
+	}
+
+	return i.updateStatus(ctx, invitation, models.InvitationStatusDeclined, user.ID)
+}
+
+func (i *Invitations) ListInvitations(
+	ctx context.Context,
+	offset,
+	limit int,
+	orgID string,
+) (*models.Pagination[*models.Invitation], error) {
+	return i.db.ListInvitations(ctx, offset, limit, orgID)
+}
+
+// RevokeInvitation cancels a pending invitation. Returns ErrNotDeleted if
+// there is no pending invitation in the organisation.
+func (i *Invitations) RevokeInvitation(ctx context.Context, orgID, invitationID, userID string) error {
+	invitation, err := i.db.GetInvitationByID(ctx, invitationID)
+	if err != nil {
+		return fmt.Errorf("error getting invitation by id: %w", err)
+	}
+	if invitation == nil || invitation.OrgID != orgID || !invitation.IsPending() {
+		return common.ErrNotDeleted
+	}
+
+	updated, err := i.db.UpdateInvitationStatus(ctx, invitationID, models.InvitationStatusRevoked, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking invitation: %w", err)
+	}
+	if updated == nil {
+		return common.ErrNotDeleted
+	}
+
+	return nil
+}
+
+func (i *Invitations) acceptURL(token string) string {
+	if i.cfg.Invitations.AcceptURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(i.cfg.Invitations.AcceptURL)
+	if err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func (i *Invitations) generateToken(invitation *models.Invitation) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{invitationAudience},
+		ExpiresAt: jwt.NewNumericDate(invitation.ExpiresAt),
+		ID:        invitation.ID,
+		IssuedAt:  jwt.NewNumericDate(invitation.CreatedDate),
+		Issuer:    i.cfg.JWT.Issuer,
+	})
+
+	s, err := t.SignedString(i.cfg.JWT.Key)
+	if err != nil {
+		return "", fmt.Errorf("error signing invitation token: %w", err)
+	}
+
+	return s, nil
+}
+
+// Move the invitation out of pending
+func (i *Invitations) updateStatus(
+	ctx context.Context,
+	invitation *models.Invitation,
+	status models.InvitationStatus,
+	userID string,
+) error {
+	updated, err := i.db.UpdateInvitationStatus(ctx, invitation.ID, status, userID)
+	if err != nil {
+		return fmt.Errorf("error updating invitation status: %w", err)
+	}
+	if updated == nil {
+		// Responded to in the meantime
+		return common.ErrInvalidInvite
+	}
+
+	return nil
+}
+
+// Verify the token is for a pending invitation sent to the user's email address
+func (i *Invitations) verify(ctx context.Context, token string, user *models.User) (*models.Invitation, error) {
+	claims := &jwt.RegisteredClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		return i.cfg.JWT.Key, nil
+	},
+		jwt.WithAudience(invitationAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(i.cfg.JWT.Issuer),
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %w", common.ErrInvalidInvite, err)
+	}
+
+	invitation, err := i.db.GetInvitationByID(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting invitation by id: %w", err)
+	}
+	if invitation == nil || !invitation.IsPending() {
+		return nil, common.ErrInvalidInvite
+	}
+	if !strings.EqualFold(strings.TrimSpace(user.EmailAddress), invitation.EmailAddress) {
+		return nil, fmt.Errorf("%w: invitation was sent to a different email address", common.ErrForbidden)
+	}
+
+	return invitation, nil
+}
+
+func NewInvitationsStore(cfg *config.ServerConfig, db database.Driver, n notifier.Notifier) *Invitations {
+	return &Invitations{
+		cfg:      cfg,
+		db:       db,
+		notifier: n,
+	}
+}
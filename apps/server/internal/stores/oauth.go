@@ -0,0 +1,298 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// Number of organisations to retrieve per page when building claims
+const orgClaimsPageSize = 100
+
+type OAuth struct {
+	cfg *config.ServerConfig
+	db  database.Driver
+}
+
+// AuthenticateClient verifies the client ID and secret. Public clients
+// have no secret and are authenticated by their PKCE verifier instead.
+func (o *OAuth) AuthenticateClient(clientID, clientSecret string) (*config.OAuthClient, error) {
+	if o.cfg.OAuth == nil {
+		return nil, common.ErrInvalidClient
+	}
+
+	client := o.cfg.OAuth.FindClient(clientID)
+	if client == nil {
+		return nil, common.ErrInvalidClient
+	}
+
+	if client.Secret != "" && subtle.ConstantTimeCompare([]byte(client.Secret), []byte(clientSecret)) != 1 {
+		return nil, common.ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// CreateAuthorizationCode saves the code and returns the plain text
+// value. This is the only time the plain text value is available.
+func (o *OAuth) CreateAuthorizationCode(ctx context.Context, authCode *models.AuthorizationCode) (string, error) {
+	return o.createCode(ctx, authCode, o.cfg.OAuth.AuthCodeExpiresIn.Duration)
+}
+
+// CreateLoginCode creates a one-time code to exchange for the auth token
+// after login. It has no client ID so cannot be used as an OAuth code.
+func (o *OAuth) CreateLoginCode(ctx context.Context, userID, callback string) (string, error) {
+	return o.createCode(ctx, &models.AuthorizationCode{
+		RedirectURI: callback,
+		UserID:      userID,
+		AuthTime:    time.Now(),
+	}, o.cfg.Server.Callback.CodeExpiresIn.Duration)
+}
+
+// ExchangeAuthorizationCode consumes the code, checking it was issued to
+// this client and redirect URI and that the PKCE verifier matches
+func (o *OAuth) ExchangeAuthorizationCode(
+	ctx context.Context,
+	client *config.OAuthClient,
+	code,
+	redirectURI,
+	codeVerifier string,
+) (*models.AuthorizationCode, error) {
+	authCode, err := o.db.ConsumeAuthorizationCode(ctx, models.HashToken(code))
+	if err != nil {
+		return nil, fmt.Errorf("error consuming authorization code: %w", err)
+	}
+	if authCode == nil {
+		return nil, common.ErrInvalidGrant
+	}
+
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI {
+		return nil, common.ErrInvalidGrant
+	}
+
+	if authCode.CodeChallenge == "" {
+		if client.Secret == "" {
+			// Public clients must always use PKCE
+			return nil, common.ErrInvalidGrant
+		}
+		return authCode, nil
+	}
+
+	if !VerifyPKCE(authCode.CodeChallenge, authCode.CodeChallengeMethod, codeVerifier) {
+		return nil, common.ErrInvalidGrant
+	}
+
+	return authCode, nil
+}
+
+// ExchangeLoginCode consumes the login code, checking it was issued for
+// the callback URL
+func (o *OAuth) ExchangeLoginCode(ctx context.Context, code, callback string) (*models.AuthorizationCode, error) {
+	authCode, err := o.db.ConsumeAuthorizationCode(ctx, models.HashToken(code))
+	if err != nil {
+		return nil, fmt.Errorf("error consuming login code: %w", err)
+	}
+	if authCode == nil || authCode.ClientID != "" || authCode.RedirectURI != callback {
+		return nil, common.ErrInvalidGrant
+	}
+
+	return authCode, nil
+}
+
+// GenerateIDToken creates the OpenID Connect ID token for the user
+func (o *OAuth) GenerateIDToken(ctx context.Context, user *models.User, authCode *models.AuthorizationCode) (string, error) {
+	claims, err := o.UserClaims(ctx, user, authCode.Scope)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims["aud"] = authCode.ClientID
+	claims["auth_time"] = authCode.AuthTime.Unix()
+	claims["exp"] = now.Add(o.cfg.OAuth.IDTokenExpiresIn.Duration).Unix()
+	claims["iat"] = now.Unix()
+	claims["iss"] = o.cfg.OAuth.Issuer
+	if authCode.Nonce != "" {
+		claims["nonce"] = authCode.Nonce
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = o.KeyID()
+
+	s, err := t.SignedString(o.cfg.OAuth.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("error signing id token: %w", err)
+	}
+
+	return s, nil
+}
+
+// JWKS returns the public keys used to sign the ID tokens
+func (o *OAuth) JWKS() *models.JSONWebKeySet {
+	pub := o.cfg.OAuth.PrivateKey.PublicKey
+
+	return &models.JSONWebKeySet{
+		Keys: []models.JSONWebKey{
+			{
+				Algorithm: jwt.SigningMethodRS256.Alg(),
+				Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+				KeyID:     o.KeyID(),
+				KeyType:   "RSA",
+				Modulus:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				Use:       "sig",
+			},
+		},
+	}
+}
+
+// KeyID is a stable identifier for the signing key, derived from the public key
+func (o *OAuth) KeyID() string {
+	h := sha256.Sum256(o.cfg.OAuth.PrivateKey.N.Bytes())
+	return hex.EncodeToString(h[:8])
+}
+
+// ListOrganisationClaims returns every organisation the user is a member of
+func (o *OAuth) ListOrganisationClaims(ctx context.Context, userID string) ([]*models.OrganisationClaim, error) {
+	claims := make([]*models.OrganisationClaim, 0)
+
+	for offset := 0; ; offset += orgClaimsPageSize {
+		orgs, err := o.db.ListOrganisations(ctx, offset, orgClaimsPageSize, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing organisations: %w", err)
+		}
+
+		for _, org := range orgs.Data {
+			for _, u := range org.Users {
+				if u.UserID == userID {
+					claims = append(claims, &models.OrganisationClaim{
+						ID:    org.ID,
+						Slug:  org.Slug,
+						Role:  u.Role,
+						Teams: teamClaims(org, userID),
+					})
+				}
+			}
+		}
+
+		if int64(offset+orgClaimsPageSize) >= orgs.Total {
+			break
+		}
+	}
+
+	return claims, nil
+}
+
+// UserClaims returns the claims the given scope allows to be shared
+func (o *OAuth) UserClaims(ctx context.Context, user *models.User, scope string) (jwt.MapClaims, error) {
+	scopes := strings.Fields(scope)
+
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+	}
+
+	if slices.Contains(scopes, models.OAuthScopeProfile) {
+		claims["name"] = user.Name
+		if user.AvatarURL != "" {
+			claims["picture"] = user.AvatarURL
+		}
+		claims["updated_at"] = user.UpdatedDate.Unix()
+	}
+
+	if slices.Contains(scopes, models.OAuthScopeEmail) {
+		claims["email"] = user.EmailAddress
+	}
+
+	if slices.Contains(scopes, models.OAuthScopeOrgs) {
+		orgs, err := o.ListOrganisationClaims(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		claims["orgs"] = orgs
+	}
+
+	return claims, nil
+}
+
+func (o *OAuth) createCode(ctx context.Context, authCode *models.AuthorizationCode, expiresIn time.Duration) (string, error) {
+	code, err := models.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	authCode.CodeHash = models.HashToken(code)
+	authCode.CreatedDate = now
+	authCode.ExpiresAt = now.Add(expiresIn)
+
+	if _, err := o.db.SaveAuthorizationCode(ctx, authCode); err != nil {
+		return "", fmt.Errorf("error saving code: %w", err)
+	}
+
+	return code, nil
+}
+
+func NewOAuthStore(cfg *config.ServerConfig, db database.Driver) *OAuth {
+	return &OAuth{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+// VerifyPKCE checks the code verifier against the challenge. Only the
+// S256 method is supported.
+func VerifyPKCE(challenge, method, verifier string) bool {
+	if method != models.PKCEMethodS256 || verifier == "" {
+		return false
+	}
+
+	h := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// The teams in the organisation the user is a member of
+func teamClaims(org *models.Organisation, userID string) []*models.TeamClaim {
+	var claims []*models.TeamClaim
+	for _, t := range org.Teams {
+		if u := t.FindUser(userID); u != nil {
+			claims = append(claims, &models.TeamClaim{
+				ID:   t.ID,
+				Slug: t.Slug,
+				Role: u.Role,
+			})
+		}
+	}
+	return claims
+}
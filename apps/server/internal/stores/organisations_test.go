@@ -0,0 +1,112 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/rbac"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+func TestCustomRoleCannotPromoteToMaintainer(t *testing.T) {
+	org := &models.Organisation{
+		ID:      "org",
+		OwnerID: "owner",
+		Roles: []*models.OrganisationRole{
+			{
+				Name: "USER_ADMIN",
+				Permissions: []string{
+					string(rbac.PermissionOrgRead),
+					string(rbac.PermissionOrgUsersRead),
+					string(rbac.PermissionOrgUsersWrite),
+				},
+			},
+		},
+		Users: []*models.OrganisationUser{
+			{UserID: "owner", Role: models.OrgRoleOwner},
+			{UserID: "admin", Role: "USER_ADMIN"},
+			{UserID: "member", Role: models.OrgRoleMember},
+		},
+	}
+
+	// The checks must fail before the database is used
+	orgs := NewOrganisationsStore(nil, nil)
+	invitations := NewInvitationsStore(nil, nil, nil)
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{
+			name: "promote a member",
+			run: func() error {
+				_, err := orgs.UpdateUserRole(context.Background(), org, "admin", "member", models.OrgRoleMaintainer)
+				return err
+			},
+		},
+		{
+			name: "promote themselves",
+			run: func() error {
+				_, err := orgs.UpdateUserRole(context.Background(), org, "admin", "admin", models.OrgRoleMaintainer)
+				return err
+			},
+		},
+		{
+			name: "add a maintainer",
+			run: func() error {
+				_, err := orgs.AddUser(context.Background(), org, "admin", &models.OrgUserDTO{
+					UserID: "new",
+					Role:   models.OrgRoleMaintainer,
+				})
+				return err
+			},
+		},
+		{
+			name: "invite a maintainer",
+			run: func() error {
+				_, err := invitations.CreateInvitation(context.Background(), org, "admin", &models.InvitationDTO{
+					EmailAddress: "test@test.com",
+					Role:         models.OrgRoleMaintainer,
+				})
+				return err
+			},
+		},
+		{
+			name: "set the organisation's users",
+			run: func() error {
+				_, err := orgs.diffOrganisationUsers(context.Background(), org, "USER_ADMIN", []*models.OrgUserDTO{
+					{UserID: "owner", Role: models.OrgRoleOwner},
+					{UserID: "admin", Role: models.OrgRoleMaintainer},
+					{UserID: "member", Role: models.OrgRoleMember},
+				}, org.CreatedDate)
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.run(); !errors.Is(err, common.ErrForbidden) {
+				t.Errorf("expected forbidden error, got %v", err)
+			}
+		})
+	}
+}
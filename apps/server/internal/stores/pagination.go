@@ -0,0 +1,45 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// Page size used when every record is needed
+const listAllPageSize = 100
+
+// listAll collects every page of a paginated list
+func listAll[T any](list func(offset, limit int) (*models.Pagination[T], error)) ([]T, error) {
+	result := make([]T, 0)
+
+	for offset := 0; ; offset += listAllPageSize {
+		page, err := list(offset, listAllPageSize)
+		if err != nil {
+			return nil, err
+		}
+		if page == nil {
+			return result, nil
+		}
+
+		result = append(result, page.Data...)
+
+		if len(page.Data) < listAllPageSize || int64(len(result)) >= page.Total {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+type PersonalAccessTokens struct {
+	cfg *config.ServerConfig
+	db  database.Driver
+}
+
+// Authenticate returns the token and the user it belongs to if it's valid.
+// Returns nil if the token is unknown or expired or the user is deactivated.
+func (p *PersonalAccessTokens) Authenticate(
+	ctx context.Context,
+	key string,
+) (*models.PersonalAccessToken, *models.User, error) {
+	if !strings.HasPrefix(key, models.PersonalAccessTokenPrefix) {
+		return nil, nil, nil
+	}
+
+	token, err := p.db.GetPersonalAccessTokenByHash(ctx, models.HashToken(key))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting personal access token: %w", err)
+	}
+	if token == nil || token.IsExpired() {
+		return nil, nil, nil
+	}
+
+	user, err := p.db.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting personal access token user: %w", err)
+	}
+	if user == nil || !user.IsActive {
+		return nil, nil, nil
+	}
+
+	now := time.Now()
+	if token.LastUsedDate == nil || now.Sub(*token.LastUsedDate) > apiKeyLastUsedInterval {
+		if err := p.db.UpdatePersonalAccessTokenLastUsed(ctx, token.ID, now); err != nil {
+			// Not worth failing the request for
+			log.Warn().Err(err).Str("tokenId", token.ID).Msg("Error updating personal access token last used")
+		}
+		token.LastUsedDate = &now
+	}
+
+	return token, user, nil
+}
+
+// CreatePersonalAccessToken generates a new token for the principal's user.
+// The token is only returned here - just the hash is stored. A personal
+// access token cannot create a token with scopes it doesn't have or that
+// expires after it does.
+func (p *PersonalAccessTokens) CreatePersonalAccessToken(
+	ctx context.Context,
+	principal *models.Principal,
+	input *models.PersonalAccessTokenDTO,
+) (*models.PersonalAccessToken, string, error) {
+	scopes := slices.Compact(slices.Sorted(slices.Values(input.Scopes)))
+	for _, s := range scopes {
+		if !slices.Contains(models.PersonalAccessTokenScopes, s) {
+			return nil, "", fmt.Errorf("%w: unknown scope: %s", common.ErrInvalidScope, s)
+		}
+		if !principal.HasScope(s) {
+			return nil, "", fmt.Errorf("%w: cannot grant scope: %s", common.ErrForbidden, s)
+		}
+	}
+
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		return nil, "", fmt.Errorf("%w: expiry is in the past", common.ErrInvalidExpiry)
+	}
+	if principal.Type == models.PrincipalTypePersonalAccessToken && principal.Token.ExpiresAt != nil {
+		if input.ExpiresAt == nil || input.ExpiresAt.After(*principal.Token.ExpiresAt) {
+			return nil, "", fmt.Errorf("%w: cannot expire after the token creating it", common.ErrInvalidExpiry)
+		}
+	}
+
+	secret, err := models.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating personal access token: %w", err)
+	}
+	key := models.PersonalAccessTokenPrefix + secret
+
+	now := time.Now()
+	token, err := p.db.SavePersonalAccessToken(ctx, &models.PersonalAccessToken{
+		UserID:      principal.User.ID,
+		Name:        input.Name,
+		Prefix:      key[:len(models.PersonalAccessTokenPrefix)+apiKeyIdentifierLength],
+		TokenHash:   models.HashToken(key),
+		Scopes:      scopes,
+		ExpiresAt:   input.ExpiresAt,
+		CreatedDate: now,
+		UpdatedDate: now,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error saving personal access token: %w", err)
+	}
+
+	return token, key, nil
+}
+
+func (p *PersonalAccessTokens) DeletePersonalAccessToken(ctx context.Context, userID, tokenID string) error {
+	return p.db.DeletePersonalAccessToken(ctx, userID, tokenID)
+}
+
+func (p *PersonalAccessTokens) ListPersonalAccessTokens(
+	ctx context.Context,
+	offset,
+	limit int,
+	userID string,
+) (*models.Pagination[*models.PersonalAccessToken], error) {
+	return p.db.ListPersonalAccessTokens(ctx, offset, limit, userID)
+}
+
+func NewPersonalAccessTokensStore(cfg *config.ServerConfig, db database.Driver) *PersonalAccessTokens {
+	return &PersonalAccessTokens{
+		cfg: cfg,
+		db:  db,
+	}
+}
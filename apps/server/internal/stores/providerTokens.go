@@ -0,0 +1,305 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/providers"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+// GetProviderAccount returns the user's provider account with the tokens
+// decrypted. Expired tokens are refreshed first where the provider supports
+// it, otherwise the stored tokens are returned.
+func (s *Users) GetProviderAccount(ctx context.Context, userID, providerID string) (*models.ProviderAccount, error) {
+	unlock := s.lockProviderTokens(userID, providerID)
+	defer unlock()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, fmt.Errorf("%w: %s", common.ErrUserDeactivated, user.ID)
+	}
+
+	account, ok := user.Accounts[providerID]
+	if !ok {
+		return nil, fmt.Errorf("%w: provider not registered: %s", common.ErrInvalidProvider, providerID)
+	}
+
+	if account.TokensExpireBefore(time.Now()) {
+		refreshed, err := s.refreshProviderTokens(ctx, user, providerID)
+		if err == nil {
+			return refreshed, nil
+		}
+		log.Warn().Err(err).Str("userID", user.ID).Str("providerID", providerID).Msg("Error refreshing expired provider tokens")
+
+		// The failed refresh may have decrypted them already
+		user, err = s.getUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		account = user.Accounts[providerID]
+	}
+
+	if err := account.DecryptTokens(s.cfg); err != nil {
+		return nil, fmt.Errorf("error decrypting account tokens: %w", err)
+	}
+
+	return account, nil
+}
+
+// RefreshExpiringTokens refreshes the provider tokens that expire within the
+// refresh window. Failures are logged so one user can't block the others.
+// Providers that say they can't refresh tokens are skipped.
+func (s *Users) RefreshExpiringTokens(ctx context.Context) error {
+	before := time.Now().Add(s.cfg.Users.RefreshWindow.Duration)
+
+	for _, provider := range s.cfg.Providers {
+		if provider.Disabled || !s.descriptions.SupportsRefresh(ctx, provider) {
+			continue
+		}
+
+		users, err := s.db.ListUsersWithExpiringTokens(ctx, provider.ID, before)
+		if err != nil {
+			return fmt.Errorf("error listing users with expiring tokens: %w", err)
+		}
+
+		var count int
+		for _, user := range users {
+			refreshed, err := s.refreshExpiringProviderTokens(ctx, user.ID, provider.ID, before)
+			if err != nil {
+				log.Warn().Err(err).Str("userID", user.ID).Str("providerID", provider.ID).Msg("Error refreshing provider tokens")
+				continue
+			}
+			if refreshed {
+				count++
+			}
+		}
+
+		if count > 0 {
+			log.Info().Int("count", count).Str("providerID", provider.ID).Msg("Refreshed provider tokens")
+		}
+	}
+
+	return nil
+}
+
+// RefreshProviderTokens exchanges the user's refresh token with the provider
+// and returns the account with the new tokens decrypted
+func (s *Users) RefreshProviderTokens(ctx context.Context, userID, providerID string) (*models.ProviderAccount, error) {
+	unlock := s.lockProviderTokens(userID, providerID)
+	defer unlock()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, fmt.Errorf("%w: %s", common.ErrUserDeactivated, user.ID)
+	}
+
+	return s.refreshProviderTokens(ctx, user, providerID)
+}
+
+// LogoutUser revokes the auth tokens issued to the user and, if asked, their
+// tokens with each provider. Provider failures are returned rather than
+// stopping the user logging out.
+func (s *Users) LogoutUser(ctx context.Context, userID string, revokeProviders bool) ([]*models.ProviderRevocation, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	revocations := make([]*models.ProviderRevocation, 0)
+	revoked := make([]string, 0)
+	if revokeProviders {
+		providerIDs := slices.Sorted(maps.Keys(user.Accounts))
+
+		// Stop a refresh rotating the tokens while they're revoked
+		unlock := s.lockProviderTokens(userID, providerIDs...)
+		defer unlock()
+
+		// Read again in case a refresh finished while waiting for the locks
+		user, err = s.getUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, providerID := range providerIDs {
+			account, ok := user.Accounts[providerID]
+			if !ok {
+				continue
+			}
+
+			revocation := s.revokeProviderTokens(ctx, providerID, account)
+			if revocation.Revoked {
+				// Revoked tokens are no use to anyone
+				revoked = append(revoked, providerID)
+			}
+			revocations = append(revocations, revocation)
+		}
+	}
+
+	user.RevokeAuthTokens()
+
+	if err := s.db.RevokeUserTokens(ctx, user.ID, *user.TokensValidAfter, revoked); err != nil {
+		return nil, err
+	}
+
+	return revocations, nil
+}
+
+// Takes the locks for changing the user's tokens with each provider. Providers
+// may rotate the refresh token, so two refreshes at once can leave the user
+// with revoked tokens. This only covers this server - the database updates stop
+// another server's refresh overwriting anything other than the tokens.
+func (s *Users) lockProviderTokens(userID string, providerIDs ...string) (unlock func()) {
+	// Providers can share a lock, so each is taken once and in order
+	locks := make([]int, 0, len(providerIDs))
+	for _, providerID := range providerIDs {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(userID + "/" + providerID))
+		locks = append(locks, int(h.Sum32()%uint32(len(s.tokenLocks))))
+	}
+	slices.Sort(locks)
+	locks = slices.Compact(locks)
+
+	for _, i := range locks {
+		s.tokenLocks[i].Lock()
+	}
+
+	return func() {
+		for _, i := range locks {
+			s.tokenLocks[i].Unlock()
+		}
+	}
+}
+
+// Refreshes the user's provider tokens if they still expire before the given
+// time - they may have been refreshed since the user was listed
+func (s *Users) refreshExpiringProviderTokens(ctx context.Context, userID, providerID string, before time.Time) (bool, error) {
+	unlock := s.lockProviderTokens(userID, providerID)
+	defer unlock()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	account, ok := user.Accounts[providerID]
+	if !user.IsActive || !ok || !account.TokensExpireBefore(before) {
+		return false, nil
+	}
+
+	if _, err := s.refreshProviderTokens(ctx, user, providerID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Refreshes the user's provider tokens. The caller must hold the lock from
+// lockProviderTokens.
+func (s *Users) refreshProviderTokens(ctx context.Context, user *models.User, providerID string) (*models.ProviderAccount, error) {
+	account, ok := user.Accounts[providerID]
+	if !ok {
+		return nil, fmt.Errorf("%w: provider not registered: %s", common.ErrInvalidProvider, providerID)
+	}
+
+	provider := providers.FindProvider(s.cfg.Providers, providerID)
+	if provider == nil || provider.Disabled {
+		return nil, fmt.Errorf("%w: provider not enabled: %s", common.ErrInvalidProvider, providerID)
+	}
+
+	if err := account.DecryptTokens(s.cfg); err != nil {
+		return nil, fmt.Errorf("error decrypting account tokens: %w", err)
+	}
+
+	res, err := providers.RefreshTokens(ctx, *provider, account.ProviderUserID, account.Tokens)
+	if err != nil {
+		if errors.Is(err, common.ErrRefreshRejected) {
+			// Stop the tokens being retried in the background until the user next logs in
+			if _, err := s.db.UpdateProviderTokens(ctx, user.ID, providerID, nil, nil); err != nil {
+				log.Warn().Err(err).Str("userID", user.ID).Str("providerID", providerID).Msg("Error clearing provider token expiry")
+			}
+		}
+		return nil, err
+	}
+
+	account.RefreshTokens(res.Tokens, res.TokensExpireAt)
+
+	if err := account.EncryptTokens(s.cfg); err != nil {
+		return nil, fmt.Errorf("error encrypting account tokens: %w", err)
+	}
+
+	user, err = s.db.UpdateProviderTokens(ctx, user.ID, providerID, account.Tokens, account.TokensExpireAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving provider tokens: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: user deactivated or provider unlinked", common.ErrRefreshFailed)
+	}
+
+	account = user.Accounts[providerID]
+	if err := account.DecryptTokens(s.cfg); err != nil {
+		return nil, fmt.Errorf("error decrypting account tokens: %w", err)
+	}
+
+	return account, nil
+}
+
+// Revokes the account's tokens with the provider, logging any failure
+func (s *Users) revokeProviderTokens(ctx context.Context, providerID string, account *models.ProviderAccount) *models.ProviderRevocation {
+	revocation := &models.ProviderRevocation{
+		ProviderID: providerID,
+	}
+
+	err := func() error {
+		provider := providers.FindProvider(s.cfg.Providers, providerID)
+		if provider == nil || provider.Disabled {
+			return fmt.Errorf("%w: provider not enabled: %s", common.ErrRevokeFailed, providerID)
+		}
+
+		// Decrypt a copy so the stored tokens are left untouched
+		decrypted := *account
+		decrypted.Tokens = maps.Clone(account.Tokens)
+		if err := decrypted.DecryptTokens(s.cfg); err != nil {
+			return fmt.Errorf("error decrypting account tokens: %w", err)
+		}
+
+		return providers.Revoke(ctx, *provider, decrypted.ProviderUserID, decrypted.Tokens)
+	}()
+	if err != nil {
+		log.Warn().Err(err).Str("providerID", providerID).Msg("Error revoking provider tokens")
+		revocation.Error = err.Error()
+		return revocation
+	}
+
+	revocation.Revoked = true
+	return revocation
+}
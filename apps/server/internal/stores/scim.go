@@ -0,0 +1,496 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// Maximum number of resources returned in one page
+const SCIMMaxResults = 100
+
+// Only the "eq" operator is supported, eg userName eq "test@test.com"
+var scimFilterRegex = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9.]*)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// SCIM maps SCIM users onto organisation members and SCIM groups onto teams
+type SCIM struct {
+	cfg *config.ServerConfig
+	db  database.Driver
+}
+
+type scimFilter struct {
+	attribute string // Lower case
+	value     string
+}
+
+// CreateUser creates a user with no provider accounts and adds them to the
+// organisation as a member. Existing users belong to themselves, so they are
+// never added - they must be invited. As no provider has verified their
+// email address, they are never linked to a provider login by it.
+func (s *SCIM) CreateUser(ctx context.Context, org *models.Organisation, input *models.SCIMUser) (*models.SCIMUser, error) {
+	existing, err := s.db.GetUserByEmailAddress(ctx, input.PrimaryEmail())
+	if err != nil {
+		return nil, fmt.Errorf("error getting user by email address: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrEmailInUse, input.PrimaryEmail())
+	}
+
+	user := models.NewUser()
+	user.Accounts = map[string]*models.ProviderAccount{}
+	applySCIMUser(user, input)
+
+	if user, err = s.db.SaveUserRecord(ctx, user); err != nil {
+		return nil, fmt.Errorf("error saving user record: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.db.AddOrganisationUser(ctx, org.ID, &models.OrganisationUser{
+		UserID:      user.ID,
+		Role:        models.OrgRoleMember,
+		Provisioned: true,
+		CreatedDate: now,
+		UpdatedDate: now,
+	}); err != nil {
+		return nil, err
+	}
+
+	return toSCIMUser(user), nil
+}
+
+// DeleteUser removes the provisioned user from the organisation. The user
+// itself is kept as they may belong to other organisations.
+func (s *SCIM) DeleteUser(ctx context.Context, org *models.Organisation, userID string) error {
+	if _, err := s.getProvisionedMember(ctx, org, userID); err != nil {
+		return err
+	}
+
+	return s.db.RemoveOrganisationUser(ctx, org.ID, userID)
+}
+
+func (s *SCIM) GetUser(ctx context.Context, org *models.Organisation, userID string) (*models.SCIMUser, error) {
+	user, err := s.getMember(ctx, org, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toSCIMUser(user), nil
+}
+
+// ListUsers returns the organisation's members. The start index is 1-based.
+func (s *SCIM) ListUsers(
+	ctx context.Context,
+	org *models.Organisation,
+	filter string,
+	startIndex,
+	count int,
+) (*models.SCIMListResponse[*models.SCIMUser], error) {
+	userIDs, err := s.filterUserIDs(ctx, org, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := scimPage(len(userIDs), startIndex, count)
+
+	resources := make([]*models.SCIMUser, 0, end-start)
+	for _, userID := range userIDs[start:end] {
+		user, err := s.db.GetUserByID(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting user by id: %w", err)
+		}
+		if user != nil {
+			resources = append(resources, toSCIMUser(user))
+		}
+	}
+
+	return newSCIMListResponse(resources, len(userIDs), start), nil
+}
+
+// PatchUser applies the SCIM patch operations to a user the organisation
+// provisioned. Setting active to false deactivates them.
+func (s *SCIM) PatchUser(
+	ctx context.Context,
+	org *models.Organisation,
+	userID string,
+	input *models.SCIMPatchRequest,
+) (*models.SCIMUser, error) {
+	user, err := s.getProvisionedMember(ctx, org, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	scimUser := toSCIMUser(user)
+	for _, op := range input.Operations {
+		if err := patchSCIMUser(scimUser, op); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.saveMember(ctx, org, user, scimUser)
+}
+
+// ReplaceUser replaces a user the organisation provisioned. Setting active to
+// false deactivates them.
+func (s *SCIM) ReplaceUser(
+	ctx context.Context,
+	org *models.Organisation,
+	userID string,
+	input *models.SCIMUser,
+) (*models.SCIMUser, error) {
+	user, err := s.getProvisionedMember(ctx, org, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.saveMember(ctx, org, user, input)
+}
+
+func (s *SCIM) filterUserIDs(ctx context.Context, org *models.Organisation, filter string) ([]string, error) {
+	f, err := parseSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if f == nil {
+		userIDs := make([]string, 0, len(org.Users))
+		for _, u := range org.Users {
+			userIDs = append(userIDs, u.UserID)
+		}
+		return userIDs, nil
+	}
+
+	switch f.attribute {
+	case "id":
+		if org.FindUser(f.value) != nil {
+			return []string{f.value}, nil
+		}
+	case "emails", "emails.value", "username":
+		users, err := s.db.ListUsersByEmailAddress(ctx, f.value)
+		if err != nil {
+			return nil, fmt.Errorf("error listing users by email address: %w", err)
+		}
+
+		// Other users may share the email address
+		userIDs := make([]string, 0)
+		for _, u := range users {
+			if org.FindUser(u.ID) != nil {
+				userIDs = append(userIDs, u.ID)
+			}
+		}
+		return userIDs, nil
+	case "externalid":
+		// External IDs aren't stored so never match
+	default:
+		return nil, fmt.Errorf("%w: unsupported attribute: %s", common.ErrInvalidFilter, f.attribute)
+	}
+
+	return []string{}, nil
+}
+
+func (s *SCIM) getMember(ctx context.Context, org *models.Organisation, userID string) (*models.User, error) {
+	if org.FindUser(userID) == nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrUnknownUser, userID)
+	}
+
+	user, err := s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user by id: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrUnknownUser, userID)
+	}
+
+	return user, nil
+}
+
+// The user may have joined other organisations since they were provisioned,
+// so only organisation members that were provisioned can be changed
+func (s *SCIM) getProvisionedMember(ctx context.Context, org *models.Organisation, userID string) (*models.User, error) {
+	user, err := s.getMember(ctx, org, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !org.FindUser(userID).Provisioned {
+		return nil, fmt.Errorf("%w: user was not provisioned by the organisation", common.ErrForbidden)
+	}
+
+	return user, nil
+}
+
+// Users only belong to the organisation while it provisioned them and they
+// haven't joined any other, so their details are only changed then
+func (s *SCIM) saveMember(
+	ctx context.Context,
+	org *models.Organisation,
+	user *models.User,
+	input *models.SCIMUser,
+) (*models.SCIMUser, error) {
+	orgs, err := s.db.ListOrganisations(ctx, 0, 2, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing user's organisations: %w", err)
+	}
+	if orgs.Total > 1 {
+		return nil, fmt.Errorf("%w: user belongs to other organisations", common.ErrForbidden)
+	}
+
+	if email := input.PrimaryEmail(); email != "" && email != user.EmailAddress {
+		existing, err := s.db.GetUserByEmailAddress(ctx, email)
+		if err != nil {
+			return nil, fmt.Errorf("error getting user by email address: %w", err)
+		}
+		if existing != nil && existing.ID != user.ID {
+			return nil, fmt.Errorf("%w: %s", common.ErrEmailInUse, email)
+		}
+	}
+
+	applySCIMUser(user, input)
+
+	deactivated := false
+	if input.Active != nil {
+		switch {
+		case *input.Active && !user.IsActive:
+			user.Reactivate()
+		case !*input.Active && user.IsActive:
+			user.Deactivate()
+			deactivated = true
+		}
+	}
+
+	if user, err = s.db.SaveUserRecord(ctx, user); err != nil {
+		return nil, fmt.Errorf("error saving user record: %w", err)
+	}
+
+	if deactivated {
+		if err := s.db.DeletePersonalAccessTokensByUser(ctx, user.ID); err != nil {
+			return nil, fmt.Errorf("error deleting personal access tokens: %w", err)
+		}
+	}
+
+	return toSCIMUser(user), nil
+}
+
+func NewSCIMStore(cfg *config.ServerConfig, db database.Driver) *SCIM {
+	return &SCIM{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+// Copy the SCIM attributes to the user. Attributes that aren't set are left alone.
+func applySCIMUser(user *models.User, input *models.SCIMUser) {
+	if email := input.PrimaryEmail(); email != "" {
+		user.EmailAddress = email
+	}
+	if name := input.FullName(); name != "" {
+		user.Name = name
+	}
+	user.UpdatedDate = time.Now()
+}
+
+func newSCIMListResponse[T any](resources []T, total, start int) *models.SCIMListResponse[T] {
+	return &models.SCIMListResponse[T]{
+		Schemas:      []string{models.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   start + 1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+func parseSCIMFilter(filter string) (*scimFilter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+
+	matches := scimFilterRegex.FindStringSubmatch(filter)
+	if matches == nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrInvalidFilter, filter)
+	}
+
+	return &scimFilter{
+		attribute: strings.ToLower(matches[1]),
+		value:     strings.ReplaceAll(matches[2], `\"`, `"`),
+	}, nil
+}
+
+func patchSCIMUser(user *models.SCIMUser, op *models.SCIMPatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		if op.Path != "" {
+			return setSCIMUserAttribute(user, op.Path, op.Value)
+		}
+
+		// No path means the value is a map of attributes
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return fmt.Errorf("%w: value must be an object without a path", common.ErrInvalidPatch)
+		}
+		for path, value := range values {
+			if err := setSCIMUserAttribute(user, path, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "remove":
+		if op.Path == "" {
+			return fmt.Errorf("%w: remove requires a path", common.ErrInvalidPatch)
+		}
+		return setSCIMUserAttribute(user, op.Path, nil)
+	default:
+		return fmt.Errorf("%w: unknown op: %s", common.ErrInvalidPatch, op.Op)
+	}
+}
+
+// Set the attribute on the user. A nil value removes the attribute.
+// Unsupported attributes are ignored.
+func setSCIMUserAttribute(user *models.SCIMUser, path string, value json.RawMessage) error {
+	path = strings.ToLower(path)
+
+	switch {
+	case path == "active":
+		active, err := parseSCIMBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = &active
+	case path == "displayname":
+		return unmarshalSCIMValue(value, &user.DisplayName)
+	case path == "externalid":
+		return unmarshalSCIMValue(value, &user.ExternalID)
+	case path == "username":
+		return unmarshalSCIMValue(value, &user.UserName)
+	case path == "emails":
+		return unmarshalSCIMValue(value, &user.Emails)
+	case strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value"):
+		// A filtered email, eg emails[type eq "work"].value, is treated as the primary one
+		var email string
+		if err := unmarshalSCIMValue(value, &email); err != nil {
+			return err
+		}
+		user.UserName = email
+		user.Emails = []*models.SCIMEmail{{Value: email, Type: "work", Primary: true}}
+	case path == "name" || strings.HasPrefix(path, "name."):
+		return setSCIMUserName(user, path, value)
+	}
+
+	return nil
+}
+
+func setSCIMUserName(user *models.SCIMUser, path string, value json.RawMessage) error {
+	// The display name would otherwise take precedence over the new name
+	user.DisplayName = ""
+	if user.Name == nil {
+		user.Name = &models.SCIMName{}
+	}
+
+	switch path {
+	case "name":
+		user.Name = &models.SCIMName{}
+		return unmarshalSCIMValue(value, user.Name)
+	case "name.formatted":
+		return unmarshalSCIMValue(value, &user.Name.Formatted)
+	case "name.familyname":
+		user.Name.Formatted = ""
+		return unmarshalSCIMValue(value, &user.Name.FamilyName)
+	case "name.givenname":
+		user.Name.Formatted = ""
+		return unmarshalSCIMValue(value, &user.Name.GivenName)
+	}
+
+	return nil
+}
+
+// Some identity providers send booleans as strings
+func parseSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+
+	return false, fmt.Errorf("%w: invalid boolean: %s", common.ErrInvalidPatch, string(value))
+}
+
+// Returns the slice bounds of the page. The start index is 1-based.
+func scimPage(total, startIndex, count int) (start, end int) {
+	start = min(max(startIndex, 1)-1, total)
+	end = min(start+min(max(count, 0), SCIMMaxResults), total)
+	return start, end
+}
+
+func toSCIMUser(user *models.User) *models.SCIMUser {
+	active := user.IsActive
+	scimUser := &models.SCIMUser{
+		Schemas:     []string{models.SCIMSchemaUser},
+		ID:          user.ID,
+		UserName:    user.EmailAddress,
+		Name:        &models.SCIMName{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []*models.SCIMEmail{},
+		Active:      &active,
+		Meta: &models.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedDate.Format(time.RFC3339),
+			LastModified: user.UpdatedDate.Format(time.RFC3339),
+		},
+	}
+
+	if user.EmailAddress != "" {
+		scimUser.Emails = append(scimUser.Emails, &models.SCIMEmail{
+			Value:   user.EmailAddress,
+			Type:    "work",
+			Primary: true,
+		})
+	}
+
+	return scimUser
+}
+
+// Unmarshal the value. A nil value sets the target to its zero value.
+func unmarshalSCIMValue[T any](value json.RawMessage, target *T) error {
+	if value == nil {
+		var zero T
+		*target = zero
+		return nil
+	}
+
+	if err := json.Unmarshal(value, target); err != nil {
+		return fmt.Errorf("%w: %w", common.ErrInvalidPatch, err)
+	}
+
+	return nil
+}
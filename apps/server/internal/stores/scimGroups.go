@@ -0,0 +1,336 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// Matches a filtered member path, eg members[value eq "123"]
+var scimMemberPathRegex = regexp.MustCompile(`(?i)^members\[value eq "([^"]*)"\]$`)
+
+var scimSlugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateGroup creates a team in the organisation. Members must already be
+// members of the organisation.
+func (s *SCIM) CreateGroup(ctx context.Context, org *models.Organisation, input *models.SCIMGroup) (*models.SCIMGroup, error) {
+	now := time.Now()
+	team := &models.Team{
+		Name:        input.DisplayName,
+		Slug:        scimSlug(input.DisplayName),
+		Users:       []*models.TeamUser{},
+		CreatedDate: now,
+		UpdatedDate: now,
+	}
+
+	if err := setSCIMGroupMembers(org, team, input.Members, false); err != nil {
+		return nil, err
+	}
+
+	team, err := s.db.SaveTeam(ctx, org.ID, team)
+	if err != nil {
+		return nil, err
+	}
+
+	return toSCIMGroup(org, team), nil
+}
+
+func (s *SCIM) DeleteGroup(ctx context.Context, org *models.Organisation, teamID string) error {
+	if org.FindTeam(teamID) == nil {
+		return fmt.Errorf("%w: %s", common.ErrTeamNotFound, teamID)
+	}
+
+	return s.db.DeleteTeam(ctx, org.ID, teamID)
+}
+
+func (s *SCIM) GetGroup(org *models.Organisation, teamID string) (*models.SCIMGroup, error) {
+	team := org.FindTeam(teamID)
+	if team == nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrTeamNotFound, teamID)
+	}
+
+	return toSCIMGroup(org, team), nil
+}
+
+// ListGroups returns the organisation's teams. The start index is 1-based.
+func (s *SCIM) ListGroups(
+	org *models.Organisation,
+	filter string,
+	startIndex,
+	count int,
+) (*models.SCIMListResponse[*models.SCIMGroup], error) {
+	f, err := parseSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	teams := make([]*models.Team, 0, len(org.Teams))
+	for _, t := range org.Teams {
+		match := true
+		if f != nil {
+			switch f.attribute {
+			case "displayname":
+				match = t.Name == f.value
+			case "id":
+				match = t.ID == f.value
+			case "externalid":
+				// External IDs aren't stored so never match
+				match = false
+			default:
+				return nil, fmt.Errorf("%w: unsupported attribute: %s", common.ErrInvalidFilter, f.attribute)
+			}
+		}
+		if match {
+			teams = append(teams, t)
+		}
+	}
+
+	start, end := scimPage(len(teams), startIndex, count)
+
+	resources := make([]*models.SCIMGroup, 0, end-start)
+	for _, t := range teams[start:end] {
+		resources = append(resources, toSCIMGroup(org, t))
+	}
+
+	return newSCIMListResponse(resources, len(teams), start), nil
+}
+
+// PatchGroup applies the SCIM patch operations to the team
+func (s *SCIM) PatchGroup(
+	ctx context.Context,
+	org *models.Organisation,
+	teamID string,
+	input *models.SCIMPatchRequest,
+) (*models.SCIMGroup, error) {
+	team := org.FindTeam(teamID)
+	if team == nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrTeamNotFound, teamID)
+	}
+
+	before := slices.Clone(team.Users)
+	for _, op := range input.Operations {
+		if err := patchSCIMGroup(org, team, op); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.saveGroup(ctx, org, team, before)
+}
+
+// ReplaceGroup replaces the team's name and members. The slug is unchanged.
+func (s *SCIM) ReplaceGroup(
+	ctx context.Context,
+	org *models.Organisation,
+	teamID string,
+	input *models.SCIMGroup,
+) (*models.SCIMGroup, error) {
+	team := org.FindTeam(teamID)
+	if team == nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrTeamNotFound, teamID)
+	}
+
+	before := slices.Clone(team.Users)
+	team.Name = input.DisplayName
+	if err := setSCIMGroupMembers(org, team, input.Members, false); err != nil {
+		return nil, err
+	}
+
+	return s.saveGroup(ctx, org, team, before)
+}
+
+// Save the team's details and apply the changes to its members one at a time,
+// so members changed by other requests in the meantime aren't overwritten
+func (s *SCIM) saveGroup(
+	ctx context.Context,
+	org *models.Organisation,
+	team *models.Team,
+	before []*models.TeamUser,
+) (*models.SCIMGroup, error) {
+	team.UpdatedDate = time.Now()
+
+	team, err := s.db.SaveTeam(ctx, org.ID, team)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range before {
+		if team.FindUser(u.UserID) == nil {
+			if err := s.db.RemoveTeamUser(ctx, org.ID, team.ID, u.UserID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, u := range team.Users {
+		if !slices.ContainsFunc(before, func(b *models.TeamUser) bool { return b.UserID == u.UserID }) {
+			if err := s.db.SaveTeamUser(ctx, org.ID, team.ID, u); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return toSCIMGroup(org, team), nil
+}
+
+func patchSCIMGroup(org *models.Organisation, team *models.Team, op *models.SCIMPatchOperation) error {
+	path := strings.ToLower(op.Path)
+
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		isAdd := strings.EqualFold(op.Op, "add")
+
+		switch path {
+		case "":
+			// No path means the value is a map of attributes
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return fmt.Errorf("%w: value must be an object without a path", common.ErrInvalidPatch)
+			}
+			for k, v := range values {
+				if err := patchSCIMGroup(org, team, &models.SCIMPatchOperation{Op: op.Op, Path: k, Value: v}); err != nil {
+					return err
+				}
+			}
+		case "displayname":
+			return unmarshalSCIMValue(op.Value, &team.Name)
+		case "members":
+			var members []*models.SCIMGroupMember
+			if err := unmarshalSCIMValue(op.Value, &members); err != nil {
+				return err
+			}
+			return setSCIMGroupMembers(org, team, members, isAdd)
+		}
+	case "remove":
+		return removeSCIMGroupMembers(team, op.Path, op.Value)
+	default:
+		return fmt.Errorf("%w: unknown op: %s", common.ErrInvalidPatch, op.Op)
+	}
+
+	return nil
+}
+
+// Remove either the members in the path, the members in the value or everyone
+func removeSCIMGroupMembers(team *models.Team, path string, value json.RawMessage) error {
+	var userIDs []string
+
+	if matches := scimMemberPathRegex.FindStringSubmatch(path); matches != nil {
+		userIDs = []string{matches[1]}
+	} else if !strings.EqualFold(path, "members") {
+		return fmt.Errorf("%w: unsupported path: %s", common.ErrInvalidPatch, path)
+	} else if value != nil {
+		var members []*models.SCIMGroupMember
+		if err := unmarshalSCIMValue(value, &members); err != nil {
+			return err
+		}
+		for _, m := range members {
+			userIDs = append(userIDs, m.Value)
+		}
+	}
+
+	users := make([]*models.TeamUser, 0, len(team.Users))
+	for _, u := range team.Users {
+		// Remove everyone if no members are given
+		if userIDs != nil && !slices.Contains(userIDs, u.UserID) {
+			users = append(users, u)
+		}
+	}
+	team.Users = users
+
+	return nil
+}
+
+// Set the team's members. If adding, existing members are kept. New members
+// join with the member role. Existing members keep their role.
+func setSCIMGroupMembers(org *models.Organisation, team *models.Team, members []*models.SCIMGroupMember, isAdd bool) error {
+	now := time.Now()
+
+	users := make([]*models.TeamUser, 0, len(members))
+	seen := map[string]bool{}
+	if isAdd {
+		users = append(users, team.Users...)
+		for _, u := range team.Users {
+			seen[u.UserID] = true
+		}
+	}
+
+	for _, m := range members {
+		if org.FindUser(m.Value) == nil {
+			return fmt.Errorf("%w: %s", common.ErrUnknownUser, m.Value)
+		}
+		if seen[m.Value] {
+			continue
+		}
+		seen[m.Value] = true
+
+		if u := team.FindUser(m.Value); u != nil {
+			users = append(users, u)
+			continue
+		}
+
+		users = append(users, &models.TeamUser{
+			UserID:      m.Value,
+			Role:        models.TeamRoleMember,
+			CreatedDate: now,
+			UpdatedDate: now,
+		})
+	}
+
+	team.Users = users
+
+	return nil
+}
+
+// Generate a slug from the group's name
+func scimSlug(name string) string {
+	slug := strings.Trim(scimSlugRegex.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		return "team"
+	}
+	return slug
+}
+
+func toSCIMGroup(org *models.Organisation, team *models.Team) *models.SCIMGroup {
+	group := &models.SCIMGroup{
+		Schemas:     []string{models.SCIMSchemaGroup},
+		ID:          team.ID,
+		DisplayName: team.Name,
+		Members:     make([]*models.SCIMGroupMember, 0, len(team.Users)),
+		Meta: &models.SCIMMeta{
+			ResourceType: "Group",
+			Created:      team.CreatedDate.Format(time.RFC3339),
+			LastModified: team.UpdatedDate.Format(time.RFC3339),
+		},
+	}
+
+	for _, u := range team.Users {
+		member := &models.SCIMGroupMember{Value: u.UserID}
+		if m := org.FindUser(u.UserID); m != nil {
+			member.Display = m.Name
+		}
+		group.Members = append(group.Members, member)
+	}
+
+	return group
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// Identifies a service account's client ID
+const serviceAccountClientIDPrefix = "sa_"
+
+// CreateServiceAccount creates a service account user and adds it to the
+// organisation with the given role. The client secret is only returned here -
+// just the hash is stored.
+func (o *Organisations) CreateServiceAccount(
+	ctx context.Context,
+	org *models.Organisation,
+	callerID string,
+	input *models.ServiceAccountDTO,
+) (*models.User, string, error) {
+	if err := o.checkRoleChange(org, callerID, input.Role); err != nil {
+		return nil, "", err
+	}
+	if input.Role == models.OrgRoleOwner {
+		return nil, "", fmt.Errorf("%w: service accounts cannot be owners", common.ErrForbidden)
+	}
+
+	clientID, err := models.GenerateRandomToken(12)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating client id: %w", err)
+	}
+
+	secret, err := models.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating client secret: %w", err)
+	}
+	secret = models.ServiceAccountSecretPrefix + secret
+
+	user, err := o.db.SaveUserRecord(ctx, models.NewServiceAccountUser(input.Name, &models.ServiceAccount{
+		OrgID:            org.ID,
+		ClientID:         serviceAccountClientIDPrefix + clientID,
+		ClientSecretHash: models.HashToken(secret),
+		CreatedBy:        callerID,
+	}))
+	if err != nil {
+		return nil, "", fmt.Errorf("error saving service account: %w", err)
+	}
+
+	now := time.Now()
+	if err := o.db.AddOrganisationUser(ctx, org.ID, &models.OrganisationUser{
+		UserID:      user.ID,
+		Name:        user.Name,
+		Role:        input.Role,
+		CreatedDate: now,
+		UpdatedDate: now,
+	}); err != nil {
+		// Don't leave a service account that belongs to nothing
+		if deleteErr := o.db.DeleteServiceAccount(ctx, org.ID, user.ID); deleteErr != nil {
+			return nil, "", errors.Join(err, deleteErr)
+		}
+		return nil, "", err
+	}
+
+	return user, secret, nil
+}
+
+// DeleteServiceAccount removes the service account from the organisation and
+// deletes it. It can no longer authenticate.
+func (o *Organisations) DeleteServiceAccount(ctx context.Context, org *models.Organisation, userID string) error {
+	if org.FindUser(userID) != nil {
+		if err := o.db.RemoveOrganisationUser(ctx, org.ID, userID); err != nil && !errors.Is(err, common.ErrUnknownUser) {
+			return err
+		}
+	}
+
+	return o.db.DeleteServiceAccount(ctx, org.ID, userID)
+}
+
+func (o *Organisations) ListServiceAccounts(
+	ctx context.Context,
+	offset,
+	limit int,
+	orgID string,
+) (*models.Pagination[*models.User], error) {
+	return o.db.ListServiceAccounts(ctx, offset, limit, orgID)
+}
+
+// Service accounts can only be members of the organisation that created them
+func checkServiceAccountOrg(user *models.User, orgID string) error {
+	if user.IsServiceAccount() && user.ServiceAccount.OrgID != orgID {
+		return fmt.Errorf("%w: service account belongs to another organisation", common.ErrForbidden)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// CreateTeam adds a team to the organisation. Team members must already be
+// members of the organisation.
+func (o *Organisations) CreateTeam(ctx context.Context, org *models.Organisation, input *models.TeamDTO) (*models.Team, error) {
+	now := time.Now()
+	team := &models.Team{
+		Name:        input.Name,
+		Slug:        input.Slug,
+		Description: input.Description,
+		Users:       make([]*models.TeamUser, 0, len(input.Users)),
+		CreatedDate: now,
+		UpdatedDate: now,
+	}
+
+	for _, u := range input.Users {
+		if org.FindUser(u.UserID) == nil {
+			return nil, fmt.Errorf("%w: %s", common.ErrUnknownUser, u.UserID)
+		}
+		if team.FindUser(u.UserID) != nil {
+			return nil, fmt.Errorf("%w: %s", common.ErrDuplicateOrgUser, u.UserID)
+		}
+
+		team.Users = append(team.Users, &models.TeamUser{
+			UserID:      u.UserID,
+			Role:        u.Role,
+			CreatedDate: now,
+			UpdatedDate: now,
+		})
+	}
+
+	return o.db.SaveTeam(ctx, org.ID, team)
+}
+
+// DeleteTeam removes the team. Returns ErrNotDeleted if it doesn't exist.
+func (o *Organisations) DeleteTeam(ctx context.Context, org *models.Organisation, teamID string) error {
+	if org.FindTeam(teamID) == nil {
+		return common.ErrNotDeleted
+	}
+
+	return o.db.DeleteTeam(ctx, org.ID, teamID)
+}
+
+// RemoveTeamUser removes the user from the team. They remain a member of the
+// organisation.
+func (o *Organisations) RemoveTeamUser(ctx context.Context, org *models.Organisation, team *models.Team, userID string) error {
+	if team.FindUser(userID) == nil {
+		return fmt.Errorf("%w: %s", common.ErrUnknownUser, userID)
+	}
+
+	if err := o.db.RemoveTeamUser(ctx, org.ID, team.ID, userID); err != nil {
+		return err
+	}
+
+	team.Users = slices.DeleteFunc(team.Users, func(u *models.TeamUser) bool {
+		return u.UserID == userID
+	})
+
+	return nil
+}
+
+// SetTeamUser adds the organisation member to the team or changes their role
+func (o *Organisations) SetTeamUser(
+	ctx context.Context,
+	org *models.Organisation,
+	team *models.Team,
+	userID,
+	role string,
+) (*models.TeamUser, error) {
+	if org.FindUser(userID) == nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrUnknownUser, userID)
+	}
+
+	now := time.Now()
+	member := &models.TeamUser{
+		UserID:      userID,
+		Role:        role,
+		CreatedDate: now,
+		UpdatedDate: now,
+	}
+	if existing := team.FindUser(userID); existing != nil {
+		member.CreatedDate = existing.CreatedDate
+	}
+
+	if err := o.db.SaveTeamUser(ctx, org.ID, team.ID, member); err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// UpdateTeam applies a partial update to the team
+func (o *Organisations) UpdateTeam(
+	ctx context.Context,
+	org *models.Organisation,
+	team *models.Team,
+	input *models.TeamUpdateDTO,
+) (*models.Team, error) {
+	if input.Name != nil {
+		team.Name = *input.Name
+	}
+	if input.Slug != nil {
+		team.Slug = *input.Slug
+	}
+	if input.Description != nil {
+		team.Description = *input.Description
+	}
+	team.UpdatedDate = time.Now()
+
+	return o.db.SaveTeam(ctx, org.ID, team)
+}
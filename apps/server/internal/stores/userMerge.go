@@ -0,0 +1,153 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/rbac"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+)
+
+// MergeUsers moves everything belonging to the source user onto the target
+// user and leaves a tombstone in place of the source. The caller must have
+// proved they control both users. There's no transaction, so each step can be
+// repeated and the source is only retired at the end - if a step fails, the
+// source can still authenticate and the merge can be retried to finish it.
+func (s *Users) MergeUsers(ctx context.Context, targetID, sourceID string) (*models.User, error) {
+	if targetID == sourceID {
+		return nil, fmt.Errorf("%w: cannot merge a user into themselves", common.ErrInvalidMerge)
+	}
+
+	target, err := s.getUser(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := s.getUser(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range []*models.User{target, source} {
+		if u.IsServiceAccount() {
+			return nil, fmt.Errorf("%w: service accounts cannot be merged", common.ErrInvalidMerge)
+		}
+		if !u.IsActive {
+			return nil, fmt.Errorf("%w: %s", common.ErrUserDeactivated, u.ID)
+		}
+	}
+
+	// A user can only have one account with each provider. The target already
+	// has the source's accounts if a previous attempt failed part way.
+	for providerID, account := range source.Accounts {
+		if existing, ok := target.Accounts[providerID]; ok && existing.ProviderUserID != account.ProviderUserID {
+			return nil, fmt.Errorf("%w: both users have a %s account", common.ErrInvalidMerge, providerID)
+		}
+	}
+
+	orgs, err := listAll(func(offset, limit int) (*models.Pagination[*models.Organisation], error) {
+		return s.db.ListOrganisations(ctx, offset, limit, source.ID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing user's organisations: %w", err)
+	}
+
+	for _, org := range orgs {
+		member, teamUsers := mergedOrganisationUser(org, source.ID, target.ID)
+		if member == nil {
+			continue
+		}
+
+		if err := s.db.MergeOrganisationUser(ctx, org.ID, source.ID, member, teamUsers); err != nil {
+			return nil, fmt.Errorf("error merging organisation %s: %w", org.Slug, err)
+		}
+	}
+
+	if err := s.db.ReassignUserRecords(ctx, source.ID, target.ID); err != nil {
+		return nil, fmt.Errorf("error reassigning user records: %w", err)
+	}
+
+	source.MergeInto(target)
+
+	// Save the target first so the provider accounts are never lost
+	target, err = s.db.SaveUserRecord(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("error saving user record: %w", err)
+	}
+	if _, err := s.db.SaveUserRecord(ctx, source); err != nil {
+		return nil, fmt.Errorf("error saving merged user record: %w", err)
+	}
+
+	return target, nil
+}
+
+// Works out the target's membership of the organisation and the teams the
+// source is in once the source's is merged in. Where both are members, the
+// target gets the higher of the two roles. Returns nil if the source isn't a
+// member.
+func mergedOrganisationUser(
+	org *models.Organisation,
+	sourceID,
+	targetID string,
+) (*models.OrganisationUser, map[string]*models.TeamUser) {
+	now := time.Now()
+
+	source := org.FindUser(sourceID)
+	if source == nil {
+		return nil, nil
+	}
+
+	var member models.OrganisationUser
+	if target := org.FindUser(targetID); target != nil {
+		member = *target
+		if role := rbac.HigherRole(org, target.Role, source.Role); role != target.Role {
+			member.Role = role
+			member.UpdatedDate = now
+		}
+	} else {
+		member = *source
+		member.UserID = targetID
+		member.UpdatedDate = now
+	}
+
+	teamUsers := map[string]*models.TeamUser{}
+	for _, team := range org.Teams {
+		source := team.FindUser(sourceID)
+		if source == nil {
+			continue
+		}
+
+		var teamUser models.TeamUser
+		if target := team.FindUser(targetID); target != nil {
+			teamUser = *target
+			if source.Role == models.TeamRoleMaintainer && target.Role != models.TeamRoleMaintainer {
+				teamUser.Role = models.TeamRoleMaintainer
+				teamUser.UpdatedDate = now
+			}
+		} else {
+			teamUser = *source
+			teamUser.UserID = targetID
+			teamUser.UpdatedDate = now
+		}
+		teamUsers[team.ID] = &teamUser
+	}
+
+	return &member, teamUsers
+}
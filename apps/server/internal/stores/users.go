@@ -18,9 +18,16 @@ package stores
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/mrsimonemms/opensesame/apps/server/internal/common"
 	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/internal/providers"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
 	"github.com/mrsimonemms/opensesame/packages/authentication/v1"
@@ -28,15 +35,46 @@ import (
 )
 
 type Users struct {
-	cfg *config.ServerConfig
-	db  database.Driver
+	cfg          *config.ServerConfig
+	db           database.Driver
+	descriptions *providers.Descriptions
+
+	// Serialises refreshing each user's provider tokens
+	tokenLocks [64]sync.Mutex
+}
+
+// AuthenticateServiceAccount returns the service account user if the client
+// credentials are valid. Returns nil if they are not.
+func (s *Users) AuthenticateServiceAccount(ctx context.Context, clientID, clientSecret string) (*models.User, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, nil
+	}
+
+	user, err := s.db.GetServiceAccountByClientID(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting service account: %w", err)
+	}
+	if user == nil || !user.IsServiceAccount() || !user.IsActive {
+		return nil, nil
+	}
+
+	hash := models.HashToken(clientSecret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(user.ServiceAccount.ClientSecretHash)) != 1 {
+		return nil, nil
+	}
+
+	return user, nil
 }
 
+// CreateOrUpdateUserFromProvider saves the user the provider authenticated.
+// If the provider can't be linked to existing users, it is never matched to
+// one by their email address.
 func (s *Users) CreateOrUpdateUserFromProvider(
 	ctx context.Context,
 	providerID string,
 	providerUser *authentication.User,
 	existingUserID *string,
+	canLink bool,
 ) (*models.User, error) {
 	// Search for an existing user
 	userModel, err := s.db.FindUserByProviderAndUserID(ctx, providerID, providerUser.ProviderId)
@@ -44,6 +82,16 @@ func (s *Users) CreateOrUpdateUserFromProvider(
 		return nil, fmt.Errorf("error getting user by provider and user id: %w", err)
 	}
 
+	if userModel == nil && existingUserID == nil && canLink {
+		userModel, err = s.findUserByVerifiedEmail(ctx, providerUser)
+		if err != nil {
+			return nil, err
+		}
+		if userModel != nil {
+			log.Info().Str("userID", userModel.ID).Msg("Linking provider to user with the same verified email address")
+		}
+	}
+
 	if userModel == nil {
 		log.Debug().Msg("No user found - creating")
 		userModel = models.NewUser()
@@ -66,6 +114,12 @@ func (s *Users) CreateOrUpdateUserFromProvider(
 		if targetUser == nil {
 			return nil, fmt.Errorf("unknown user: %s", *existingUserID)
 		}
+		if targetUser.IsServiceAccount() {
+			return nil, fmt.Errorf("cannot link provider to service account")
+		}
+		if !targetUser.IsActive {
+			return nil, fmt.Errorf("%w: %s", common.ErrUserDeactivated, targetUser.ID)
+		}
 
 		// Check if the tokens are used for a different account
 		if userModel.ID == targetUser.ID {
@@ -74,7 +128,13 @@ func (s *Users) CreateOrUpdateUserFromProvider(
 
 		// Use the existing user from now on
 		userModel = targetUser
+	}
 
+	if !userModel.IsActive {
+		return nil, fmt.Errorf("%w: %s", common.ErrUserDeactivated, userModel.ID)
+	}
+
+	if userModel.ID != "" {
 		// Decrypt the existing tokens to avoid double encryption
 		if err := userModel.DecryptTokens(s.cfg); err != nil {
 			log.Error().Err(err).Msg("Error decrypting account tokens")
@@ -82,7 +142,20 @@ func (s *Users) CreateOrUpdateUserFromProvider(
 		}
 	}
 
+	previousEmail := userModel.EmailAddress
 	userModel.AddProvider(providerID, providerUser)
+	userModel.SyncProfile(providerID)
+
+	if userModel.ID != "" {
+		if err := s.checkEmailAddress(ctx, userModel, previousEmail); err != nil {
+			if !errors.Is(err, common.ErrEmailInUse) {
+				return nil, err
+			}
+			// Don't stop them logging in - just keep their existing email address
+			log.Warn().Str("userID", userModel.ID).Msg("Provider email address used by another user - not syncing")
+			userModel.EmailAddress = previousEmail
+		}
+	}
 
 	if err := userModel.EncryptTokens(s.cfg); err != nil {
 		log.Error().Err(err).Msg("Error encrypting account tokens")
@@ -97,27 +170,376 @@ func (s *Users) CreateOrUpdateUserFromProvider(
 	return data, nil
 }
 
+// DeactivateUser stops the user authenticating. The auth tokens issued to
+// them are revoked and their personal access tokens deleted.
+func (s *Users) DeactivateUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return user, nil
+	}
+
+	user.Deactivate()
+
+	user, err = s.db.SaveUserRecord(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("error saving user record: %w", err)
+	}
+
+	if err := s.db.DeletePersonalAccessTokensByUser(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("error deleting personal access tokens: %w", err)
+	}
+
+	return user, nil
+}
+
+// DeleteUser removes the user from their organisations and schedules them to
+// be purged. Owners must transfer their organisations first. Until they're
+// purged, an admin can restore them by reactivating them.
+func (s *Users) DeleteUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsServiceAccount() {
+		return nil, fmt.Errorf("%w: service accounts are deleted by their organisation", common.ErrForbidden)
+	}
+
+	orgs, err := listAll(func(offset, limit int) (*models.Pagination[*models.Organisation], error) {
+		return s.db.ListOrganisations(ctx, offset, limit, user.ID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing user's organisations: %w", err)
+	}
+
+	// Check everything RemoveOrganisationUser enforces before removing them
+	// from any organisation
+	for _, org := range orgs {
+		member := org.FindUser(user.ID)
+		if member == nil {
+			return nil, fmt.Errorf("user is not a member of organisation %s", org.Slug)
+		}
+		if org.IsOwner(user.ID) {
+			return nil, fmt.Errorf("%w: %s", common.ErrOrgOwner, org.Slug)
+		}
+		if member.Role == models.OrgRoleOwner && len(ownerIDs(org.Users)) == 1 {
+			return nil, fmt.Errorf("%w: %s", common.ErrNoOrgOwner, org.Slug)
+		}
+	}
+
+	for i, org := range orgs {
+		if err := s.db.RemoveOrganisationUser(ctx, org.ID, user.ID); err != nil {
+			// Changed in the meantime - put them back so it's all or nothing
+			s.restoreOrganisationUser(ctx, orgs[:i], user.ID)
+			return nil, fmt.Errorf("error removing user from organisation %s: %w", org.Slug, err)
+		}
+	}
+
+	user.ScheduleDeletion(s.cfg.Users.Retention.Duration)
+
+	user, err = s.db.SaveUserRecord(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("error saving user record: %w", err)
+	}
+
+	if err := s.db.DeletePersonalAccessTokensByUser(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("error deleting personal access tokens: %w", err)
+	}
+
+	return user, nil
+}
+
+// ExportUser collects the data held about the user. Provider tokens and
+// secret hashes are excluded.
+func (s *Users) ExportUser(ctx context.Context, user *models.User) (*models.UserExport, error) {
+	orgs, err := listAll(func(offset, limit int) (*models.Pagination[*models.Organisation], error) {
+		return s.db.ListOrganisations(ctx, offset, limit, user.ID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing user's organisations: %w", err)
+	}
+
+	tokens, err := listAll(func(offset, limit int) (*models.Pagination[*models.PersonalAccessToken], error) {
+		return s.db.ListPersonalAccessTokens(ctx, offset, limit, user.ID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing user's personal access tokens: %w", err)
+	}
+
+	events, err := s.db.ListAuditEvents(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing user's audit events: %w", err)
+	}
+
+	export := &models.UserExport{
+		User:                 user.WithoutTokens(),
+		Organisations:        make([]*models.UserExportOrganisation, 0, len(orgs)),
+		PersonalAccessTokens: tokens,
+		AuditEvents:          events,
+		ExportedDate:         time.Now(),
+	}
+
+	for _, org := range orgs {
+		member := org.FindUser(user.ID)
+		if member == nil {
+			continue
+		}
+
+		o := &models.UserExportOrganisation{
+			ID:         org.ID,
+			Name:       org.Name,
+			Slug:       org.Slug,
+			Role:       member.Role,
+			Teams:      make([]*models.UserExportTeam, 0),
+			JoinedDate: member.CreatedDate,
+		}
+
+		for _, team := range org.Teams {
+			if u := team.FindUser(user.ID); u != nil {
+				o.Teams = append(o.Teams, &models.UserExportTeam{
+					ID:         team.ID,
+					Name:       team.Name,
+					Role:       u.Role,
+					JoinedDate: u.CreatedDate,
+				})
+			}
+		}
+
+		export.Organisations = append(export.Organisations, o)
+	}
+
+	return export, nil
+}
+
 func (s *Users) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
 	return s.db.GetUserByID(ctx, userID)
 }
 
-func (s *Users) RemoveProviderFromUser(ctx context.Context, userID, providerID string) (*models.User, error) {
+// PurgeDeleted permanently deletes users past their retention period
+func (s *Users) PurgeDeleted(ctx context.Context) error {
+	count, err := s.db.PurgeUsers(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("error purging users: %w", err)
+	}
+
+	if count > 0 {
+		log.Info().Int64("count", count).Msg("Purged deleted users")
+	}
+
+	return nil
+}
+
+// ReactivateUser lets a deactivated user authenticate again. This restores
+// a deleted user that hasn't been purged, but not their organisations.
+func (s *Users) ReactivateUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsActive {
+		return user, nil
+	}
+
+	user.Reactivate()
+
+	user, err = s.db.SaveUserRecord(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("error saving user record: %w", err)
+	}
+
+	return user, nil
+}
+
+// RemoveProviderFromUser unlinks the provider account from the user and then
+// revokes its tokens with the provider. A failed revocation is returned but
+// doesn't stop the account being unlinked.
+func (s *Users) RemoveProviderFromUser(
+	ctx context.Context,
+	userID,
+	providerID string,
+) (*models.User, *models.ProviderRevocation, error) {
 	user, err := s.db.GetUserByID(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("error getting user by id: %w", err)
+		return nil, nil, fmt.Errorf("error getting user by id: %w", err)
 	}
 	if user == nil {
-		return nil, fmt.Errorf("unknown user")
+		return nil, nil, fmt.Errorf("unknown user")
+	}
+	if user.IsServiceAccount() {
+		return nil, nil, fmt.Errorf("service accounts do not have provider accounts")
 	}
-	if _, ok := user.Accounts[providerID]; !ok {
-		return nil, fmt.Errorf("provider not registered: %s", providerID)
+	account, ok := user.Accounts[providerID]
+	if !ok {
+		return nil, nil, fmt.Errorf("provider not registered: %s", providerID)
 	}
 	if len(user.Accounts) <= 1 {
-		return nil, fmt.Errorf("cannot remove last provider account from user")
+		return nil, nil, fmt.Errorf("cannot remove last provider account from user")
 	}
 
 	delete(user.Accounts, providerID)
 
+	// Stop following the removed account
+	if user.PrimaryEmailProvider == providerID {
+		user.PrimaryEmailProvider = ""
+	}
+	if user.ProfileSyncProvider == providerID {
+		user.ProfileSyncProvider = ""
+	}
+
+	user, err = s.db.SaveUserRecord(ctx, user)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error saving user record: %w", err)
+	}
+
+	return user, s.revokeProviderTokens(ctx, providerID, account), nil
+}
+
+// Finds the user a new provider login can be linked to by their verified
+// email address, if the policy allows it. The user must have verified the
+// same email address with another provider - users without any provider
+// accounts, such as those provisioned with SCIM, never have. Inactive,
+// deleted and merged users are never matched and, if more than one user
+// matches, none are linked as it's ambiguous.
+func (s *Users) findUserByVerifiedEmail(ctx context.Context, providerUser *authentication.User) (*models.User, error) {
+	if s.cfg.Users.AccountLinking != config.AccountLinkingVerifiedEmail {
+		return nil, nil
+	}
+
+	email := providerUser.EmailAddress
+	if email == nil || *email == "" || providerUser.EmailVerified == nil || !*providerUser.EmailVerified {
+		return nil, nil
+	}
+
+	users, err := s.db.ListUsersByEmailAddress(ctx, *email)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users by email address: %w", err)
+	}
+
+	matches := make([]*models.User, 0)
+	for _, user := range users {
+		if !user.IsActive || user.DeletedDate != nil || user.MergedInto != "" || user.IsServiceAccount() {
+			continue
+		}
+
+		for _, account := range user.Accounts {
+			if account.HasVerifiedEmail(*email) {
+				matches = append(matches, user)
+				break
+			}
+		}
+	}
+
+	if len(matches) != 1 {
+		if len(matches) > 1 {
+			log.Warn().Int("count", len(matches)).Msg("More than one user has the verified email address - not linking")
+		}
+		return nil, nil
+	}
+
+	return matches[0], nil
+}
+
+// Add the user back to the organisations and teams they were removed from.
+// This is best effort, so errors are only logged.
+func (s *Users) restoreOrganisationUser(ctx context.Context, orgs []*models.Organisation, userID string) {
+	for _, org := range orgs {
+		if err := s.db.AddOrganisationUser(ctx, org.ID, org.FindUser(userID)); err != nil {
+			log.Error().Err(err).Str("orgID", org.ID).Str("userID", userID).Msg("Error restoring organisation user")
+			continue
+		}
+
+		for _, team := range org.Teams {
+			if member := team.FindUser(userID); member != nil {
+				if err := s.db.SaveTeamUser(ctx, org.ID, team.ID, member); err != nil {
+					log.Error().Err(err).Str("teamID", team.ID).Str("userID", userID).Msg("Error restoring team user")
+				}
+			}
+		}
+	}
+}
+
+// Errors if the user's email address has changed to one another user has
+func (s *Users) checkEmailAddress(ctx context.Context, user *models.User, previousEmail string) error {
+	if user.EmailAddress == "" || strings.EqualFold(user.EmailAddress, previousEmail) {
+		return nil
+	}
+
+	users, err := s.db.ListUsersByEmailAddress(ctx, user.EmailAddress)
+	if err != nil {
+		return fmt.Errorf("error listing users by email address: %w", err)
+	}
+
+	for _, u := range users {
+		if u.ID != user.ID {
+			return fmt.Errorf("%w: %s", common.ErrEmailInUse, user.EmailAddress)
+		}
+	}
+
+	return nil
+}
+
+func (s *Users) getUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user by id: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: %s", common.ErrUnknownUser, userID)
+	}
+
+	return user, nil
+}
+
+// UpdateUser changes the user's profile. Choosing a provider account to
+// follow copies its details immediately and on every login with it.
+func (s *Users) UpdateUser(ctx context.Context, userID string, input *models.UserUpdateDTO) (*models.User, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousEmail := user.EmailAddress
+
+	for _, providerID := range []*string{input.PrimaryEmailProvider, input.ProfileSyncProvider} {
+		if providerID == nil || *providerID == "" {
+			continue
+		}
+		if _, ok := user.Accounts[*providerID]; !ok {
+			return nil, fmt.Errorf("%w: not linked to user: %s", common.ErrInvalidProvider, *providerID)
+		}
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.AvatarURL != nil {
+		user.AvatarURL = *input.AvatarURL
+	}
+	if input.PrimaryEmailProvider != nil {
+		if account := user.Accounts[*input.PrimaryEmailProvider]; account != nil {
+			if account.EmailAddress == nil {
+				return nil, fmt.Errorf("%w: no email address: %s", common.ErrInvalidProvider, *input.PrimaryEmailProvider)
+			}
+			if !account.HasVerifiedEmail(*account.EmailAddress) {
+				return nil, fmt.Errorf("%w: email address not verified: %s", common.ErrInvalidProvider, *input.PrimaryEmailProvider)
+			}
+		}
+		user.PrimaryEmailProvider = *input.PrimaryEmailProvider
+		user.SyncProfile(user.PrimaryEmailProvider)
+	}
+	if input.ProfileSyncProvider != nil {
+		user.ProfileSyncProvider = *input.ProfileSyncProvider
+		user.SyncProfile(user.ProfileSyncProvider)
+	}
+
+	if err := s.checkEmailAddress(ctx, user, previousEmail); err != nil {
+		return nil, err
+	}
+
+	user.UpdatedDate = time.Now()
+
 	user, err = s.db.SaveUserRecord(ctx, user)
 	if err != nil {
 		return nil, fmt.Errorf("error saving user record: %w", err)
@@ -126,9 +548,10 @@ func (s *Users) RemoveProviderFromUser(ctx context.Context, userID, providerID s
 	return user, nil
 }
 
-func NewUsersStore(cfg *config.ServerConfig, db database.Driver) *Users {
+func NewUsersStore(cfg *config.ServerConfig, db database.Driver, descriptions *providers.Descriptions) *Users {
 	return &Users{
-		cfg: cfg,
-		db:  db,
+		cfg:          cfg,
+		db:           db,
+		descriptions: descriptions,
 	}
 }
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stores
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mrsimonemms/opensesame/apps/server/internal/database"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
+	"github.com/mrsimonemms/opensesame/apps/server/pkg/models"
+	"github.com/mrsimonemms/opensesame/packages/authentication/v1"
+)
+
+type usersDriver struct {
+	database.Driver
+
+	users []*models.User
+}
+
+func (d *usersDriver) ListUsersByEmailAddress(_ context.Context, email string) ([]*models.User, error) {
+	users := make([]*models.User, 0)
+	for _, u := range d.users {
+		if u.EmailAddress == email {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func TestFindUserByVerifiedEmail(t *testing.T) {
+	email := "test@test.com"
+	verified := true
+
+	scimUser := models.NewUser()
+	scimUser.ID = "scim"
+	scimUser.EmailAddress = email
+	scimUser.Accounts = map[string]*models.ProviderAccount{}
+
+	providerUser := models.NewUser()
+	providerUser.ID = "provider"
+	providerUser.EmailAddress = email
+	providerUser.Accounts = map[string]*models.ProviderAccount{
+		"github": {
+			ProviderUserID: "1234",
+			EmailAddress:   &email,
+			EmailVerified:  true,
+		},
+	}
+
+	tests := []struct {
+		Name     string
+		Users    []*models.User
+		Expected string
+	}{
+		{
+			Name:  "scim created user",
+			Users: []*models.User{scimUser},
+		},
+		{
+			Name:     "user verified by a provider",
+			Users:    []*models.User{providerUser},
+			Expected: providerUser.ID,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			cfg := &config.ServerConfig{
+				Users: config.Users{AccountLinking: config.AccountLinkingVerifiedEmail},
+			}
+			s := NewUsersStore(cfg, &usersDriver{users: test.Users}, nil)
+
+			user, err := s.findUserByVerifiedEmail(context.Background(), &authentication.User{
+				ProviderId:    "5678",
+				EmailAddress:  &email,
+				EmailVerified: &verified,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var userID string
+			if user != nil {
+				userID = user.ID
+			}
+			if userID != test.Expected {
+				t.Errorf("expected user %q, got %q", test.Expected, userID)
+			}
+		})
+	}
+}
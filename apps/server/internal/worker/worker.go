@@ -0,0 +1,73 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Job is a task that runs in the background on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type Worker struct {
+	jobs []Job
+}
+
+func (w *Worker) Add(job Job) *Worker {
+	w.jobs = append(w.jobs, job)
+	return w
+}
+
+// Start runs each job immediately and then on its interval until the
+// context is cancelled. This does not block.
+func (w *Worker) Start(ctx context.Context) {
+	for _, job := range w.jobs {
+		go w.run(ctx, job)
+	}
+}
+
+func (w *Worker) run(ctx context.Context, job Job) {
+	l := log.With().Str("job", job.Name).Logger()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		l.Debug().Msg("Running background job")
+		if err := job.Run(ctx); err != nil {
+			l.Error().Err(err).Msg("Background job failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			l.Debug().Msg("Stopping background job")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func New() *Worker {
+	return &Worker{}
+}
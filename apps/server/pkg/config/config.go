@@ -18,8 +18,14 @@ package config
 
 import (
 	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"reflect"
 	"regexp"
 	"slices"
 	"strings"
@@ -50,6 +56,10 @@ func (s *ServerConfig) ConnectProviders() error {
 
 func (s *ServerConfig) Validate() error {
 	validate := validator.New(validator.WithRequiredStructEnabled())
+	// Validate durations by their value so they can be compared (eg, gt=0)
+	validate.RegisterCustomTypeFunc(func(v reflect.Value) any {
+		return v.Interface().(Duration).Duration
+	}, Duration{})
 	if err := validate.Struct(s); err != nil {
 		return fmt.Errorf("config failed validation: %w", err)
 	}
@@ -92,15 +102,55 @@ func LoadFromFile(configFile string) (*ServerConfig, error) {
 
 	// Load the default values
 	cfg := ServerConfig{
+		Invitations: Invitations{
+			ExpiresIn: Duration{
+				Duration: time.Hour * 24 * 7, // 7 days
+			},
+		},
 		JWT: JWT{
 			ExpiresIn: Duration{
 				Duration: time.Hour * 24 * 30, // 30 days,
 			},
 			Issuer: "opensesame.cloud",
 		},
+		Notifier: Notifier{
+			Type: NotifierTypeLog,
+		},
+		Orgs: Orgs{
+			PurgeInterval: Duration{
+				Duration: time.Hour,
+			},
+			Retention: Duration{
+				Duration: time.Hour * 24 * 30, // 30 days
+			},
+		},
 		Server: Server{
 			Host: "0.0.0.0",
 			Port: 3000,
+			Callback: ServerCallback{
+				CodeExpiresIn: Duration{
+					Duration: time.Minute,
+				},
+				StateExpiresIn: Duration{
+					Duration: time.Minute * 10,
+				},
+				TokenDelivery: TokenDeliveryQuery,
+			},
+		},
+		Users: Users{
+			AccountLinking: AccountLinkingNever,
+			PurgeInterval: Duration{
+				Duration: time.Hour,
+			},
+			RefreshInterval: Duration{
+				Duration: time.Minute * 5,
+			},
+			RefreshWindow: Duration{
+				Duration: time.Minute * 10,
+			},
+			Retention: Duration{
+				Duration: time.Hour * 24 * 30, // 30 days
+			},
 		},
 	}
 
@@ -112,9 +162,119 @@ func LoadFromFile(configFile string) (*ServerConfig, error) {
 		return p.Disabled
 	})
 
+	if cfg.OAuth != nil {
+		if err := cfg.OAuth.loadDefaults(); err != nil {
+			return nil, err
+		}
+	}
+
 	return &cfg, nil
 }
 
+func (o *OAuth) loadDefaults() error {
+	if o.AuthCodeExpiresIn.Duration == 0 {
+		o.AuthCodeExpiresIn.Duration = time.Minute
+	}
+	if o.IDTokenExpiresIn.Duration == 0 {
+		o.IDTokenExpiresIn.Duration = time.Hour
+	}
+	o.Issuer = strings.TrimSuffix(o.Issuer, "/")
+
+	if o.SigningKey != "" {
+		key, err := parseRSAPrivateKey(o.SigningKey)
+		if err != nil {
+			return fmt.Errorf("error parsing oauth signing key: %w", err)
+		}
+		o.PrivateKey = key
+	}
+
+	return nil
+}
+
+// FindClient returns the registered OAuth client application
+func (o *OAuth) FindClient(clientID string) *OAuthClient {
+	for _, c := range o.Clients {
+		if c.ID == clientID {
+			return &c
+		}
+	}
+	return nil
+}
+
+// IsRedirectURIAllowed checks the redirect URI exactly matches one
+// of the registered URIs, as required by the OAuth 2.0 specification
+func (c *OAuthClient) IsRedirectURIAllowed(redirectURI string) bool {
+	return slices.Contains(c.RedirectURIs, redirectURI)
+}
+
+// IsURLAllowed checks the URL against the allowlist. The scheme and
+// port must match exactly.
+func (s *ServerCallback) IsURLAllowed(input string) bool {
+	u, err := url.Parse(input)
+	if err != nil || !u.IsAbs() || u.User != nil {
+		return false
+	}
+
+	for _, allowed := range s.AllowedURLs {
+		pattern, err := url.Parse(allowed)
+		if err != nil {
+			continue
+		}
+
+		if pattern.Scheme != u.Scheme || pattern.Port() != u.Port() {
+			continue
+		}
+
+		if ok, err := path.Match(pattern.Hostname(), u.Hostname()); err != nil || !ok {
+			continue
+		}
+
+		if matchURLPath(pattern.Path, u.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchURLPath(pattern, input string) bool {
+	if pattern == "" {
+		pattern = "/"
+	}
+	if input == "" {
+		input = "/"
+	}
+
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(input, prefix)
+	}
+
+	return pattern == input
+}
+
+func parseRSAPrivateKey(input string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(input))
+	if block == nil {
+		return nil, fmt.Errorf("no pem data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an rsa key")
+	}
+
+	return rsaKey, nil
+}
+
 // ParseDuration parses a duration string.
 // examples: "10d", "-1.5w" or "3Y4M5d".
 // Add time units are "d"="D", "w"="W", "M", "y"="Y".
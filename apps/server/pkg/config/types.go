@@ -17,6 +17,7 @@
 package config
 
 import (
+	"crypto/rsa"
 	"fmt"
 	"time"
 
@@ -25,11 +26,17 @@ import (
 )
 
 type ServerConfig struct {
-	Database   `json:"database" validate:"required"`
-	Encryption `json:"encryption" validate:"required"`
-	JWT        `json:"jwt" validate:"required"`
-	Providers  []Provider `json:"providers" validate:"required,min=1,dive"`
-	Server     `json:"server" validate:"required"`
+	Admins      []string `json:"admins"` // User IDs allowed to manage every user
+	Database    `json:"database" validate:"required"`
+	Encryption  `json:"encryption" validate:"required"`
+	Invitations Invitations `json:"invitations" validate:"required"`
+	JWT         `json:"jwt" validate:"required"`
+	Notifier    Notifier   `json:"notifier" validate:"required"`
+	OAuth       *OAuth     `json:"oauth"` // Optional - enables the OpenID Connect provider
+	Orgs        Orgs       `json:"orgs" validate:"required"`
+	Providers   []Provider `json:"providers" validate:"required,min=1,dive"`
+	Server      `json:"server" validate:"required"`
+	Users       Users `json:"users" validate:"required"`
 }
 
 type DatabaseType string
@@ -77,6 +84,12 @@ type Encryption struct {
 	Key string `json:"key" validate:"required,min=12"`
 }
 
+type Invitations struct {
+	// URL in the web app to accept the invitation - the token is appended as a query parameter
+	AcceptURL string   `json:"acceptURL" validate:"omitempty,url"`
+	ExpiresIn Duration `json:"expiresIn" validate:"required"`
+}
+
 type JWT struct {
 	ExpiresIn Duration `json:"expiresIn" validate:"required"`
 	Key       []byte   `json:"key" validate:"required,min=6"`
@@ -88,6 +101,50 @@ type MongoDB struct {
 	Database      string `json:"database" validate:"required"`
 }
 
+type NotifierType string
+
+const (
+	// Log the notification - useful for development
+	NotifierTypeLog NotifierType = "log"
+	// POST the notification as JSON to a URL
+	NotifierTypeWebhook NotifierType = "webhook"
+)
+
+type Notifier struct {
+	Type NotifierType `json:"type" validate:"required,oneof=log webhook"`
+
+	Webhook NotifierWebhook `json:"webhook" validate:"required_if=Type webhook"`
+}
+
+type NotifierWebhook struct {
+	Headers map[string]string `json:"headers"`
+	URL     string            `json:"url" validate:"omitempty,url"`
+}
+
+type OAuth struct {
+	AuthCodeExpiresIn Duration      `json:"authCodeExpiresIn" validate:"required"`
+	Clients           []OAuthClient `json:"clients" validate:"dive"`
+	IDTokenExpiresIn  Duration      `json:"idTokenExpiresIn" validate:"required"`
+	Issuer            string        `json:"issuer" validate:"required,url"` // Public URL of this server
+	SigningKey        string        `json:"signingKey" validate:"required"` // PEM encoded RSA private key
+
+	PrivateKey *rsa.PrivateKey `json:"-"`
+}
+
+type OAuthClient struct {
+	ID           string   `json:"id" validate:"required"`
+	Name         string   `json:"name" validate:"required"`
+	Secret       string   `json:"secret"` // Leave empty for public clients - these must use PKCE
+	RedirectURIs []string `json:"redirectURIs" validate:"required,min=1,dive,url"`
+}
+
+type Orgs struct {
+	// How often deleted organisations past their retention are purged
+	PurgeInterval Duration `json:"purgeInterval" validate:"required,gt=0"`
+	// How long a deleted organisation can be restored for
+	Retention Duration `json:"retention" validate:"required"`
+}
+
 type Provider struct {
 	Disabled bool   `json:"disabled"`
 	ID       string `json:"id" validate:"required"`
@@ -101,9 +158,51 @@ type Server struct {
 	Host string `json:"host" validate:"required,ip_addr"`
 	Port int    `json:"port" validate:"required,number"`
 
-	Cookie ServerCookie `json:"cookie"`
+	Callback ServerCallback `json:"callback"`
+	Cookie   ServerCookie   `json:"cookie"`
+}
+
+type TokenDelivery string
+
+const (
+	// Token is sent as a query parameter on the callback URL
+	TokenDeliveryQuery TokenDelivery = "query"
+	// One-time code is sent on the callback URL and exchanged for the token
+	TokenDeliveryCode TokenDelivery = "code"
+)
+
+type ServerCallback struct {
+	// URLs the user may be sent to after login. A trailing "*" in the path
+	// matches any path with that prefix and a "*" in the host matches any
+	// subdomain, eg https://*.example.com/auth/*
+	AllowedURLs    []string      `json:"allowedURLs" validate:"dive,url"`
+	CodeExpiresIn  Duration      `json:"codeExpiresIn" validate:"required"`
+	StateExpiresIn Duration      `json:"stateExpiresIn" validate:"required"`
+	TokenDelivery  TokenDelivery `json:"tokenDelivery" validate:"required,oneof=query code"`
 }
 
 type ServerCookie struct {
 	Key string `json:"key" validate:"required,base64"`
 }
+
+type AccountLinking string
+
+const (
+	// Every provider login not already linked creates a new user
+	AccountLinkingNever AccountLinking = "never"
+	// Link a provider login to the user with the same verified email address
+	AccountLinkingVerifiedEmail AccountLinking = "verifiedEmail"
+)
+
+type Users struct {
+	// Whether a new provider login can be linked to an existing user
+	AccountLinking AccountLinking `json:"accountLinking" validate:"required,oneof=never verifiedEmail"`
+	// How often deleted users past their retention are purged
+	PurgeInterval Duration `json:"purgeInterval" validate:"required,gt=0"`
+	// How often provider tokens that are about to expire are refreshed
+	RefreshInterval Duration `json:"refreshInterval" validate:"required,gt=0"`
+	// How long before they expire that provider tokens are refreshed
+	RefreshWindow Duration `json:"refreshWindow" validate:"required"`
+	// How long a deleted user can be restored for
+	Retention Duration `json:"retention" validate:"required"`
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// Identifies an organisation API key
+const APIKeyPrefix = "osk_"
+
+// APIKey lets a service act on behalf of an organisation. Only the hash of
+// the key is stored - the key itself is shown once when it's created.
+type APIKey struct {
+	ID           string     `json:"id" example:"67e58132a5d5257f95a3251a"` // Represents the database ID
+	OrgID        string     `json:"orgId" example:"67e58132a5d5257f95a32518"`
+	Name         string     `json:"name" example:"CI pipeline"`
+	Prefix       string     `json:"prefix" example:"osk_Ab3dE6gH"` // Start of the key to help identify it
+	KeyHash      string     `json:"-"`
+	Scopes       []string   `json:"scopes" example:"org:read,org:users:read"`
+	CreatedBy    string     `json:"createdBy" example:"507f1f77bcf86cd799439011"` // User ID
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty" format:"date-time"`
+	LastUsedDate *time.Time `json:"lastUsedDate,omitempty" format:"date-time"`
+	CreatedDate  time.Time  `json:"createdDate" format:"date-time"`
+	UpdatedDate  time.Time  `json:"updatedDate" format:"date-time"`
+}
+
+// IsExpired returns true if the key has an expiry that's passed
+func (a *APIKey) IsExpired() bool {
+	return a.ExpiresAt != nil && time.Now().After(*a.ExpiresAt)
+}
+
+type APIKeyDTO struct {
+	Name      string     `json:"name" form:"name" example:"CI pipeline" validate:"required"`
+	Scopes    []string   `json:"scopes" form:"scopes" example:"org:read,org:users:read" validate:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expiresAt" form:"expiresAt" format:"date-time"` // Optional - never expires if not set
+}
+
+type APIKeyCreatedDTO struct {
+	APIKey *APIKey `json:"apiKey"`
+	Key    string  `json:"key" example:"osk_Ab3dE6gH..."` // Only returned once
+}
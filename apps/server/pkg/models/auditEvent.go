@@ -0,0 +1,49 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditActionLogin             AuditAction = "user.login"
+	AuditActionLogout            AuditAction = "user.logout"
+	AuditActionProviderRemoved   AuditAction = "user.provider.removed"
+	AuditActionProviderTokenRead AuditAction = "user.provider.token.read"
+	AuditActionTokenCreated      AuditAction = "user.token.created"
+	AuditActionTokenDeleted      AuditAction = "user.token.deleted"
+	AuditActionUserDeactivated   AuditAction = "user.deactivated"
+	AuditActionUserDeleted       AuditAction = "user.deleted"
+	AuditActionUserExported      AuditAction = "user.exported"
+	AuditActionUserMerged        AuditAction = "user.merged"
+	AuditActionUserReactivated   AuditAction = "user.reactivated"
+	AuditActionUserUpdated       AuditAction = "user.updated"
+)
+
+// AuditEvent records something that happened to a user's account
+type AuditEvent struct {
+	ID          string            `json:"id" example:"67e58132a5d5257f95a3251c"`      // Represents the database ID
+	UserID      string            `json:"userId" example:"507f1f77bcf86cd799439011"`  // The user the event is about
+	ActorID     string            `json:"actorId" example:"507f1f77bcf86cd799439011"` // Who made the change
+	Action      AuditAction       `json:"action" example:"user.login"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	IPAddress   string            `json:"ipAddress,omitempty" example:"127.0.0.1"`
+	CreatedDate time.Time         `json:"createdDate" format:"date-time"`
+}
@@ -21,6 +21,7 @@ import (
 	"crypto/cipher"
 	"crypto/md5" //nolint:gosec // use md5 to create 32 character string
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -86,3 +87,21 @@ func hash(input string) string {
 	md5Hash := md5.Sum(plainText)
 	return hex.EncodeToString(md5Hash[:])
 }
+
+// GenerateRandomToken creates a URL-safe random string with the given number
+// of bytes of entropy
+func GenerateRandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("error generating random token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken creates a one-way hash of a token so it can be stored
+// and looked up without storing the original value
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
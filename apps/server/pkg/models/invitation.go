@@ -0,0 +1,57 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+)
+
+type InvitationStatus string
+
+const (
+	InvitationStatusAccepted InvitationStatus = "ACCEPTED"
+	InvitationStatusDeclined InvitationStatus = "DECLINED"
+	InvitationStatusPending  InvitationStatus = "PENDING"
+	InvitationStatusRevoked  InvitationStatus = "REVOKED"
+)
+
+type Invitation struct {
+	ID           string           `json:"id" example:"67e58132a5d5257f95a32518"` // Represents the database ID
+	OrgID        string           `json:"orgId" example:"67e58132a5d5257f95a32518"`
+	EmailAddress string           `json:"emailAddress" example:"test@testington.com"`
+	Role         string           `json:"role" example:"ORG_MEMBER"`
+	Status       InvitationStatus `json:"status" example:"PENDING"`
+	InvitedBy    string           `json:"invitedBy" example:"507f1f77bcf86cd799439011"`             // User ID
+	RespondedBy  string           `json:"respondedBy,omitempty" example:"507f1f77bcf86cd799439011"` // User ID
+	ExpiresAt    time.Time        `json:"expiresAt" format:"date-time"`
+	CreatedDate  time.Time        `json:"createdDate" format:"date-time"`
+	UpdatedDate  time.Time        `json:"updatedDate" format:"date-time"`
+}
+
+// IsPending returns true if the invitation can still be responded to
+func (i *Invitation) IsPending() bool {
+	return i.Status == InvitationStatusPending && time.Now().Before(i.ExpiresAt)
+}
+
+type InvitationDTO struct {
+	EmailAddress string `json:"emailAddress" form:"emailAddress" example:"test@testington.com" validate:"required,email"`
+	Role         string `json:"role" form:"role" example:"ORG_MEMBER" validate:"required"`
+}
+
+type InvitationResponseDTO struct {
+	Token string `json:"token" form:"token" validate:"required"`
+}
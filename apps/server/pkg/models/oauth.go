@@ -0,0 +1,146 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+)
+
+const (
+	OAuthScopeEmail   = "email"
+	OAuthScopeOpenID  = "openid"
+	OAuthScopeOrgs    = "orgs"
+	OAuthScopeProfile = "profile"
+
+	PKCEMethodS256 = "S256"
+)
+
+// AuthorizationCode is a single-use code issued by the authorize
+// endpoint and exchanged for tokens by the client
+type AuthorizationCode struct {
+	ID                  string    `json:"-"` // Represents the database ID
+	CodeHash            string    `json:"-"` // The code is never stored in plain text
+	ClientID            string    `json:"clientId"`
+	RedirectURI         string    `json:"redirectUri"`
+	UserID              string    `json:"userId"`
+	Scope               string    `json:"scope"`
+	Nonce               string    `json:"nonce"`
+	CodeChallenge       string    `json:"-"`
+	CodeChallengeMethod string    `json:"-"`
+	AuthTime            time.Time `json:"authTime" format:"date-time"`
+	ExpiresAt           time.Time `json:"expiresAt" format:"date-time"`
+	CreatedDate         time.Time `json:"createdDate" format:"date-time"`
+}
+
+// OAuthAuthorizeRequest is the query sent to the authorize endpoint. The
+// provider is an extension to select which provider the user logs in with.
+type OAuthAuthorizeRequest struct {
+	ClientID            string `json:"client_id" query:"client_id"`
+	CodeChallenge       string `json:"code_challenge" query:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" query:"code_challenge_method"`
+	Nonce               string `json:"nonce" query:"nonce"`
+	Provider            string `json:"provider" query:"provider"`
+	RedirectURI         string `json:"redirect_uri" query:"redirect_uri"`
+	ResponseType        string `json:"response_type" query:"response_type"`
+	Scope               string `json:"scope" query:"scope"`
+	State               string `json:"state" query:"state"`
+}
+
+type LoginCodeDTO struct {
+	Code     string `json:"code" form:"code" validate:"required"`
+	Callback string `json:"callback" form:"callback" example:"https://app.example.com/login/callback" validate:"required,url"`
+}
+
+type TokenExchangeDTO struct {
+	OrgID string `json:"orgId" form:"orgId" example:"67e58132a5d5257f95a32518" validate:"required"`
+}
+
+type JSONWebKey struct {
+	Algorithm string `json:"alg" example:"RS256"`
+	Exponent  string `json:"e" example:"AQAB"`
+	KeyID     string `json:"kid" example:"8c2b1a7e9f0d3c4b"`
+	KeyType   string `json:"kty" example:"RSA"`
+	Modulus   string `json:"n"`
+	Use       string `json:"use" example:"sig"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type OAuthError struct {
+	Error       string `json:"error" example:"invalid_request"`
+	Description string `json:"error_description,omitempty" example:"Missing parameter"`
+}
+
+// OAuthIntrospectionResponse is the RFC 7662 response, extended with the
+// user's organisation memberships. Only active is set for invalid tokens.
+type OAuthIntrospectionResponse struct {
+	Active    bool                 `json:"active" example:"true"`
+	ClientID  string               `json:"client_id,omitempty" example:"example-app"`
+	ExpiresAt int64                `json:"exp,omitempty" example:"1742903126"`
+	IssuedAt  int64                `json:"iat,omitempty" example:"1742903126"`
+	Issuer    string               `json:"iss,omitempty" example:"opensesame.cloud"`
+	NotBefore int64                `json:"nbf,omitempty" example:"1742903126"`
+	Orgs      []*OrganisationClaim `json:"orgs,omitempty"`
+	Scope     string               `json:"scope,omitempty" example:"openid profile email"`
+	Subject   string               `json:"sub,omitempty" example:"507f1f77bcf86cd799439011"`
+	TokenType string               `json:"token_type,omitempty" example:"Bearer"`
+	Username  string               `json:"username,omitempty" example:"Test Testington"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in" example:"3600"`
+	IDToken     string `json:"id_token,omitempty"`
+	Scope       string `json:"scope,omitempty" example:"openid profile email"`
+	TokenType   string `json:"token_type" example:"Bearer"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// OrganisationClaim is the representation of an organisation
+// membership inside a token or userinfo response
+type OrganisationClaim struct {
+	ID    string       `json:"id" example:"67e58132a5d5257f95a32518"`
+	Slug  string       `json:"slug" example:"orgname"`
+	Role  string       `json:"role" example:"ORG_OWNER"`
+	Teams []*TeamClaim `json:"teams,omitempty"`
+}
+
+// TeamClaim is the representation of a team membership within an organisation
+type TeamClaim struct {
+	ID   string `json:"id" example:"67e58132a5d5257f95a32519"`
+	Slug string `json:"slug" example:"engineering"`
+	Role string `json:"role" example:"TEAM_MEMBER"`
+}
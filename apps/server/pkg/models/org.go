@@ -20,49 +20,154 @@ import (
 	"time"
 )
 
+const (
+	OrgRoleOwner      = "ORG_OWNER"
+	OrgRoleMaintainer = "ORG_MAINTAINER"
+	OrgRoleMember     = "ORG_MEMBER"
+	OrgRoleViewer     = "ORG_VIEWER"
+)
+
 type OrganisationUser struct {
 	ID           string    `json:"-"`
 	UserID       string    `json:"userId" form:"userId" example:"507f1f77bcf86cd799439011" validate:"required"`
 	Name         string    `json:"name,omitempty" example:"Test Testington"`
 	EmailAddress string    `json:"emailAddress,omitempty" example:"test@testington.com"`
-	Role         string    `json:"role" form:"role" example:"ORG_MAINTAINER" validate:"required"`
+	Role         string    `json:"role" form:"role" example:"ORG_OWNER" validate:"required"`
+	Provisioned  bool      `json:"provisioned,omitempty"` // Added with the organisation's SCIM provisioning
 	CreatedDate  time.Time `json:"createdDate" format:"date-time"`
 	UpdatedDate  time.Time `json:"updatedDate" format:"date-time"`
 }
 
+// OrganisationRole is a custom role defined by the organisation. Built-in
+// roles are also represented by this when displayed.
+type OrganisationRole struct {
+	Name        string    `json:"name" example:"BILLING_ADMIN"`
+	Description string    `json:"description" example:"Manage billing"`
+	Permissions []string  `json:"permissions" example:"org:read,org:update"`
+	BuiltIn     bool      `json:"builtIn" example:"false"`
+	CreatedDate time.Time `json:"createdDate" format:"date-time"`
+	UpdatedDate time.Time `json:"updatedDate" format:"date-time"`
+}
+
+// OwnershipTransfer is an offer to make another member the organisation's
+// owner. It only takes effect once the recipient accepts.
+type OwnershipTransfer struct {
+	FromUserID  string    `json:"fromUserId" example:"507f1f77bcf86cd799439011"`
+	ToUserID    string    `json:"toUserId" example:"507f1f77bcf86cd799439012"`
+	ExpiresAt   time.Time `json:"expiresAt" format:"date-time"`
+	CreatedDate time.Time `json:"createdDate" format:"date-time"`
+}
+
 type Organisation struct {
-	ID          string              `json:"id" example:"67e58132a5d5257f95a32518"` // Represents the database ID
-	Name        string              `json:"name" form:"name" example:"Org Name" validate:"required"`
-	Slug        string              `json:"slug" form:"slug" example:"orgname" validate:"required"`
-	Users       []*OrganisationUser `json:"users" form:"users" validate:"required"`
-	CreatedDate time.Time           `json:"createdDate" format:"date-time"`
-	UpdatedDate time.Time           `json:"updatedDate" format:"date-time"`
+	ID              string              `json:"id" example:"67e58132a5d5257f95a32518"` // Represents the database ID
+	Name            string              `json:"name" form:"name" example:"Org Name" validate:"required"`
+	Slug            string              `json:"slug" form:"slug" example:"orgname" validate:"required"`
+	OwnerID         string              `json:"ownerId" example:"507f1f77bcf86cd799439011"` // The user accountable for the organisation
+	PendingTransfer *OwnershipTransfer  `json:"pendingTransfer,omitempty"`
+	Users           []*OrganisationUser `json:"users" form:"users" validate:"required"`
+	Roles           []*OrganisationRole `json:"roles"` // Custom roles
+	Teams           []*Team             `json:"teams"`
+	CreatedDate     time.Time           `json:"createdDate" format:"date-time"`
+	UpdatedDate     time.Time           `json:"updatedDate" format:"date-time"`
+	DeletedDate     *time.Time          `json:"deletedDate,omitempty" format:"date-time"`
+	PurgeAfter      *time.Time          `json:"purgeAfter,omitempty" format:"date-time"` // Can be restored until this time
+}
+
+// FindRole returns the organisation's custom role
+func (o *Organisation) FindRole(name string) *OrganisationRole {
+	for _, r := range o.Roles {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// FindTeam returns the organisation's team by ID
+func (o *Organisation) FindTeam(teamID string) *Team {
+	for _, t := range o.Teams {
+		if t.ID == teamID {
+			return t
+		}
+	}
+	return nil
+}
+
+// FindUser returns the user's membership of the organisation
+func (o *Organisation) FindUser(userID string) *OrganisationUser {
+	for _, u := range o.Users {
+		if u.UserID == userID {
+			return u
+		}
+	}
+	return nil
+}
+
+// IsOwner returns true if the user is the organisation's owner
+func (o *Organisation) IsOwner(userID string) bool {
+	return o.OwnerID != "" && o.OwnerID == userID
+}
+
+type OrgRoleDTO struct {
+	Name        string   `json:"name" form:"name" example:"BILLING_ADMIN" validate:"required"`
+	Description string   `json:"description" form:"description" example:"Manage billing"`
+	Permissions []string `json:"permissions" form:"permissions" example:"org:read,org:update" validate:"required,min=1,dive,required"`
+}
+
+// OrgRoleUpdateDTO is a partial update - only the fields set are changed
+type OrgRoleUpdateDTO struct {
+	Description *string  `json:"description" form:"description" example:"Manage billing"`
+	Permissions []string `json:"permissions" form:"permissions" example:"org:read,org:update" validate:"omitempty,min=1,dive,required"`
 }
 
 type OrgDTO struct {
 	Name  string        `json:"name" form:"name" example:"Org Name" validate:"required"`
 	Slug  string        `json:"slug" form:"slug" example:"orgname" validate:"required"`
-	Users []*OrgUserDTO `json:"users" form:"users" validate:"required,min=1"`
+	Users []*OrgUserDTO `json:"users" form:"users" validate:"required,min=1"` // Only the current user, who is made the owner
 }
 
 func (o *OrgDTO) ToModel() *Organisation {
+	now := time.Now()
+
 	m := &Organisation{
-		Name:  o.Name,
-		Slug:  o.Slug,
-		Users: []*OrganisationUser{},
+		Name:        o.Name,
+		Slug:        o.Slug,
+		Users:       []*OrganisationUser{},
+		Roles:       []*OrganisationRole{},
+		Teams:       []*Team{},
+		CreatedDate: now,
+		UpdatedDate: now,
 	}
 
 	for _, u := range o.Users {
 		m.Users = append(m.Users, &OrganisationUser{
-			UserID: u.UserID,
-			Role:   u.Role,
+			UserID:      u.UserID,
+			Role:        u.Role,
+			CreatedDate: now,
+			UpdatedDate: now,
 		})
 	}
 
 	return m
 }
 
+// OrgUpdateDTO is a partial update - only the fields set are changed. If
+// set, the users are the complete list of members after the update.
+type OrgUpdateDTO struct {
+	Name  *string       `json:"name" form:"name" example:"Org Name" validate:"omitempty,min=1"`
+	Slug  *string       `json:"slug" form:"slug" example:"orgname" validate:"omitempty,min=1"`
+	Users []*OrgUserDTO `json:"users" form:"users" validate:"omitempty,min=1,dive"`
+}
+
 type OrgUserDTO struct {
-	UserID string `json:"userId" example:"507f1f77bcf86cd799439011"`
-	Role   string `json:"role" example:"ORG_MAINTAINER"`
+	UserID string `json:"userId" example:"507f1f77bcf86cd799439011" validate:"required"`
+	Role   string `json:"role" example:"ORG_OWNER" validate:"required"`
+}
+
+type OrgUserRoleDTO struct {
+	Role string `json:"role" form:"role" example:"ORG_MEMBER" validate:"required"`
+}
+
+type OrgTransferDTO struct {
+	UserID string `json:"userId" form:"userId" example:"507f1f77bcf86cd799439012" validate:"required"`
 }
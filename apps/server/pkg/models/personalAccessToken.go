@@ -0,0 +1,73 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// Identifies a personal access token
+const PersonalAccessTokenPrefix = "osp_"
+
+// Scopes that can be granted to a personal access token
+const (
+	ScopeReadOrgs           = "read:orgs"
+	ScopeReadProviderTokens = "read:provider_tokens" // Decrypted provider access tokens
+	ScopeReadUser           = "read:user"
+	ScopeWriteOrgs          = "write:orgs"
+	ScopeWriteUser          = "write:user"
+)
+
+var PersonalAccessTokenScopes = []string{
+	ScopeReadOrgs,
+	ScopeReadProviderTokens,
+	ScopeReadUser,
+	ScopeWriteOrgs,
+	ScopeWriteUser,
+}
+
+// PersonalAccessToken lets a user script against the API as themselves,
+// limited to the token's scopes. Only the hash of the token is stored - the
+// token itself is shown once when it's created.
+type PersonalAccessToken struct {
+	ID           string     `json:"id" example:"67e58132a5d5257f95a3251a"` // Represents the database ID
+	UserID       string     `json:"userId" example:"507f1f77bcf86cd799439011"`
+	Name         string     `json:"name" example:"Deploy script"`
+	Prefix       string     `json:"prefix" example:"osp_Ab3dE6gH"` // Start of the token to help identify it
+	TokenHash    string     `json:"-"`
+	Scopes       []string   `json:"scopes" example:"read:user,read:orgs"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty" format:"date-time"`
+	LastUsedDate *time.Time `json:"lastUsedDate,omitempty" format:"date-time"`
+	CreatedDate  time.Time  `json:"createdDate" format:"date-time"`
+	UpdatedDate  time.Time  `json:"updatedDate" format:"date-time"`
+}
+
+// IsExpired returns true if the token has an expiry that's passed
+func (p *PersonalAccessToken) IsExpired() bool {
+	return p.ExpiresAt != nil && time.Now().After(*p.ExpiresAt)
+}
+
+type PersonalAccessTokenDTO struct {
+	Name      string     `json:"name" form:"name" example:"Deploy script" validate:"required"`
+	Scopes    []string   `json:"scopes" form:"scopes" example:"read:user,read:orgs" validate:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expiresAt" form:"expiresAt" format:"date-time"` // Optional - never expires if not set
+}
+
+type PersonalAccessTokenCreatedDTO struct {
+	Token *PersonalAccessToken `json:"token"`
+	Key   string               `json:"key" example:"osp_Ab3dE6gH..."` // Only returned once
+}
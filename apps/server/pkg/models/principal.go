@@ -0,0 +1,58 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"slices"
+)
+
+type PrincipalType string
+
+const (
+	PrincipalTypeAPIKey              PrincipalType = "api_key"
+	PrincipalTypeOAuthClient         PrincipalType = "oauth_client"
+	PrincipalTypePersonalAccessToken PrincipalType = "personal_access_token"
+	PrincipalTypeUser                PrincipalType = "user"
+)
+
+// Principal is whoever is making the request - either a user, an OAuth
+// client acting for a user, a user's personal access token or a service using
+// an API key
+type Principal struct {
+	Type     PrincipalType
+	ID       string
+	APIKey   *APIKey              // Set if the type is API key
+	ClientID string               // Set if the type is OAuth client
+	Scopes   []string             // Set if the type is OAuth client - the scopes the user granted
+	Token    *PersonalAccessToken // Set if the type is personal access token
+	User     *User                // Set if the type is user, OAuth client or personal access token
+}
+
+// HasScope checks if an API key, OAuth client or personal access token
+// principal was granted the scope. Users are not limited by scopes.
+func (p *Principal) HasScope(scope string) bool {
+	switch p.Type {
+	case PrincipalTypeAPIKey:
+		return slices.Contains(p.APIKey.Scopes, scope)
+	case PrincipalTypeOAuthClient:
+		return slices.Contains(p.Scopes, scope)
+	case PrincipalTypePersonalAccessToken:
+		return slices.Contains(p.Token.Scopes, scope)
+	default:
+		return true
+	}
+}
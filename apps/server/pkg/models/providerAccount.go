@@ -18,17 +18,54 @@ package models
 
 import (
 	"fmt"
+	"maps"
+	"strings"
+	"time"
 
 	"github.com/mrsimonemms/opensesame/apps/server/pkg/config"
 )
 
 type ProviderAccount struct {
 	ID             string            `json:"-"` // Represents the database ID
-	Tokens         map[string]string `json:"tokens" example:"accessToken:this-is-an-access-token,refreshToken:this-is-the-refresh-token"`
+	Tokens         map[string]string `json:"tokens,omitempty" example:"accessToken:an-access-token,refreshToken:a-refresh-token"`
 	ProviderUserID string            `json:"providerUserId" example:"11223344"`
 	EmailAddress   *string           `json:"emailAddress" example:"test@test.com"`
+	EmailVerified  bool              `json:"emailVerified" example:"true"`
 	Name           *string           `json:"name" example:"Test Testington"`
 	Username       *string           `json:"username" example:"testtestington"`
+	TokensExpireAt *time.Time        `json:"tokensExpireAt,omitempty"`
+}
+
+// ProviderRevocation reports whether the provider revoked the account's
+// tokens. Failures don't stop the account being unlinked or the user logging
+// out.
+type ProviderRevocation struct {
+	ProviderID string `json:"providerId" example:"github"`
+	Revoked    bool   `json:"revoked" example:"true"`
+	Error      string `json:"error,omitempty" example:"provider tokens could not be revoked"`
+}
+
+// RefreshTokens replaces the tokens with those returned by the provider,
+// keeping any that weren't returned, such as an unchanged refresh token
+func (p *ProviderAccount) RefreshTokens(tokens map[string]string, expireAt *int64) {
+	if p.Tokens == nil {
+		p.Tokens = map[string]string{}
+	}
+	maps.Copy(p.Tokens, tokens)
+
+	p.TokensExpireAt = unixTime(expireAt)
+}
+
+// TokensExpireBefore returns true if the provider said when the tokens
+// expire and it's before the given time
+func (p *ProviderAccount) TokensExpireBefore(t time.Time) bool {
+	return p.TokensExpireAt != nil && p.TokensExpireAt.Before(t)
+}
+
+// HasVerifiedEmail returns true if the provider has verified the user owns
+// the email address
+func (p *ProviderAccount) HasVerifiedEmail(emailAddress string) bool {
+	return p.EmailVerified && p.EmailAddress != nil && strings.EqualFold(*p.EmailAddress, emailAddress)
 }
 
 func (p *ProviderAccount) DecryptTokens(cfg *config.ServerConfig) error {
@@ -56,3 +93,13 @@ func (p *ProviderAccount) EncryptTokens(cfg *config.ServerConfig) error {
 
 	return nil
 }
+
+// Converts a Unix timestamp in seconds from a provider
+func unixTime(timestamp *int64) *time.Time {
+	if timestamp == nil {
+		return nil
+	}
+
+	t := time.Unix(*timestamp, 0)
+	return &t
+}
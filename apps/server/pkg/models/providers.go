@@ -19,4 +19,20 @@ package models
 type ProviderModel struct {
 	ID   string `json:"id" example:"github"`
 	Name string `json:"name" example:"GitHub"`
+
+	// Set when the provider has described itself
+	Capabilities *ProviderCapabilities `json:"capabilities,omitempty"`
+	Display      *ProviderDisplay      `json:"display,omitempty"`
+	Routes       []string              `json:"routes,omitempty" example:"GET:/login,GET:/login/callback"`
+}
+
+type ProviderCapabilities struct {
+	Linking bool `json:"linking" example:"true"` // Can be linked to an existing user
+	Refresh bool `json:"refresh" example:"true"` // Can refresh the user's tokens
+	Revoke  bool `json:"revoke" example:"true"`  // Can revoke the user's tokens
+}
+
+type ProviderDisplay struct {
+	Icon         string `json:"icon,omitempty" example:"https://github.githubassets.com/favicons/favicon.svg"`
+	ButtonColour string `json:"buttonColour,omitempty" example:"#24292f"`
 }
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"encoding/json"
+)
+
+// SCIM 2.0 schemas, as defined in RFC 7643 and RFC 7644
+const (
+	SCIMSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SCIMSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SCIMSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+)
+
+type SCIMMeta struct {
+	ResourceType string `json:"resourceType" example:"User"`
+	Created      string `json:"created,omitempty" format:"date-time"`
+	LastModified string `json:"lastModified,omitempty" format:"date-time"`
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty" example:"Test Testington"`
+	GivenName  string `json:"givenName,omitempty" example:"Test"`
+	FamilyName string `json:"familyName,omitempty" example:"Testington"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value" example:"test@test.com"`
+	Type    string `json:"type,omitempty" example:"work"`
+	Primary bool   `json:"primary,omitempty" example:"true"`
+}
+
+// SCIMUser is an organisation member. The userName is their email address.
+type SCIMUser struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty" example:"507f1f77bcf86cd799439011"`
+	ExternalID  string       `json:"externalId,omitempty"` // Accepted but not stored
+	UserName    string       `json:"userName" example:"test@test.com" validate:"required"`
+	Name        *SCIMName    `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty" example:"Test Testington"`
+	Emails      []*SCIMEmail `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty" example:"true"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// FullName returns the best name available for the user
+func (u *SCIMUser) FullName() string {
+	switch {
+	case u.DisplayName != "":
+		return u.DisplayName
+	case u.Name == nil:
+		return ""
+	case u.Name.Formatted != "":
+		return u.Name.Formatted
+	case u.Name.GivenName != "" && u.Name.FamilyName != "":
+		return u.Name.GivenName + " " + u.Name.FamilyName
+	default:
+		return u.Name.GivenName + u.Name.FamilyName
+	}
+}
+
+// PrimaryEmail returns the primary email address, falling back to the userName
+func (u *SCIMUser) PrimaryEmail() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 && u.UserName == "" {
+		return u.Emails[0].Value
+	}
+	return u.UserName
+}
+
+type SCIMGroupMember struct {
+	Value   string `json:"value" example:"507f1f77bcf86cd799439011"` // User ID
+	Display string `json:"display,omitempty" example:"Test Testington"`
+}
+
+// SCIMGroup is an organisation team
+type SCIMGroup struct {
+	Schemas     []string           `json:"schemas"`
+	ID          string             `json:"id,omitempty" example:"67e58132a5d5257f95a32519"`
+	ExternalID  string             `json:"externalId,omitempty"` // Accepted but not stored
+	DisplayName string             `json:"displayName" example:"Engineering" validate:"required"`
+	Members     []*SCIMGroupMember `json:"members"`
+	Meta        *SCIMMeta          `json:"meta,omitempty"`
+}
+
+type SCIMListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults" example:"1"`
+	StartIndex   int      `json:"startIndex" example:"1"`
+	ItemsPerPage int      `json:"itemsPerPage" example:"1"`
+	Resources    []T      `json:"Resources"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op" example:"replace"`
+	Path  string          `json:"path,omitempty" example:"active"`
+	Value json.RawMessage `json:"value,omitempty" swaggertype:"object"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []*SCIMPatchOperation `json:"Operations" validate:"required,min=1,dive"`
+}
+
+type SCIMError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status" example:"404"`
+	SCIMType string   `json:"scimType,omitempty" example:"invalidFilter"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+type SCIMSupported struct {
+	Supported bool `json:"supported"`
+}
+
+type SCIMFilterSupported struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type SCIMServiceProviderConfig struct {
+	Schemas               []string            `json:"schemas"`
+	Patch                 SCIMSupported       `json:"patch"`
+	Bulk                  SCIMSupported       `json:"bulk"`
+	Filter                SCIMFilterSupported `json:"filter"`
+	ChangePassword        SCIMSupported       `json:"changePassword"`
+	Sort                  SCIMSupported       `json:"sort"`
+	ETag                  SCIMSupported       `json:"etag"`
+	AuthenticationSchemes []map[string]string `json:"authenticationSchemes"`
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+// Identifies a service account's client secret
+const ServiceAccountSecretPrefix = "oss_"
+
+// ServiceAccount holds the client credentials of a non-human user. It
+// belongs to the organisation that created it.
+type ServiceAccount struct {
+	OrgID            string `json:"orgId" example:"67e58132a5d5257f95a32518"`
+	ClientID         string `json:"clientId" example:"sa_Ab3dE6gH1jK2"`
+	ClientSecretHash string `json:"-"`
+	CreatedBy        string `json:"createdBy" example:"507f1f77bcf86cd799439011"` // User ID
+}
+
+type ServiceAccountDTO struct {
+	Name string `json:"name" example:"CI pipeline" validate:"required"`
+	Role string `json:"role" example:"ORG_MEMBER" validate:"required"`
+}
+
+type ServiceAccountCreatedDTO struct {
+	User         *User  `json:"user"`
+	ClientID     string `json:"clientId" example:"sa_Ab3dE6gH1jK2"`
+	ClientSecret string `json:"clientSecret" example:"oss_Ab3dE6gH..."` // Only returned once
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+)
+
+const (
+	TeamRoleMaintainer = "TEAM_MAINTAINER"
+	TeamRoleMember     = "TEAM_MEMBER"
+)
+
+type TeamUser struct {
+	UserID      string    `json:"userId" example:"507f1f77bcf86cd799439011"`
+	Role        string    `json:"role" example:"TEAM_MEMBER"`
+	CreatedDate time.Time `json:"createdDate" format:"date-time"`
+	UpdatedDate time.Time `json:"updatedDate" format:"date-time"`
+}
+
+// Team is a group of organisation members. Everyone in a team must be a
+// member of the organisation.
+type Team struct {
+	ID          string      `json:"id" example:"67e58132a5d5257f95a32519"`
+	Name        string      `json:"name" example:"Engineering"`
+	Slug        string      `json:"slug" example:"engineering"`
+	Description string      `json:"description" example:"The engineering department"`
+	Users       []*TeamUser `json:"users"`
+	CreatedDate time.Time   `json:"createdDate" format:"date-time"`
+	UpdatedDate time.Time   `json:"updatedDate" format:"date-time"`
+}
+
+// FindUser returns the user's membership of the team
+func (t *Team) FindUser(userID string) *TeamUser {
+	for _, u := range t.Users {
+		if u.UserID == userID {
+			return u
+		}
+	}
+	return nil
+}
+
+type TeamDTO struct {
+	Name        string         `json:"name" form:"name" example:"Engineering" validate:"required"`
+	Slug        string         `json:"slug" form:"slug" example:"engineering" validate:"required"`
+	Description string         `json:"description" form:"description" example:"The engineering department"`
+	Users       []*TeamUserDTO `json:"users" form:"users" validate:"omitempty,dive"`
+}
+
+// TeamUpdateDTO is a partial update - only the fields set are changed
+type TeamUpdateDTO struct {
+	Name        *string `json:"name" form:"name" example:"Engineering" validate:"omitempty,min=1"`
+	Slug        *string `json:"slug" form:"slug" example:"engineering" validate:"omitempty,min=1"`
+	Description *string `json:"description" form:"description" example:"The engineering department"`
+}
+
+type TeamUserDTO struct {
+	UserID string `json:"userId" form:"userId" example:"507f1f77bcf86cd799439011" validate:"required"`
+	Role   string `json:"role" form:"role" example:"TEAM_MEMBER" validate:"required,oneof=TEAM_MAINTAINER TEAM_MEMBER"`
+}
+
+type TeamUserRoleDTO struct {
+	Role string `json:"role" form:"role" example:"TEAM_MEMBER" validate:"required,oneof=TEAM_MAINTAINER TEAM_MEMBER"`
+}
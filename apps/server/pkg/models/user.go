@@ -25,14 +25,38 @@ import (
 	"github.com/mrsimonemms/opensesame/packages/authentication/v1"
 )
 
+type UserType string
+
+const (
+	UserTypeHuman   UserType = "human"
+	UserTypeService UserType = "service"
+)
+
 type User struct {
-	ID           string                      `json:"id" example:"507f1f77bcf86cd799439011"` // Represents the database ID
-	EmailAddress string                      `json:"emailAddress" example:"test@test.com"`
-	Name         string                      `json:"name" example:"Test Testington"`
-	Accounts     map[string]*ProviderAccount `json:"accounts"` // Key is the provider ID, eg github
-	IsActive     bool                        `json:"isActive" example:"true"`
-	CreatedDate  time.Time                   `json:"createdDate" format:"date-time"`
-	UpdatedDate  time.Time                   `json:"updatedDate" format:"date-time"`
+	ID                   string                      `json:"id" example:"507f1f77bcf86cd799439011"` // Represents the database ID
+	Type                 UserType                    `json:"type" example:"human"`
+	EmailAddress         string                      `json:"emailAddress" example:"test@test.com"`
+	Name                 string                      `json:"name" example:"Test Testington"`
+	AvatarURL            string                      `json:"avatarUrl,omitempty" example:"https://example.com/avatar.png"`
+	Accounts             map[string]*ProviderAccount `json:"accounts"`                 // Key is the provider ID, eg github
+	ServiceAccount       *ServiceAccount             `json:"serviceAccount,omitempty"` // Only set for service accounts
+	PrimaryEmailProvider string                      `json:"primaryEmailProvider,omitempty" example:"github"`
+	ProfileSyncProvider  string                      `json:"profileSyncProvider,omitempty" example:"github"`
+	IsActive             bool                        `json:"isActive" example:"true"`
+	TokensValidAfter     *time.Time                  `json:"-"` // Auth tokens issued before this are revoked
+	DeletedDate          *time.Time                  `json:"deletedDate,omitempty" format:"date-time"`
+	PurgeAfter           *time.Time                  `json:"purgeAfter,omitempty" format:"date-time"` // Can be restored until this time
+	MergedInto           string                      `json:"mergedInto,omitempty" example:"507f1f77bcf86cd799439012"`
+	CreatedDate          time.Time                   `json:"createdDate" format:"date-time"`
+	UpdatedDate          time.Time                   `json:"updatedDate" format:"date-time"`
+}
+
+// ActiveOrg is the organisation an auth token is scoped to
+type ActiveOrg struct {
+	ID          string   `json:"orgId" example:"67e58132a5d5257f95a32518"`
+	Slug        string   `json:"orgSlug" example:"orgname"`
+	Role        string   `json:"role" example:"ORG_MEMBER"`
+	Permissions []string `json:"permissions" example:"org:read,org:users:read"`
 }
 
 func (u *User) AddProvider(providerID string, providerUser *authentication.User) {
@@ -44,13 +68,119 @@ func (u *User) AddProvider(providerID string, providerUser *authentication.User)
 		Tokens:         providerUser.Tokens,
 		ProviderUserID: providerUser.ProviderId,
 		EmailAddress:   providerUser.EmailAddress,
+		EmailVerified:  providerUser.EmailVerified != nil && *providerUser.EmailVerified,
 		Name:           providerUser.Name,
 		Username:       providerUser.Username,
+		TokensExpireAt: unixTime(providerUser.TokensExpireAt),
 	}
 
 	u.UpdatedDate = time.Now()
 }
 
+// Deactivate stops the user authenticating and revokes the auth tokens
+// already issued to them
+func (u *User) Deactivate() {
+	u.IsActive = false
+	u.RevokeAuthTokens()
+}
+
+// IsServiceAccount returns true if the user is a non-human service account
+func (u *User) IsServiceAccount() bool {
+	return u.Type == UserTypeService
+}
+
+// IsTokenRevoked returns true if an auth token issued at the time has been revoked
+func (u *User) IsTokenRevoked(issuedAt time.Time) bool {
+	return u.TokensValidAfter != nil && issuedAt.Before(*u.TokensValidAfter)
+}
+
+// MergeInto moves the provider accounts to the surviving user and leaves a
+// tombstone that can no longer authenticate
+func (u *User) MergeInto(target *User) {
+	now := time.Now()
+
+	if target.Accounts == nil {
+		target.Accounts = map[string]*ProviderAccount{}
+	}
+	for providerID, account := range u.Accounts {
+		target.Accounts[providerID] = account
+	}
+	if target.EmailAddress == "" {
+		target.EmailAddress = u.EmailAddress
+	}
+	target.UpdatedDate = now
+
+	u.Deactivate()
+	u.Accounts = map[string]*ProviderAccount{}
+	u.EmailAddress = ""
+	u.MergedInto = target.ID
+	u.DeletedDate = &now
+}
+
+// Reactivate lets a deactivated user authenticate again and cancels any
+// pending deletion. Tokens revoked when they were deactivated stay revoked.
+func (u *User) Reactivate() {
+	u.IsActive = true
+	u.DeletedDate = nil
+	u.PurgeAfter = nil
+	u.UpdatedDate = time.Now()
+}
+
+// RevokeAuthTokens revokes the auth tokens already issued to the user. Auth
+// tokens record when they were issued to the second, so those issued earlier
+// in the same second stay valid.
+func (u *User) RevokeAuthTokens() {
+	now := time.Now()
+	validAfter := now.Truncate(time.Second)
+	u.TokensValidAfter = &validAfter
+	u.UpdatedDate = now
+}
+
+// ScheduleDeletion deactivates the user and marks them to be purged once the
+// retention period has passed
+func (u *User) ScheduleDeletion(retention time.Duration) {
+	u.Deactivate()
+	now := time.Now()
+	purgeAfter := now.Add(retention)
+	u.DeletedDate = &now
+	u.PurgeAfter = &purgeAfter
+}
+
+// SyncProfile copies the profile from the provider account if the user
+// follows it. The email address follows the primary email provider if one is
+// chosen, otherwise the profile sync provider. Only verified email addresses
+// are copied.
+func (u *User) SyncProfile(providerID string) {
+	account, ok := u.Accounts[providerID]
+	if !ok {
+		return
+	}
+
+	if u.ProfileSyncProvider == providerID && account.Name != nil {
+		u.Name = *account.Name
+	}
+
+	emailProvider := u.PrimaryEmailProvider
+	if emailProvider == "" {
+		emailProvider = u.ProfileSyncProvider
+	}
+	if emailProvider == providerID && account.EmailAddress != nil && account.HasVerifiedEmail(*account.EmailAddress) {
+		u.EmailAddress = *account.EmailAddress
+	}
+}
+
+// WithoutTokens returns a copy of the user with the provider tokens removed
+func (u *User) WithoutTokens() *User {
+	user := *u
+	user.Accounts = make(map[string]*ProviderAccount, len(u.Accounts))
+	for providerID, a := range u.Accounts {
+		account := *a
+		account.Tokens = nil
+		user.Accounts[providerID] = &account
+	}
+	return &user
+}
+
 func (u *User) DecryptTokens(cfg *config.ServerConfig) error {
 	for provider, accounts := range u.Accounts {
 		if err := accounts.DecryptTokens(cfg); err != nil {
@@ -70,16 +200,45 @@ func (u *User) EncryptTokens(cfg *config.ServerConfig) error {
 }
 
 func (u *User) GenerateAuthToken(cfg *config.ServerConfig) (string, error) {
-	t := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"exp": time.Now().Add(cfg.ExpiresIn.Duration).Unix(),
-			"iat": time.Now().Unix(),
-			"iss": cfg.JWT.Issuer,
-			"nbf": time.Now().Unix(),
-			"sub": u.ID,
-		},
-	)
+	return u.signAuthToken(cfg, u.authTokenClaims(cfg))
+}
+
+// GenerateOrgAuthToken generates an auth token scoped to a single organisation.
+// The role and permissions are informational - they are checked again when
+// the token is used.
+func (u *User) GenerateOrgAuthToken(cfg *config.ServerConfig, org *ActiveOrg) (string, error) {
+	claims := u.authTokenClaims(cfg)
+	claims["org_id"] = org.ID
+	claims["org_slug"] = org.Slug
+	claims["permissions"] = org.Permissions
+	claims["role"] = org.Role
+
+	return u.signAuthToken(cfg, claims)
+}
+
+// GenerateOAuthAccessToken generates an auth token for an OAuth client. The
+// client and the scopes granted are recorded so userinfo and introspection
+// only report what the user consented to.
+func (u *User) GenerateOAuthAccessToken(cfg *config.ServerConfig, clientID, scope string) (string, error) {
+	claims := u.authTokenClaims(cfg)
+	claims["client_id"] = clientID
+	claims["scope"] = scope
+
+	return u.signAuthToken(cfg, claims)
+}
+
+func (u *User) authTokenClaims(cfg *config.ServerConfig) jwt.MapClaims {
+	return jwt.MapClaims{
+		"exp": time.Now().Add(cfg.ExpiresIn.Duration).Unix(),
+		"iat": time.Now().Unix(),
+		"iss": cfg.JWT.Issuer,
+		"nbf": time.Now().Unix(),
+		"sub": u.ID,
+	}
+}
+
+func (u *User) signAuthToken(cfg *config.ServerConfig, claims jwt.MapClaims) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	s, err := t.SignedString(cfg.JWT.Key)
 	if err != nil {
@@ -89,9 +248,42 @@ func (u *User) GenerateAuthToken(cfg *config.ServerConfig) (string, error) {
 	return s, nil
 }
 
+// UserUpdateDTO is a partial update - only the fields set are changed. An
+// empty provider stops the user following a provider account.
+type UserUpdateDTO struct {
+	Name                 *string `json:"name" form:"name" example:"Test Testington" validate:"omitempty,min=1"`
+	AvatarURL            *string `json:"avatarUrl" form:"avatarUrl" example:"https://example.com/avatar.png" validate:"omitempty,url"`
+	PrimaryEmailProvider *string `json:"primaryEmailProvider" form:"primaryEmailProvider" example:"github"`
+	ProfileSyncProvider  *string `json:"profileSyncProvider" form:"profileSyncProvider" example:"github"`
+}
+
+type UserLogoutDTO struct {
+	RevokeProviders bool `json:"revokeProviders" form:"revokeProviders" example:"false"` // Also revoke the tokens with each provider
+}
+
+type UserMergeDTO struct {
+	Token string `json:"token" form:"token" validate:"required"` // Auth token of the user to merge
+}
+
 func NewUser() *User {
 	return &User{
+		Type:        UserTypeHuman,
 		IsActive:    true, // Default to true
 		CreatedDate: time.Now(),
 	}
 }
+
+// NewServiceAccountUser creates a user with no provider accounts that
+// authenticates with client credentials
+func NewServiceAccountUser(name string, serviceAccount *ServiceAccount) *User {
+	now := time.Now()
+	return &User{
+		Type:           UserTypeService,
+		Name:           name,
+		Accounts:       map[string]*ProviderAccount{},
+		ServiceAccount: serviceAccount,
+		IsActive:       true,
+		CreatedDate:    now,
+		UpdatedDate:    now,
+	}
+}
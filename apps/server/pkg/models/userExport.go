@@ -0,0 +1,46 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// UserExport is a machine-readable copy of the data held about a user
+type UserExport struct {
+	User                 *User                     `json:"user"` // Provider tokens are excluded
+	Organisations        []*UserExportOrganisation `json:"organisations"`
+	PersonalAccessTokens []*PersonalAccessToken    `json:"personalAccessTokens"`
+	AuditEvents          []*AuditEvent             `json:"auditEvents"`
+	ExportedDate         time.Time                 `json:"exportedDate" format:"date-time"`
+}
+
+type UserExportOrganisation struct {
+	ID         string            `json:"id" example:"67e58132a5d5257f95a32518"`
+	Name       string            `json:"name" example:"Org Name"`
+	Slug       string            `json:"slug" example:"orgname"`
+	Role       string            `json:"role" example:"ORG_MEMBER"`
+	Teams      []*UserExportTeam `json:"teams"`
+	JoinedDate time.Time         `json:"joinedDate" format:"date-time"`
+}
+
+type UserExportTeam struct {
+	ID         string    `json:"id" example:"67e58132a5d5257f95a32519"`
+	Name       string    `json:"name" example:"Engineering"`
+	Role       string    `json:"role" example:"TEAM_MEMBER"`
+	JoinedDate time.Time `json:"joinedDate" format:"date-time"`
+}
@@ -27,10 +27,11 @@ function data() {
         _id: "67e58132a5d5257f95a32518",
         name: "Org Name",
         slug: "orgname",
+        ownerId: "507f1f77bcf86cd799439011",
         users: [
           {
             userId: "507f1f77bcf86cd799439011",
-            role: "ORG_MAINTAINER",
+            role: "ORG_OWNER",
             createdDate: now,
             updatedDate: now,
           },
@@ -39,10 +40,11 @@ function data() {
       {
         name: "Org Name 1",
         slug: "orgname1",
+        ownerId: "507f1f77bcf86cd799439011",
         users: [
           {
             userId: "507f1f77bcf86cd799439011",
-            role: "ORG_MAINTAINER",
+            role: "ORG_OWNER",
             createdDate: now,
             updatedDate: now,
           },
@@ -51,10 +53,11 @@ function data() {
       {
         name: "Org Name 2",
         slug: "orgname2",
+        ownerId: "507f1f77bcf86cd799439011",
         users: [
           {
             userId: "507f1f77bcf86cd799439011",
-            role: "ORG_MAINTAINER",
+            role: "ORG_OWNER",
             createdDate: now,
             updatedDate: now,
           },
@@ -63,10 +66,11 @@ function data() {
       {
         name: "Org Name 3",
         slug: "orgname3",
+        ownerId: "507f1f77bcf86cd799439011",
         users: [
           {
             userId: "507f1f77bcf86cd799439011",
-            role: "ORG_MAINTAINER",
+            role: "ORG_OWNER",
             createdDate: now,
             updatedDate: now,
           },
@@ -75,10 +79,11 @@ function data() {
       {
         name: "Org Name 4",
         slug: "orgname4",
+        ownerId: "507f1f77bcf86cd799439011",
         users: [
           {
             userId: "507f1f77bcf86cd799439011",
-            role: "ORG_MAINTAINER",
+            role: "ORG_OWNER",
             createdDate: now,
             updatedDate: now,
           },
@@ -87,10 +92,11 @@ function data() {
       {
         name: "Org Name 5",
         slug: "orgname5",
+        ownerId: "507f1f77bcf86cd799439011",
         users: [
           {
             userId: "507f1f77bcf86cd799439011",
-            role: "ORG_MAINTAINER",
+            role: "ORG_OWNER",
             createdDate: now,
             updatedDate: now,
           },
@@ -99,10 +105,11 @@ function data() {
       {
         name: "Org Name 6",
         slug: "orgname6",
+        ownerId: "507f1f77bcf86cd799439011",
         users: [
           {
             userId: "507f1f77bcf86cd799439011",
-            role: "ORG_MAINTAINER",
+            role: "ORG_OWNER",
             createdDate: now,
             updatedDate: now,
           },
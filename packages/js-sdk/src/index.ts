@@ -18,4 +18,6 @@ export * from './express';
 export * from './interfaces/authentication/v1/authentication';
 export * from './models';
 export * from './passport/bootstrap';
+export * from './passport/refresh';
+export * from './passport/revoke';
 export * from './sdk';
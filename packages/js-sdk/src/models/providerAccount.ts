@@ -15,10 +15,13 @@
  */
 
 export interface ProviderAccountModel {
-  // This is highly sensitive so will only be exported encrypted
-  tokens: Record<string, string>;
+  // This is highly sensitive so is omitted from the user - get the access
+  // token from /v1/user/provider/:providerID/token
+  tokens?: Record<string, string>;
   providerUserId: string;
   emailAddress?: string;
+  emailVerified: boolean;
   name?: string;
   username?: string;
+  tokensExpireAt?: Date;
 }
@@ -14,7 +14,22 @@
  * limitations under the License.
  */
 
+export interface ProviderCapabilitiesModel {
+  linking: boolean;
+  refresh: boolean;
+  revoke: boolean;
+}
+
+export interface ProviderDisplayModel {
+  icon?: string;
+  buttonColour?: string;
+}
+
 export interface ProviderModel {
   id: string;
   name: string;
+  // Set when the provider has described itself
+  capabilities?: ProviderCapabilitiesModel;
+  display?: ProviderDisplayModel;
+  routes?: string[]; // eg, GET:/login
 }
@@ -13,8 +13,9 @@
  * See the License for the specific language governing permissions and
  * limitations under the License.
  */
+import { status as GrpcStatus } from '@grpc/grpc-js';
 import { Controller, Inject, Logger } from '@nestjs/common';
-import { GrpcMethod } from '@nestjs/microservices';
+import { GrpcMethod, RpcException } from '@nestjs/microservices';
 import { Strategy } from 'passport';
 
 import { ExpressRequest } from '../express';
@@ -22,16 +23,24 @@ import {
   AUTHENTICATION_SERVICE_NAME,
   AuthRequest,
   AuthResponse,
+  DescribeResponse,
+  RefreshTokensRequest,
+  RefreshTokensResponse,
+  RevokeRequest,
+  RevokeResponse,
   RouteEnabledRequest,
   RouteEnabledResponse,
 } from '../interfaces/authentication/v1/authentication';
 import { SDK } from '../sdk';
-import { ROUTES } from './bootstrap';
+import { ProviderOptions, ROUTES } from './bootstrap';
 
 @Controller()
 export class AppController {
   protected readonly logger = new Logger(this.constructor.name);
 
+  @Inject('OPTIONS')
+  private readonly options: ProviderOptions;
+
   @Inject('ROUTES')
   private readonly routes: ROUTES;
 
@@ -47,6 +56,43 @@ export class AppController {
     return passport.authenticate(this.strategies);
   }
 
+  @GrpcMethod(AUTHENTICATION_SERVICE_NAME, 'describe')
+  describe(): DescribeResponse {
+    return {
+      routes: [...this.routes]
+        .filter(([, enabled]) => enabled)
+        .map(([route]) => route),
+      display: this.options.display,
+      linking: this.options.linking ?? true,
+      refresh: Boolean(this.options.refresh),
+      revoke: Boolean(this.options.revoke),
+    };
+  }
+
+  @GrpcMethod(AUTHENTICATION_SERVICE_NAME, 'refreshTokens')
+  refreshTokens(data: RefreshTokensRequest): Promise<RefreshTokensResponse> {
+    if (!this.options.refresh) {
+      throw new RpcException({
+        code: GrpcStatus.UNIMPLEMENTED,
+        message: 'Token refresh not supported by this provider',
+      });
+    }
+
+    return this.options.refresh(data);
+  }
+
+  @GrpcMethod(AUTHENTICATION_SERVICE_NAME, 'revoke')
+  revoke(data: RevokeRequest): Promise<RevokeResponse> {
+    if (!this.options.revoke) {
+      throw new RpcException({
+        code: GrpcStatus.UNIMPLEMENTED,
+        message: 'Token revocation not supported by this provider',
+      });
+    }
+
+    return this.options.revoke(data);
+  }
+
   @GrpcMethod(AUTHENTICATION_SERVICE_NAME, 'routeEnabled')
   routeEnabled(data: RouteEnabledRequest): RouteEnabledResponse {
     return {
@@ -19,7 +19,7 @@ import { Strategy } from 'passport';
 
 import { Route } from '../interfaces/authentication/v1/authentication';
 import { AppController } from './app.controller';
-import { ROUTES } from './bootstrap';
+import { ProviderOptions, ROUTES } from './bootstrap';
 import config from './config';
 
 @Module({
@@ -34,7 +34,11 @@ import config from './config';
 export class AppModule {
   protected static readonly logger = new Logger('AppModule');
 
-  static register(strategies: Strategy[], routes?: ROUTES): DynamicModule {
+  static register(
+    strategies: Strategy[],
+    routes?: ROUTES,
+    options?: ProviderOptions,
+  ): DynamicModule {
     return {
       module: AppModule,
       providers: [
@@ -64,6 +68,10 @@ export class AppModule {
             ]);
           },
         },
+        {
+          provide: 'OPTIONS',
+          useValue: options ?? {},
+        },
       ],
     };
   }
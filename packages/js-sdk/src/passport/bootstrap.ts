@@ -28,19 +28,35 @@ import { join } from 'path';
 
 import {
   AUTHENTICATION_V1_PACKAGE_NAME,
+  Display,
   Route,
 } from '../interfaces/authentication/v1/authentication';
 import { AppModule } from './app.module';
 import loggerConfig from './config/logger';
+import { RefreshHandler } from './refresh';
+import { RevokeHandler } from './revoke';
 
 export type ROUTES = Map<Route, boolean>;
 
+// Optional settings described to the server
+export interface ProviderOptions {
+  // How the provider appears on a login page
+  display?: Display;
+  // Can the provider be linked to an existing user? Defaults to true
+  linking?: boolean;
+  // Exchanges the refresh token for new tokens
+  refresh?: RefreshHandler;
+  // Revokes the tokens with the provider
+  revoke?: RevokeHandler;
+}
+
 export async function bootstrapPassport(
   strategies: Strategy[],
   routes?: ROUTES,
+  options?: ProviderOptions,
 ) {
   const app = await NestFactory.createMicroservice<MicroserviceOptions>(
-    AppModule.register(strategies, routes),
+    AppModule.register(strategies, routes, options),
     {
       logger: new ConsoleLogger(loggerConfig()),
       transport: Transport.GRPC,
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2025 Simon Emms <simon@simonemms.com>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+import { status as GrpcStatus } from '@grpc/grpc-js';
+import { RpcException } from '@nestjs/microservices';
+import { Strategy } from 'passport';
+
+import {
+  RefreshTokensRequest,
+  RefreshTokensResponse,
+} from '../interfaces/authentication/v1/authentication';
+
+export type RefreshHandler = (
+  data: RefreshTokensRequest,
+) => Promise<RefreshTokensResponse>;
+
+// The parts of the node-oauth client used by passport-oauth2 strategies
+interface OAuth2Client {
+  getOAuthAccessToken(
+    code: string,
+    params: Record<string, string>,
+    callback: (
+      err: { statusCode?: number; data?: unknown } | null,
+      accessToken?: string,
+      refreshToken?: string,
+      results?: { expires_in?: number | string },
+    ) => void,
+  ): void;
+}
+
+/**
+ * Tokens Expire At
+ *
+ * Converts the OAuth2 expires_in value, in seconds, to the Unix timestamp
+ * expected by the server
+ */
+export function tokensExpireAt(
+  expiresIn?: number | string,
+): number | undefined {
+  const seconds = Number(expiresIn);
+  if (!expiresIn || Number.isNaN(seconds)) {
+    return undefined;
+  }
+
+  return Math.floor(Date.now() / 1000) + seconds;
+}
+
+/**
+ * OAuth2 Refresh
+ *
+ * Refreshes the tokens with the refresh_token grant of a passport-oauth2
+ * based strategy
+ */
+export function oauth2Refresh(strategy: Strategy): RefreshHandler {
+  const { _oauth2: client } = strategy as Strategy & {
+    _oauth2?: OAuth2Client;
+  };
+  if (!client) {
+    throw new Error(`Strategy ${strategy.name} is not an OAuth2 strategy`);
+  }
+
+  return (data: RefreshTokensRequest): Promise<RefreshTokensResponse> => {
+    const { refreshToken } = data.tokens;
+    if (!refreshToken) {
+      throw new RpcException({
+        code: GrpcStatus.FAILED_PRECONDITION,
+        message: 'No refresh token stored for the user',
+      });
+    }
+
+    return new Promise<RefreshTokensResponse>((resolve, reject) => {
+      client.getOAuthAccessToken(
+        refreshToken,
+        { grant_type: 'refresh_token' },
+        (err, accessToken, newRefreshToken, results) => {
+          if (err || !accessToken) {
+            reject(
+              new RpcException({
+                code: GrpcStatus.FAILED_PRECONDITION,
+                message: `Unable to refresh tokens: ${JSON.stringify(err?.data ?? 'no access token')}`,
+              }),
+            );
+            return;
+          }
+
+          const refreshed: Record<string, string> = { accessToken };
+          // Some providers rotate the refresh token on every refresh
+          if (newRefreshToken) {
+            refreshed.refreshToken = newRefreshToken;
+          }
+
+          resolve({
+            tokens: refreshed,
+            tokensExpireAt: tokensExpireAt(results?.expires_in),
+          });
+        },
+      );
+    });
+  };
+}